@@ -10,5 +10,11 @@ docker run -d --rm -p 5434:5432 -e "POSTGRES_PASSWORD=postgres" -e "POSTGRES_DB=
 Write-Host "Running postgres database for Sharespace microservice"
 docker run -d --rm -p 5435:5432 -e "POSTGRES_PASSWORD=postgres" -e "POSTGRES_DB=dfs_sharespace" --name pg_sharespace postgres:latest
 
+Write-Host "Running postgres database for Webhook microservice"
+docker run -d --rm -p 5436:5432 -e "POSTGRES_PASSWORD=postgres" -e "POSTGRES_DB=dfs_webhook" --name pg_webhook postgres:latest
+
+Write-Host "Running postgres database for Audit microservice"
+docker run -d --rm -p 5437:5432 -e "POSTGRES_PASSWORD=postgres" -e "POSTGRES_DB=dfs_audit" --name pg_audit postgres:latest
+
 Write-Host "Running RabbitMq"
 docker run -d --rm -p 5672:5672 -p 15672:15672 --name rabbitmq rabbitmq:3.10-management
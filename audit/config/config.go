@@ -0,0 +1,83 @@
+package config
+
+import (
+	"dfs/common/discovery"
+	"github.com/joho/godotenv"
+	"log"
+	"os"
+	"time"
+)
+
+type Config struct {
+	DbConnectionString    string
+	AmqpUrl               string
+	HttpAddress           string
+	Discovery             *discovery.Discovery
+	AmqpConnectTimeout    time.Duration
+	AuthGrpcAddress       string
+	IdentitySecret        string
+	ShareSpaceGrpcAddress string
+	Retention             time.Duration
+	RetentionInterval     time.Duration
+}
+
+func Create() *Config {
+	err := godotenv.Load(".env")
+
+	if err != nil {
+		log.Fatal("Cannot load .env file")
+	}
+
+	cfg := &Config{
+		DbConnectionString:    os.Getenv("DB_CONNECTION_STRING"),
+		AmqpUrl:               os.Getenv("AMQP_URL"),
+		AuthGrpcAddress:       os.Getenv("AUTH_GRPC_ADDRESS"),
+		IdentitySecret:        os.Getenv("IDENTITY_SECRET"),
+		ShareSpaceGrpcAddress: os.Getenv("SHARESPACE_GRPC_ADDRESS"),
+	}
+
+	if cfg.Discovery, err = discovery.NewFromEnv(); err != nil {
+		log.Fatalf("Cannot initialize service discovery. Reason: %s", err)
+	}
+
+	if cfg.AmqpUrl == "" {
+		cfg.AmqpUrl = cfg.Discovery.Address("rabbitmq", "amqp")
+	}
+
+	cfg.HttpAddress = os.Getenv("HTTP_ADDRESS")
+
+	if cfg.HttpAddress == "" {
+		cfg.HttpAddress = ":8085"
+	}
+
+	if cfg.AuthGrpcAddress == "" {
+		cfg.AuthGrpcAddress = discovery.Target("auth")
+	}
+
+	if cfg.ShareSpaceGrpcAddress == "" {
+		cfg.ShareSpaceGrpcAddress = discovery.Target("sharespace")
+	}
+
+	cfg.AmqpConnectTimeout = parseDuration("AMQP_CONNECT_TIMEOUT", time.Minute)
+	// A year by default, 0 keeps the records forever
+	cfg.Retention = parseDuration("AUDIT_RETENTION", 365*24*time.Hour)
+	cfg.RetentionInterval = parseDuration("AUDIT_RETENTION_INTERVAL", time.Hour)
+
+	return cfg
+}
+
+func parseDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return duration
+}
@@ -0,0 +1,227 @@
+package controllers
+
+import (
+	"bufio"
+	"dfs/audit/database"
+	"dfs/audit/dtos"
+	"dfs/audit/services"
+	"dfs/common/audit"
+	"dfs/common/events"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"go.uber.org/zap"
+)
+
+const exportBatchSize = 1000
+
+type AuditController struct {
+	log       *zap.Logger
+	rpc       *services.RpcClient
+	store     *session.Store
+	auditRepo *database.AuditRepository
+	events    *events.Bus
+}
+
+func NewAuditController(logger *zap.Logger, rpcClient *services.RpcClient, store *session.Store,
+	auditRepo *database.AuditRepository, bus *events.Bus) *AuditController {
+	return &AuditController{log: logger, rpc: rpcClient, store: store, auditRepo: auditRepo, events: bus}
+}
+
+func (ac *AuditController) RegisterRoutes(app *fiber.App) {
+	app.Get("/api/audit", ac.getRecords)
+	app.Get("/api/audit/export", ac.exportRecords)
+	app.Get("/api/audit/sharespaces/:shareSpaceId", ac.getShareSpaceRecords)
+	app.Get("/api/audit/sharespaces/:shareSpaceId/export", ac.exportShareSpaceRecords)
+}
+
+func (ac *AuditController) getRecords(c *fiber.Ctx) error {
+	if user := ac.getUser(c); user.Role != "admin" {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	filter, ok := parseFilter(c)
+
+	if ok == false {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid filter"})
+	}
+
+	return ac.sendPage(c, filter)
+}
+
+// exportRecords streams all matching records as JSON lines, oldest first.
+func (ac *AuditController) exportRecords(c *fiber.Ctx) error {
+	user := ac.getUser(c)
+
+	if user.Role != "admin" {
+		return c.SendStatus(fiber.StatusForbidden)
+	}
+
+	filter, ok := parseFilter(c)
+
+	if ok == false {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid filter"})
+	}
+
+	defer audit.Record(c, ac.events, ac.log, events.AuditRecordedV1{ActorId: user.Id, Action: audit.AuditExport,
+		Resource: "audit", ShareSpaceId: filter.ShareSpaceId, Details: string(c.Request().URI().QueryString())})
+
+	return ac.export(c, filter)
+}
+
+// getShareSpaceRecords lets the owner of a ShareSpace see what happened in it.
+func (ac *AuditController) getShareSpaceRecords(c *fiber.Ctx) error {
+	filter, status := ac.getShareSpaceFilter(c, ac.getUser(c))
+
+	if status != fiber.StatusOK {
+		return c.SendStatus(status)
+	}
+
+	return ac.sendPage(c, filter)
+}
+
+func (ac *AuditController) exportShareSpaceRecords(c *fiber.Ctx) error {
+	user := ac.getUser(c)
+	filter, status := ac.getShareSpaceFilter(c, user)
+
+	if status != fiber.StatusOK {
+		return c.SendStatus(status)
+	}
+
+	defer audit.Record(c, ac.events, ac.log, events.AuditRecordedV1{ActorId: user.Id, Action: audit.AuditExport,
+		Resource: "audit", ShareSpaceId: filter.ShareSpaceId, Details: string(c.Request().URI().QueryString())})
+
+	return ac.export(c, filter)
+}
+
+func (ac *AuditController) sendPage(c *fiber.Ctx, filter database.AuditFilter) error {
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	pageSize, sizeErr := strconv.Atoi(c.Query("pageSize", "50"))
+
+	if err != nil || sizeErr != nil || page < 1 || pageSize < 1 || pageSize > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid page"})
+	}
+
+	records, total, ok := ac.auditRepo.GetRecords(filter, (page-1)*pageSize, pageSize)
+
+	if ok == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot get audit records"})
+	}
+
+	return c.JSON(dtos.AuditRecordListDto{Records: records, Total: total, Page: page, PageSize: pageSize})
+}
+
+// export writes the records in batches while the response is sent, so large ranges are not held in memory. Errors
+// after the first batch can only end the response early.
+func (ac *AuditController) export(c *fiber.Ctx, filter database.AuditFilter) error {
+	c.Set(fiber.HeaderContentType, "application/x-ndjson")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="audit.jsonl"`)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		encoder := json.NewEncoder(w)
+		var afterId uint
+
+		for {
+			records, ok := ac.auditRepo.GetRecordsAfter(filter, afterId, exportBatchSize)
+
+			if ok == false {
+				return
+			}
+
+			for i := range records {
+				if err := encoder.Encode(&records[i]); err != nil {
+					return
+				}
+			}
+
+			if err := w.Flush(); err != nil {
+				ac.log.Warn("Audit export interrupted", zap.Error(err))
+				return
+			}
+
+			if len(records) < exportBatchSize {
+				return
+			}
+
+			afterId = records[len(records)-1].Id
+		}
+	})
+
+	return nil
+}
+
+func (ac *AuditController) getShareSpaceFilter(c *fiber.Ctx, user dtos.UserDto) (database.AuditFilter, int) {
+	shareSpaceId, err := strconv.ParseUint(c.Params("shareSpaceId"), 10, 32)
+
+	if err != nil || shareSpaceId == 0 {
+		return database.AuditFilter{}, fiber.StatusBadRequest
+	}
+
+	filter, ok := parseFilter(c)
+
+	if ok == false {
+		return database.AuditFilter{}, fiber.StatusBadRequest
+	}
+
+	role, err := ac.rpc.GetShareSpaceRole(c.UserContext(), user.Id, uint(shareSpaceId))
+
+	if err != nil {
+		ac.log.Error("Cannot get ShareSpace role", zap.Error(err))
+		return database.AuditFilter{}, fiber.StatusServiceUnavailable
+	}
+
+	if role != "owner" {
+		return database.AuditFilter{}, fiber.StatusForbidden
+	}
+
+	filter.ShareSpaceId = uint(shareSpaceId)
+
+	return filter, fiber.StatusOK
+}
+
+func (ac *AuditController) getUser(c *fiber.Ctx) dtos.UserDto {
+	sess, err := ac.store.Get(c)
+	defer sess.Destroy()
+
+	if err != nil {
+		ac.log.Panic("Cannot get session", zap.Error(err))
+	}
+
+	return sess.Get("userData").(dtos.UserDto)
+}
+
+// parseFilter reads the actorId, action, resource, shareSpaceId, result, from and to query parameters. Times are
+// RFC 3339, from is inclusive and to exclusive.
+func parseFilter(c *fiber.Ctx) (database.AuditFilter, bool) {
+	filter := database.AuditFilter{Action: c.Query("action"), Resource: c.Query("resource"),
+		Result: c.Query("result")}
+
+	for name, target := range map[string]*uint{"actorId": &filter.ActorId, "shareSpaceId": &filter.ShareSpaceId} {
+		if value := c.Query(name); value != "" {
+			number, err := strconv.ParseUint(value, 10, 32)
+
+			if err != nil {
+				return filter, false
+			}
+
+			*target = uint(number)
+		}
+	}
+
+	for name, target := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := c.Query(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+
+			if err != nil {
+				return filter, false
+			}
+
+			*target = parsed
+		}
+	}
+
+	return filter, true
+}
@@ -0,0 +1,118 @@
+package database
+
+import (
+	"dfs/audit/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// AuditFilter selects records; zero values match everything.
+type AuditFilter struct {
+	ActorId      uint
+	Action       string
+	Resource     string
+	ShareSpaceId uint
+	Result       string
+	From         time.Time
+	To           time.Time
+}
+
+type AuditRepository struct {
+	logger   *zap.Logger
+	database *gorm.DB
+}
+
+func NewAuditRepository(log *zap.Logger, db *gorm.DB) *AuditRepository {
+	return &AuditRepository{logger: log, database: db}
+}
+
+// CreateRecord ignores records of events that were already stored, since events are delivered at least once.
+func (ar *AuditRepository) CreateRecord(record *models.AuditRecord) bool {
+	if err := ar.database.Clauses(clause.OnConflict{DoNothing: true}).Create(record).Error; err != nil {
+		ar.logger.Error("Cannot create audit record", zap.String("EventId", record.EventId), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// GetRecords returns a page of matching records, newest first, and the number of all matches.
+func (ar *AuditRepository) GetRecords(filter AuditFilter, offset int, limit int) ([]models.AuditRecord, int64, bool) {
+	var records []models.AuditRecord
+	var total int64
+
+	query := ar.filter(filter)
+
+	if err := query.Count(&total).Error; err != nil {
+		ar.logger.Error("Cannot count audit records", zap.Error(err))
+		return nil, 0, false
+	}
+
+	if err := query.Order("occurred_at DESC, id DESC").Offset(offset).Limit(limit).Find(&records).Error; err != nil {
+		ar.logger.Error("Cannot get audit records", zap.Error(err))
+		return nil, 0, false
+	}
+
+	return records, total, true
+}
+
+// GetRecordsAfter returns up to limit matching records with an id greater than afterId, in the order they were
+// stored, for exporting large ranges batch by batch.
+func (ar *AuditRepository) GetRecordsAfter(filter AuditFilter, afterId uint, limit int) ([]models.AuditRecord, bool) {
+	var records []models.AuditRecord
+
+	if err := ar.filter(filter).Where("id > ?", afterId).Order("id").Limit(limit).Find(&records).Error; err != nil {
+		ar.logger.Error("Cannot get audit records", zap.Error(err))
+		return nil, false
+	}
+
+	return records, true
+}
+
+// DeleteRecordsBefore removes the records that occurred before the time and returns their number.
+func (ar *AuditRepository) DeleteRecordsBefore(before time.Time) (int64, bool) {
+	result := ar.database.Where("occurred_at < ?", before).Delete(&models.AuditRecord{})
+
+	if result.Error != nil {
+		ar.logger.Error("Cannot delete old audit records", zap.Error(result.Error))
+		return 0, false
+	}
+
+	return result.RowsAffected, true
+}
+
+func (ar *AuditRepository) filter(filter AuditFilter) *gorm.DB {
+	query := ar.database.Model(&models.AuditRecord{})
+
+	if filter.ActorId != 0 {
+		query = query.Where("actor_id = ?", filter.ActorId)
+	}
+
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+
+	if filter.Resource != "" {
+		query = query.Where("resource = ?", filter.Resource)
+	}
+
+	if filter.ShareSpaceId != 0 {
+		query = query.Where("share_space_id = ?", filter.ShareSpaceId)
+	}
+
+	if filter.Result != "" {
+		query = query.Where("result = ?", filter.Result)
+	}
+
+	if filter.From.IsZero() == false {
+		query = query.Where("occurred_at >= ?", filter.From)
+	}
+
+	if filter.To.IsZero() == false {
+		query = query.Where("occurred_at < ?", filter.To)
+	}
+
+	return query
+}
@@ -0,0 +1,40 @@
+package database
+
+import (
+	"dfs/audit/models"
+	"errors"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+// appendOnly makes the database reject updates of audit records, whatever client makes them.
+const appendOnly = `
+CREATE OR REPLACE FUNCTION audit_records_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit records are append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS audit_records_no_update ON audit_records;
+
+CREATE TRIGGER audit_records_no_update BEFORE UPDATE ON audit_records
+	FOR EACH ROW EXECUTE FUNCTION audit_records_append_only();
+`
+
+func Connect(connectionString string) (*gorm.DB, error) {
+	connection, err := gorm.Open(postgres.Open(connectionString), &gorm.Config{})
+
+	if err != nil {
+		return nil, errors.New("could not connect to the database")
+	}
+
+	if err := connection.AutoMigrate(&models.AuditRecord{}); err != nil {
+		return nil, err
+	}
+
+	if err := connection.Exec(appendOnly).Error; err != nil {
+		return nil, err
+	}
+
+	return connection, nil
+}
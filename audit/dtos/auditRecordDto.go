@@ -0,0 +1,10 @@
+package dtos
+
+import "dfs/audit/models"
+
+type AuditRecordListDto struct {
+	Records  []models.AuditRecord `json:"records"`
+	Total    int64                `json:"total"`
+	Page     int                  `json:"page"`
+	PageSize int                  `json:"pageSize"`
+}
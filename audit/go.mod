@@ -0,0 +1,3 @@
+module dfs/audit
+
+go 1.18
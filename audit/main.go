@@ -0,0 +1,15 @@
+package main
+
+import (
+	"dfs/audit/config"
+	"dfs/audit/microservice"
+)
+
+func main() {
+	cfg := config.Create()
+
+	auditMicroservice := microservice.NewAuditMicroservice(cfg)
+	auditMicroservice.Setup()
+	defer auditMicroservice.Cleanup()
+	auditMicroservice.Run()
+}
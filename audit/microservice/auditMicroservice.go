@@ -0,0 +1,113 @@
+package microservice
+
+import (
+	"dfs/common/discovery"
+	"dfs/common/jwks"
+	"log"
+
+	"dfs/audit/config"
+	"dfs/audit/controllers"
+	"dfs/audit/database"
+	"dfs/audit/dtos"
+	"dfs/audit/services"
+	"dfs/common/events"
+	"dfs/common/middleware"
+	"dfs/common/rpc"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type AuditMicroservice struct {
+	config          *config.Config
+	logger          *zap.Logger
+	app             *fiber.App
+	store           *session.Store
+	database        *gorm.DB
+	broker          *rpc.Connection
+	rpcClient       *services.RpcClient
+	subscriber      *services.EventSubscriber
+	retention       *services.RetentionService
+	auditController *controllers.AuditController
+}
+
+func NewAuditMicroservice(cfg *config.Config) *AuditMicroservice {
+	loggerCfg := zap.NewDevelopmentConfig()
+	loggerCfg.EncoderConfig.FunctionKey = "func"
+	logger, err := loggerCfg.Build()
+
+	if err != nil {
+		log.Fatalf("Cannot initialize zap logger. Reason: %s", err)
+	}
+
+	databaseService, err := database.Connect(cfg.DbConnectionString)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize database service. Reason: %s", err)
+	}
+
+	broker, err := rpc.Dial(cfg.AmqpUrl, logger, cfg.AmqpConnectTimeout)
+
+	if err != nil {
+		log.Fatalf("Cannot connect to RabbitMQ. Reason: %s", err)
+	}
+
+	rpcClient, err := services.NewRpcClient(logger, cfg)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize RPC client. Reason: %s", err)
+	}
+
+	bus, err := events.NewBus(broker, logger, "audit")
+
+	if err != nil {
+		log.Fatalf("Cannot initialize event bus. Reason: %s", err)
+	}
+
+	app := fiber.New()
+	store := session.New()
+	auditRepo := database.NewAuditRepository(logger, databaseService)
+	subscriber := services.NewEventSubscriber(logger, bus, auditRepo)
+	retention := services.NewRetentionService(cfg, logger, auditRepo)
+	auditController := controllers.NewAuditController(logger, rpcClient, store, auditRepo, bus)
+	store.RegisterType(dtos.UserDto{})
+
+	return &AuditMicroservice{config: cfg, logger: logger, app: app, store: store, database: databaseService,
+		broker: broker, rpcClient: rpcClient, subscriber: subscriber, retention: retention,
+		auditController: auditController}
+}
+
+func (ams *AuditMicroservice) Setup() {
+	ams.app.Use(cors.New(cors.Config{
+		AllowCredentials: true,
+	}))
+
+	ams.app.Get("/ready", middleware.Readiness(map[string]func() bool{"broker": ams.broker.Ready}))
+
+	ams.app.Use(middleware.Identity(ams.config.IdentitySecret))
+	ams.app.Use(middleware.Authenticate(middleware.Authentication[*dtos.UserDto]{Store: ams.store,
+		Logger: ams.logger, Scope: "audit", Jwks: jwks.NewFromEnv(ams.config.Discovery),
+		ById: ams.rpcClient.GetUserDataById, ByJwt: ams.rpcClient.GetUserDataByJwt,
+		ByApiToken: ams.rpcClient.GetUserDataByApiToken}))
+
+	ams.auditController.RegisterRoutes(ams.app)
+}
+
+func (ams *AuditMicroservice) Run() {
+	ams.subscriber.Start()
+	ams.retention.Start()
+	ams.config.Discovery.Register(ams.logger, discovery.Instance{Service: "audit", Id: uuid.NewString(),
+		Endpoints: map[string]string{"http": ams.config.HttpAddress}})
+	ams.app.Listen(ams.config.HttpAddress)
+}
+
+func (ams *AuditMicroservice) Cleanup() {
+	ams.config.Discovery.Close()
+	ams.rpcClient.Close()
+	ams.broker.Close()
+	ams.logger.Sync()
+}
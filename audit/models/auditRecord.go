@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuditRecord is an action of a user reported by one of the services. Records are never changed, only removed once
+// they are older than the retention period.
+type AuditRecord struct {
+	Id           uint      `json:"id" gorm:"primaryKey"`
+	EventId      string    `json:"eventId" gorm:"uniqueIndex"`
+	Source       string    `json:"source"`
+	ActorId      uint      `json:"actorId" gorm:"index"`
+	Action       string    `json:"action" gorm:"index"`
+	Resource     string    `json:"resource" gorm:"index"`
+	ShareSpaceId uint      `json:"shareSpaceId" gorm:"index"`
+	Ip           string    `json:"ip"`
+	Result       string    `json:"result"`
+	Details      string    `json:"details"`
+	OccurredAt   time.Time `json:"occurredAt" gorm:"index"`
+	CreatedAt    time.Time `json:"recordedAt"`
+}
@@ -0,0 +1,47 @@
+package services
+
+import (
+	"context"
+	"dfs/audit/database"
+	"dfs/audit/models"
+	"dfs/common/events"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// EventSubscriber stores the audit records published by the services.
+type EventSubscriber struct {
+	logger    *zap.Logger
+	bus       *events.Bus
+	auditRepo *database.AuditRepository
+}
+
+func NewEventSubscriber(logger *zap.Logger, bus *events.Bus, auditRepo *database.AuditRepository) *EventSubscriber {
+	return &EventSubscriber{logger: logger, bus: bus, auditRepo: auditRepo}
+}
+
+func (es *EventSubscriber) Start() {
+	go es.bus.Subscribe("events_audit", map[string]events.Handler{
+		events.AuditRecorded: es.auditRecorded,
+	})
+}
+
+func (es *EventSubscriber) auditRecorded(_ context.Context, event events.Event) error {
+	var auditRecorded events.AuditRecordedV1
+
+	if err := event.Decode(1, &auditRecorded); err != nil {
+		return err
+	}
+
+	record := &models.AuditRecord{EventId: event.Id, Source: event.Source, ActorId: auditRecorded.ActorId,
+		Action: auditRecorded.Action, Resource: auditRecorded.Resource, ShareSpaceId: auditRecorded.ShareSpaceId,
+		Ip: auditRecorded.Ip, Result: auditRecorded.Result, Details: auditRecorded.Details,
+		OccurredAt: event.OccurredAt}
+
+	if es.auditRepo.CreateRecord(record) == false {
+		return errors.New("cannot create audit record")
+	}
+
+	return nil
+}
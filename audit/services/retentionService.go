@@ -0,0 +1,45 @@
+package services
+
+import (
+	"dfs/audit/config"
+	"dfs/audit/database"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// RetentionService periodically removes the records older than the retention period.
+type RetentionService struct {
+	logger    *zap.Logger
+	auditRepo *database.AuditRepository
+	retention time.Duration
+	interval  time.Duration
+}
+
+func NewRetentionService(cfg *config.Config, logger *zap.Logger,
+	auditRepo *database.AuditRepository) *RetentionService {
+	return &RetentionService{logger: logger, auditRepo: auditRepo, retention: cfg.Retention,
+		interval: cfg.RetentionInterval}
+}
+
+func (rs *RetentionService) Start() {
+	if rs.retention <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(rs.interval)
+		defer ticker.Stop()
+
+		for {
+			rs.Cleanup()
+			<-ticker.C
+		}
+	}()
+}
+
+func (rs *RetentionService) Cleanup() {
+	if removed, ok := rs.auditRepo.DeleteRecordsBefore(time.Now().Add(-rs.retention)); ok && removed > 0 {
+		rs.logger.Info("Removed old audit records", zap.Int64("Count", removed))
+	}
+}
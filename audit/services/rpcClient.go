@@ -0,0 +1,43 @@
+package services
+
+import (
+	"dfs/audit/config"
+	"dfs/audit/dtos"
+	"dfs/common/lookup"
+	"dfs/proto"
+
+	"go.uber.org/zap"
+)
+
+// RpcClient calls the auth and ShareSpace services over gRPC.
+type RpcClient struct {
+	*lookup.Users[dtos.UserDto]
+	*lookup.ShareSpaces
+	logger *zap.Logger
+}
+
+func NewRpcClient(logger *zap.Logger, cfg *config.Config) (*RpcClient, error) {
+	users, err := lookup.NewUsers(cfg.AuthGrpcAddress, cfg.IdentitySecret, createUserDto)
+
+	if err != nil {
+		return nil, err
+	}
+
+	shareSpaces, err := lookup.NewShareSpaces(cfg.ShareSpaceGrpcAddress, cfg.IdentitySecret)
+
+	if err != nil {
+		users.Close()
+		return nil, err
+	}
+
+	return &RpcClient{Users: users, ShareSpaces: shareSpaces, logger: logger}, nil
+}
+
+func (rpc *RpcClient) Close() {
+	rpc.Users.Close()
+	rpc.ShareSpaces.Close()
+}
+
+func createUserDto(userData *proto.UserData) *dtos.UserDto {
+	return &dtos.UserDto{Id: uint(userData.Id), Name: userData.Name, Email: userData.Email, Role: userData.Role}
+}
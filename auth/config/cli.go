@@ -0,0 +1,6 @@
+package config
+
+type CliArgs struct {
+	RewrapKeys bool   `help:"Re-wrap all stored encryption keys with the current master key and exit"`
+	MakeAdmin  string `help:"Grant the admin role to the user with the given email address and exit" placeholder:"EMAIL"`
+}
@@ -1,17 +1,71 @@
 package config
 
 import (
+	"dfs/common/discovery"
+	"dfs/common/masterkey"
+	"dfs/common/rpc"
+	"github.com/alecthomas/kong"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
-	DbConnectionString string
-	JwtSecretKey       string
+	DbConnectionString    string
+	AmqpUrl               string
+	HttpAddress           string
+	Discovery             *discovery.Discovery
+	AmqpConnectTimeout    time.Duration
+	RpcWorkers            rpc.Workers
+	ShutdownTimeout       time.Duration
+	GrpcAddress           string
+	ShareGrpcAddress      string
+	ShareSpaceGrpcAddress string
+	IdentitySecret        string
+	JwtSigningMethod      string
+	JwtSecretKey          string
+	JwtPrivateKeyPath     string
+	JwtKeyId              string
+	JwtKeystorePath       string
+	AccessTokenTtl        time.Duration
+	RefreshTokenTtl       time.Duration
+	CleanupInterval       time.Duration
+	LoginMaxAttempts      int
+	LoginIpMaxAttempts    int
+	LoginLockout          time.Duration
+	RateLimitMax          int
+	RateLimitWindow       time.Duration
+	SearchRateLimit       int
+	OidcIssuerUrl         string
+	OidcClientId          string
+	OidcClientSecret      string
+	OidcRedirectUrl       string
+	TotpIssuer            string
+	RequireTwoFactor      bool
+	PublicBaseUrl         string
+	MailTransport         string
+	MailFromName          string
+	MailFromAddress       string
+	MailTemplatesDir      string
+	MailDropDirectory     string
+	SendGridApiKey        string
+	SmtpHost              string
+	SmtpPort              int
+	SmtpUsername          string
+	SmtpPassword          string
+	MasterKey             string
+	MasterKeyId           string
+	MasterKeystorePath    string
+	RewrapKeys            bool
+	MakeAdmin             string
 }
 
 func Create() *Config {
+	var cliArgs CliArgs
+	kong.Parse(&cliArgs)
+
 	err := godotenv.Load(".env")
 
 	if err != nil {
@@ -19,9 +73,164 @@ func Create() *Config {
 	}
 
 	cfg := &Config{
-		DbConnectionString: os.Getenv("DB_CONNECTION_STRING"),
-		JwtSecretKey:       os.Getenv("JWT_SECRET_KEY"),
+		DbConnectionString:    os.Getenv("DB_CONNECTION_STRING"),
+		AmqpUrl:               os.Getenv("AMQP_URL"),
+		GrpcAddress:           os.Getenv("GRPC_ADDRESS"),
+		ShareGrpcAddress:      os.Getenv("SHARE_GRPC_ADDRESS"),
+		ShareSpaceGrpcAddress: os.Getenv("SHARESPACE_GRPC_ADDRESS"),
+		IdentitySecret:        os.Getenv("IDENTITY_SECRET"),
+		JwtSigningMethod:      os.Getenv("JWT_SIGNING_METHOD"),
+		JwtSecretKey:          os.Getenv("JWT_SECRET_KEY"),
+		JwtPrivateKeyPath:     os.Getenv("JWT_PRIVATE_KEY_PATH"),
+		JwtKeyId:              os.Getenv("JWT_KEY_ID"),
+		JwtKeystorePath:       os.Getenv("JWT_KEYSTORE_PATH"),
+		MasterKey:             os.Getenv("MASTER_KEY"),
+		MasterKeyId:           os.Getenv("MASTER_KEY_ID"),
+		MasterKeystorePath:    os.Getenv("MASTER_KEYSTORE_PATH"),
+		TotpIssuer:            os.Getenv("TOTP_ISSUER"),
+		RequireTwoFactor:      os.Getenv("REQUIRE_TWO_FACTOR") == "true",
+		PublicBaseUrl:         os.Getenv("PUBLIC_BASE_URL"),
+		MailTransport:         os.Getenv("MAIL_TRANSPORT"),
+		MailFromName:          os.Getenv("MAIL_FROM_NAME"),
+		MailFromAddress:       os.Getenv("MAIL_FROM_ADDRESS"),
+		MailTemplatesDir:      os.Getenv("MAIL_TEMPLATES_DIR"),
+		MailDropDirectory:     os.Getenv("MAIL_DROP_DIRECTORY"),
+		SendGridApiKey:        os.Getenv("SENDGRID_API_KEY"),
+		SmtpHost:              os.Getenv("SMTP_HOST"),
+		SmtpUsername:          os.Getenv("SMTP_USERNAME"),
+		SmtpPassword:          os.Getenv("SMTP_PASSWORD"),
+		OidcIssuerUrl:         os.Getenv("OIDC_ISSUER_URL"),
+		OidcClientId:          os.Getenv("OIDC_CLIENT_ID"),
+		OidcClientSecret:      os.Getenv("OIDC_CLIENT_SECRET"),
+		OidcRedirectUrl:       os.Getenv("OIDC_REDIRECT_URL"),
+		RewrapKeys:            cliArgs.RewrapKeys,
+		MakeAdmin:             cliArgs.MakeAdmin,
+	}
+
+	if cfg.MasterKeyId == "" {
+		cfg.MasterKeyId = "default"
+	}
+
+	if cfg.Discovery, err = discovery.NewFromEnv(); err != nil {
+		log.Fatalf("Cannot initialize service discovery. Reason: %s", err)
+	}
+
+	if cfg.AmqpUrl == "" {
+		cfg.AmqpUrl = cfg.Discovery.Address("rabbitmq", "amqp")
+	}
+
+	cfg.HttpAddress = os.Getenv("HTTP_ADDRESS")
+
+	if cfg.HttpAddress == "" {
+		cfg.HttpAddress = ":8080"
+	}
+
+	if cfg.GrpcAddress == "" {
+		cfg.GrpcAddress = "localhost:9080"
+	}
+
+	if cfg.ShareGrpcAddress == "" {
+		cfg.ShareGrpcAddress = discovery.Target("share")
+	}
+
+	if cfg.ShareSpaceGrpcAddress == "" {
+		cfg.ShareSpaceGrpcAddress = discovery.Target("sharespace")
 	}
 
+	if cfg.JwtSigningMethod == "" {
+		cfg.JwtSigningMethod = "HS256"
+	}
+
+	if cfg.JwtKeyId == "" {
+		cfg.JwtKeyId = "default"
+	}
+
+	if cfg.TotpIssuer == "" {
+		cfg.TotpIssuer = "DFS"
+	}
+
+	if cfg.PublicBaseUrl == "" {
+		cfg.PublicBaseUrl = "http://localhost"
+	}
+
+	if cfg.OidcRedirectUrl == "" {
+		cfg.OidcRedirectUrl = cfg.PublicBaseUrl + "/api/oidc/callback"
+	}
+
+	if cfg.MailTransport == "" {
+		cfg.MailTransport = "sendgrid"
+	}
+
+	if cfg.MailFromName == "" {
+		cfg.MailFromName = "DFS Team"
+	}
+
+	if cfg.MailFromAddress == "" {
+		cfg.MailFromAddress = "dfs.pk.proj@gmail.com"
+	}
+
+	if cfg.MailDropDirectory == "" {
+		cfg.MailDropDirectory = "mail"
+	}
+
+	cfg.SmtpPort = parseInt("SMTP_PORT", 587)
+	cfg.LoginMaxAttempts = parseInt("LOGIN_MAX_FAILED_ATTEMPTS", 5)
+	cfg.LoginIpMaxAttempts = parseInt("LOGIN_MAX_FAILED_ATTEMPTS_PER_IP", 20)
+	cfg.RateLimitMax = parseInt("RATE_LIMIT_MAX", 10)
+	cfg.SearchRateLimit = parseInt("USER_SEARCH_RATE_LIMIT", 60)
+
+	cfg.AccessTokenTtl = parseDuration("ACCESS_TOKEN_TTL", time.Minute*15)
+	cfg.RefreshTokenTtl = parseDuration("REFRESH_TOKEN_TTL", time.Hour*24*30)
+	cfg.CleanupInterval = parseDuration("CLEANUP_INTERVAL", time.Hour)
+	cfg.LoginLockout = parseDuration("LOGIN_LOCKOUT_DURATION", time.Minute*15)
+	cfg.RateLimitWindow = parseDuration("RATE_LIMIT_WINDOW", time.Minute)
+	cfg.AmqpConnectTimeout = parseDuration("AMQP_CONNECT_TIMEOUT", time.Minute)
+	cfg.ShutdownTimeout = parseDuration("SHUTDOWN_TIMEOUT", time.Second*30)
+
+	rpcWorkers, err := rpc.ParseWorkers(parseInt("RPC_WORKERS", 4), os.Getenv("RPC_QUEUE_WORKERS"))
+
+	if err != nil {
+		log.Fatalf("Invalid RPC_QUEUE_WORKERS value. Reason: %s", err)
+	}
+
+	cfg.RpcWorkers = rpcWorkers
+
 	return cfg
 }
+
+func parseDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return duration
+}
+
+func parseInt(name string, defaultValue int) int {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return number
+}
+
+// MasterKeys returns the master keys the data keys are wrapped with.
+func (cfg *Config) MasterKeys() masterkey.Config {
+	return masterkey.Config{KeystorePath: cfg.MasterKeystorePath, Key: cfg.MasterKey, KeyId: cfg.MasterKeyId}
+}
@@ -0,0 +1,489 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"dfs/auth/database"
+	"dfs/auth/dtos"
+	"dfs/auth/models"
+	"dfs/auth/services"
+	"dfs/auth/validation"
+	"dfs/common/audit"
+	"dfs/common/events"
+	"dfs/common/masterkey"
+	"encoding/base64"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type AccountController struct {
+	auth          *Authenticator
+	logger        *zap.Logger
+	userRepo      *database.UserRepository
+	vrfRepo       *database.VerificationRepository
+	sessRepo      *database.SessionRepository
+	emailSrv      *services.MailService
+	rpc           *services.RpcClient
+	keySrv        *masterkey.KeyService
+	events        *events.Bus
+	limiter       fiber.Handler
+	searchLimiter fiber.Handler
+}
+
+func NewAccountController(auth *Authenticator, logger *zap.Logger, usrRepo *database.UserRepository,
+	vrfRepo *database.VerificationRepository, sessRepo *database.SessionRepository, mail *services.MailService,
+	rpcClient *services.RpcClient, keySrv *masterkey.KeyService, bus *events.Bus, limiter fiber.Handler,
+	searchLimiter fiber.Handler) *AccountController {
+	return &AccountController{auth: auth, logger: logger, userRepo: usrRepo, vrfRepo: vrfRepo, sessRepo: sessRepo,
+		emailSrv: mail, rpc: rpcClient, keySrv: keySrv, events: bus, limiter: limiter, searchLimiter: searchLimiter}
+}
+
+func (ac *AccountController) RegisterRoutes(app *fiber.App) {
+	app.Post("/api/register", ac.limiter, ac.Register)
+	app.Post("/api/verify/resend", ac.limiter, ac.ResendVerification)
+	app.Get("/api/verify/:code", ac.VerifyEmail)
+	app.Post("/api/password/forgot", ac.limiter, ac.ForgotPassword)
+	app.Post("/api/password/reset", ac.limiter, ac.ResetPassword)
+	app.Post("/api/password/change", ac.ChangePassword)
+	app.Get("/api/user", ac.User)
+	app.Patch("/api/user", ac.UpdateProfile)
+	app.Get("/api/user/email/verify/:code", ac.VerifyEmailChange)
+	app.Get("/api/users/search", ac.searchLimiter, ac.SearchUsers)
+}
+
+func (ac *AccountController) Register(c *fiber.Ctx) error {
+	registerDto := new(dtos.RegisterDto)
+
+	if err := c.BodyParser(&registerDto); err != nil {
+		ac.logger.Warn("Cannot parse register data", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	user := ac.userRepo.GetUserByEmail(registerDto.Email)
+
+	if user != nil {
+		return c.JSON(fiber.Map{
+			"message": "This email address is already taken",
+		})
+	}
+
+	errors := validation.Validate(registerDto)
+
+	if errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	// Leftovers of a registration that failed halfway would block the email address
+	if ac.vrfRepo.DeleteVerificationsByEmail(registerDto.Email, models.PurposeEmailVerification) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot create account"})
+	}
+
+	verificationData := ac.vrfRepo.CreateAndReturnVerificationData(registerDto.Email,
+		models.PurposeEmailVerification, time.Hour*1)
+
+	if verificationData == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot create account"})
+	}
+
+	if err := ac.emailSrv.SendMail(registerDto.Name, registerDto.Email, verificationData.Code); err != nil {
+		ac.vrfRepo.DeleteVerification(verificationData.Id)
+		ac.logger.Error("Cannot send verification mail", zap.Error(err))
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Cannot send verification mail on the given email address",
+		})
+	}
+
+	password, _ := bcrypt.GenerateFromPassword([]byte(registerDto.Password), 14)
+
+	wrappedKey, err := generateCryptKey(ac.keySrv)
+
+	if err != nil {
+		ac.logger.Error("Cannot generate encryption key", zap.Error(err))
+		c.Status(fiber.StatusInternalServerError)
+		return c.JSON(fiber.Map{
+			"message": "Cannot create account",
+		})
+	}
+
+	if isCreated, err := ac.rpc.CreateHomeDirectory(c.UserContext(), registerDto.Email); isCreated == false {
+		ac.logger.Error("Cannot create home directory for user:", zap.String("User", registerDto.Email), zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Cannot create account",
+		})
+	}
+
+	if ac.userRepo.CreateUser(registerDto.Name, registerDto.Email, password, wrappedKey) == 0 {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot create account"})
+	}
+
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+func (ac *AccountController) VerifyEmail(c *fiber.Ctx) error {
+	code := c.Params("code")
+
+	verificationData := ac.vrfRepo.GetVerificationByCode(code, models.PurposeEmailVerification)
+
+	if verificationData == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	// Expired registrations are removed together with their home directories by the cleanup job
+	if time.Now().After(verificationData.ExpiresAt) {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	user := ac.userRepo.GetUserByEmail(verificationData.Email)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if ac.userRepo.VerifyUser(user) == false {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	ac.vrfRepo.DeleteVerification(verificationData.Id)
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (ac *AccountController) ResendVerification(c *fiber.Ctx) error {
+	resendDto := new(dtos.ResendVerificationDto)
+
+	if err := c.BodyParser(&resendDto); err != nil {
+		ac.logger.Warn("Cannot parse resend verification data", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	errors := validation.Validate(resendDto)
+
+	if errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	user := ac.userRepo.GetUserByEmail(resendDto.Email)
+
+	// Respond the same way whether the account exists or not
+	if user == nil || user.Verified {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	if ac.vrfRepo.DeleteVerificationsByEmail(user.Email, models.PurposeEmailVerification) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot resend verification mail"})
+	}
+
+	verificationData := ac.vrfRepo.CreateAndReturnVerificationData(user.Email, models.PurposeEmailVerification,
+		time.Hour*1)
+
+	if verificationData == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot resend verification mail"})
+	}
+
+	if err := ac.emailSrv.SendMail(user.Name, user.Email, verificationData.Code); err != nil {
+		ac.logger.Error("Cannot send verification mail", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot resend verification mail"})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (ac *AccountController) ForgotPassword(c *fiber.Ctx) error {
+	forgotPasswordDto := new(dtos.ForgotPasswordDto)
+
+	if err := c.BodyParser(&forgotPasswordDto); err != nil {
+		ac.logger.Warn("Cannot parse forgot password data", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	errors := validation.Validate(forgotPasswordDto)
+
+	if errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	user := ac.userRepo.GetUserByEmail(forgotPasswordDto.Email)
+
+	// Respond the same way whether the account exists or not, failures are only logged
+	if user == nil || user.Verified == false {
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	if ac.vrfRepo.DeleteVerificationsByEmail(user.Email, models.PurposePasswordReset) == false {
+		ac.logger.Error("Cannot delete previous password reset codes", zap.Uint("UserId", user.Id))
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	verificationData := ac.vrfRepo.CreateAndReturnVerificationData(user.Email, models.PurposePasswordReset,
+		time.Minute*30)
+
+	if verificationData == nil {
+		ac.logger.Error("Cannot create password reset code", zap.Uint("UserId", user.Id))
+		return c.SendStatus(fiber.StatusOK)
+	}
+
+	if err := ac.emailSrv.SendPasswordResetMail(user.Name, user.Email, verificationData.Code); err != nil {
+		ac.vrfRepo.DeleteVerification(verificationData.Id)
+		ac.logger.Error("Cannot send password reset mail", zap.Uint("UserId", user.Id), zap.Error(err))
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (ac *AccountController) ResetPassword(c *fiber.Ctx) error {
+	resetPasswordDto := new(dtos.ResetPasswordDto)
+
+	if err := c.BodyParser(&resetPasswordDto); err != nil {
+		ac.logger.Warn("Cannot parse reset password data", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	errors := validation.Validate(resetPasswordDto)
+
+	if errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	verificationData := ac.vrfRepo.GetVerificationByCode(resetPasswordDto.Code, models.PurposePasswordReset)
+
+	if verificationData == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid or expired code"})
+	}
+
+	// The code can be used only once
+	ac.vrfRepo.DeleteVerification(verificationData.Id)
+
+	if time.Now().After(verificationData.ExpiresAt) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid or expired code"})
+	}
+
+	user := ac.userRepo.GetUserByEmail(verificationData.Email)
+
+	if user == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid or expired code"})
+	}
+
+	if ac.updatePassword(user, resetPasswordDto.Password) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot reset password"})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (ac *AccountController) ChangePassword(c *fiber.Ctx) error {
+	user, status := ac.auth.getUserFromJwt(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	changePasswordDto := new(dtos.ChangePasswordDto)
+
+	if err := c.BodyParser(&changePasswordDto); err != nil {
+		ac.logger.Warn("Cannot parse change password data", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	errors := validation.Validate(changePasswordDto)
+
+	if errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.Password, []byte(changePasswordDto.CurrentPassword)); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Incorrect password"})
+	}
+
+	if ac.updatePassword(user, changePasswordDto.NewPassword) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot change password"})
+	}
+
+	ac.auth.clearTokenCookies(c)
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (ac *AccountController) User(c *fiber.Ctx) error {
+	user, status := ac.auth.getUserFromJwt(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	return c.JSON(user)
+}
+
+// UpdateProfile changes the name right away. A new email address is only stored as pending until it is confirmed
+// with the code sent to it, and changing it requires the current password.
+func (ac *AccountController) UpdateProfile(c *fiber.Ctx) error {
+	user, status := ac.auth.getUserFromJwt(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	profileDto := new(dtos.UpdateProfileDto)
+
+	if err := c.BodyParser(&profileDto); err != nil {
+		ac.logger.Warn("Cannot parse profile data", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	if errors := validation.Validate(profileDto); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	if profileDto.Name != "" && profileDto.Name != user.Name {
+		if ac.userRepo.UpdateName(user, profileDto.Name) == false {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot update profile"})
+		}
+
+		user.Name = profileDto.Name
+	}
+
+	if profileDto.Email != "" && profileDto.Email != user.Email {
+		if status, message := ac.requestEmailChange(user, profileDto); status != fiber.StatusOK {
+			return c.Status(status).JSON(fiber.Map{"message": message})
+		}
+	}
+
+	return c.JSON(user)
+}
+
+func (ac *AccountController) VerifyEmailChange(c *fiber.Ctx) error {
+	verificationData := ac.vrfRepo.GetVerificationByCode(c.Params("code"), models.PurposeEmailChange)
+
+	if verificationData == nil || time.Now().After(verificationData.ExpiresAt) {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	user := ac.userRepo.GetUserByPendingEmail(verificationData.Email)
+
+	if user == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	// The address could have been registered since the change was requested
+	if ac.userRepo.GetUserByEmail(verificationData.Email) != nil {
+		ac.userRepo.ClearPendingEmail(verificationData.Email)
+		ac.vrfRepo.DeleteVerification(verificationData.Id)
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "This email address is already taken"})
+	}
+
+	previousEmail := user.Email
+
+	if ac.userRepo.ConfirmEmailChange(user) == false {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	ac.vrfRepo.DeleteVerification(verificationData.Id)
+	audit.Record(c, ac.events, ac.logger, events.AuditRecordedV1{ActorId: user.Id, Action: audit.UserEmailChange,
+		Resource: "user:" + strconv.Itoa(int(user.Id)), Result: audit.ResultSuccess,
+		Details: "previous email " + previousEmail})
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// SearchUsers looks up users to share with. Only the id, name and email of active users are returned, and short
+// queries are rejected, so the endpoint cannot be used to list all users.
+func (ac *AccountController) SearchUsers(c *fiber.Ctx) error {
+	if user, status := ac.auth.getUserFromJwt(c); user == nil {
+		return c.SendStatus(status)
+	}
+
+	query := strings.TrimSpace(c.Query("query"))
+
+	if len(query) < 3 || len(query) > 48 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Query must have 3 to 48 characters"})
+	}
+
+	users := ac.userRepo.SearchDirectory(query, 10)
+
+	if users == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot search users"})
+	}
+
+	results := make([]dtos.UserSearchResultDto, 0, len(users))
+
+	for _, user := range users {
+		results = append(results, dtos.UserSearchResultDto{Id: user.Id, Name: user.Name, Email: user.Email})
+	}
+
+	return c.JSON(results)
+}
+
+func (ac *AccountController) requestEmailChange(user *models.User, profileDto *dtos.UpdateProfileDto) (int, string) {
+	// Accounts created through the identity provider have no password to confirm
+	if len(user.Password) != 0 &&
+		bcrypt.CompareHashAndPassword(user.Password, []byte(profileDto.CurrentPassword)) != nil {
+		return fiber.StatusBadRequest, "Incorrect password"
+	}
+
+	if ac.userRepo.GetUserByEmail(profileDto.Email) != nil {
+		return fiber.StatusConflict, "This email address is already taken"
+	}
+
+	// Only the latest requested address can be confirmed
+	if user.PendingEmail != "" &&
+		ac.vrfRepo.DeleteVerificationsByEmail(user.PendingEmail, models.PurposeEmailChange) == false {
+		return fiber.StatusInternalServerError, "Cannot change email address"
+	}
+
+	if ac.vrfRepo.DeleteVerificationsByEmail(profileDto.Email, models.PurposeEmailChange) == false {
+		return fiber.StatusInternalServerError, "Cannot change email address"
+	}
+
+	if ac.userRepo.ClearPendingEmail(profileDto.Email) == false ||
+		ac.userRepo.SetPendingEmail(user, profileDto.Email) == false {
+		return fiber.StatusInternalServerError, "Cannot change email address"
+	}
+
+	user.PendingEmail = profileDto.Email
+
+	verificationData := ac.vrfRepo.CreateAndReturnVerificationData(profileDto.Email, models.PurposeEmailChange,
+		time.Hour*1)
+
+	if verificationData == nil {
+		return fiber.StatusInternalServerError, "Cannot change email address"
+	}
+
+	if err := ac.emailSrv.SendEmailChangeMail(user.Name, profileDto.Email, verificationData.Code); err != nil {
+		ac.logger.Error("Cannot send email change mail", zap.Error(err))
+		ac.vrfRepo.DeleteVerification(verificationData.Id)
+		return fiber.StatusInternalServerError, "Cannot send verification mail on the given email address"
+	}
+
+	return fiber.StatusOK, ""
+}
+
+// updatePassword stores the new password and revokes all sessions, so the user has to log in again everywhere.
+func (ac *AccountController) updatePassword(user *models.User, newPassword string) bool {
+	password, err := bcrypt.GenerateFromPassword([]byte(newPassword), 14)
+
+	if err != nil {
+		ac.logger.Error("Cannot hash password", zap.Error(err))
+		return false
+	}
+
+	if ac.userRepo.UpdatePassword(user, password) == false {
+		return false
+	}
+
+	return ac.sessRepo.RevokeUserSessions(user.Id)
+}
+
+// generateCryptKey returns a new file encryption key wrapped with the master key.
+func generateCryptKey(keySrv *masterkey.KeyService) (string, error) {
+	key := make([]byte, 32)
+
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+
+	return keySrv.WrapKey(base64.StdEncoding.EncodeToString(key))
+}
@@ -0,0 +1,201 @@
+package controllers
+
+import (
+	"dfs/auth/database"
+	"dfs/auth/dtos"
+	"dfs/auth/models"
+	"dfs/auth/services"
+	"dfs/common/audit"
+	"dfs/common/events"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type AdminController struct {
+	auth     *Authenticator
+	logger   *zap.Logger
+	userRepo *database.UserRepository
+	sessRepo *database.SessionRepository
+	rpc      *services.RpcClient
+	delSrv   *services.AccountDeletionService
+	events   *events.Bus
+}
+
+func NewAdminController(auth *Authenticator, logger *zap.Logger, usrRepo *database.UserRepository,
+	sessRepo *database.SessionRepository, rpcClient *services.RpcClient, delSrv *services.AccountDeletionService,
+	bus *events.Bus) *AdminController {
+	return &AdminController{auth: auth, logger: logger, userRepo: usrRepo, sessRepo: sessRepo, rpc: rpcClient,
+		delSrv: delSrv, events: bus}
+}
+
+func (adc *AdminController) RegisterRoutes(app *fiber.App) {
+	app.Get("/api/admin/users", adc.GetUsers)
+	app.Get("/api/admin/users/:id", adc.GetUser)
+	app.Post("/api/admin/users/:id/disable", adc.DisableUser)
+	app.Post("/api/admin/users/:id/enable", adc.EnableUser)
+	app.Delete("/api/admin/users/:id", adc.DeleteUser)
+}
+
+func (adc *AdminController) GetUsers(c *fiber.Ctx) error {
+	if admin, status := adc.auth.getAdminFromJwt(c); admin == nil {
+		return c.SendStatus(status)
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	pageSize, sizeErr := strconv.Atoi(c.Query("pageSize", "50"))
+
+	if err != nil || sizeErr != nil || page < 1 || pageSize < 1 || pageSize > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid page"})
+	}
+
+	users, total, ok := adc.userRepo.SearchUsers(c.Query("search"), (page-1)*pageSize, pageSize)
+
+	if ok == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot get users"})
+	}
+
+	userDtos := make([]dtos.AdminUserDto, 0, len(users))
+
+	for i := range users {
+		userDtos = append(userDtos, createAdminUserDto(&users[i]))
+	}
+
+	return c.JSON(dtos.AdminUserListDto{Users: userDtos, Total: total, Page: page, PageSize: pageSize})
+}
+
+func (adc *AdminController) GetUser(c *fiber.Ctx) error {
+	if admin, status := adc.auth.getAdminFromJwt(c); admin == nil {
+		return c.SendStatus(status)
+	}
+
+	user, status := adc.getUserFromParams(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	// Storage usage is informational, the user is returned even if the storage cannot be reached
+	usage, err := adc.rpc.GetStorageUsage(c.UserContext(), user.HomeDirectory)
+
+	if err != nil {
+		adc.logger.Warn("Cannot get storage usage", zap.Uint("UserId", user.Id), zap.Error(err))
+	}
+
+	return c.JSON(dtos.AdminUserDetailsDto{User: createAdminUserDto(user), Storage: usage})
+}
+
+func (adc *AdminController) DisableUser(c *fiber.Ctx) error {
+	admin, status := adc.auth.getAdminFromJwt(c)
+
+	if admin == nil {
+		return c.SendStatus(status)
+	}
+
+	defer audit.Record(c, adc.events, adc.logger, events.AuditRecordedV1{ActorId: admin.Id,
+		Action: audit.AdminUserDisable, Resource: "user:" + c.Params("id")})
+
+	user, status := adc.getUserFromParams(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	if user.Id == admin.Id {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "You cannot disable your own account"})
+	}
+
+	if adc.userRepo.SetDisabled(user, true) == false || adc.sessRepo.RevokeUserSessions(user.Id) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot disable user"})
+	}
+
+	return c.JSON(createAdminUserDto(user))
+}
+
+func (adc *AdminController) EnableUser(c *fiber.Ctx) error {
+	admin, status := adc.auth.getAdminFromJwt(c)
+
+	if admin == nil {
+		return c.SendStatus(status)
+	}
+
+	defer audit.Record(c, adc.events, adc.logger, events.AuditRecordedV1{ActorId: admin.Id,
+		Action: audit.AdminUserEnable, Resource: "user:" + c.Params("id")})
+
+	user, status := adc.getUserFromParams(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	if adc.userRepo.SetDisabled(user, false) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot enable user"})
+	}
+
+	return c.JSON(createAdminUserDto(user))
+}
+
+// DeleteUser removes the account synchronously, so the administrator sees right away whether it succeeded. A failed
+// deletion is retried by calling the endpoint again.
+func (adc *AdminController) DeleteUser(c *fiber.Ctx) error {
+	admin, status := adc.auth.getAdminFromJwt(c)
+
+	if admin == nil {
+		return c.SendStatus(status)
+	}
+
+	defer audit.Record(c, adc.events, adc.logger, events.AuditRecordedV1{ActorId: admin.Id,
+		Action: audit.AdminUserDelete, Resource: "user:" + c.Params("id")})
+
+	user, status := adc.getUserFromParams(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	if user.Id == admin.Id {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "You cannot delete your own account"})
+	}
+
+	// The user must not create new data while it is being deleted
+	if adc.userRepo.SetDisabled(user, true) == false || adc.sessRepo.RevokeUserSessions(user.Id) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot delete user"})
+	}
+
+	if adc.delSrv.DeleteAccount(c.UserContext(), user) == false {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Cannot delete user, try again"})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (adc *AdminController) getUserFromParams(c *fiber.Ctx) (*models.User, int) {
+	userId, err := c.ParamsInt("id")
+
+	if err != nil || userId <= 0 {
+		return nil, fiber.StatusBadRequest
+	}
+
+	user := adc.userRepo.GetUserById(uint(userId))
+
+	if user == nil {
+		return nil, fiber.StatusNotFound
+	}
+
+	return user, fiber.StatusOK
+}
+
+func createAdminUserDto(user *models.User) dtos.AdminUserDto {
+	return dtos.AdminUserDto{
+		Id:            user.Id,
+		Name:          user.Name,
+		Email:         user.Email,
+		Verified:      user.Verified,
+		HomeDirectory: user.HomeDirectory,
+		Role:          user.Role,
+		Disabled:      user.Disabled,
+		TotpEnabled:   user.TotpEnabled,
+		OidcLinked:    user.OidcSubject != "",
+	}
+}
@@ -0,0 +1,103 @@
+package controllers
+
+import (
+	"dfs/auth/database"
+	"dfs/auth/dtos"
+	"dfs/auth/services"
+	"dfs/auth/validation"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type ApiTokenController struct {
+	auth   *Authenticator
+	logger *zap.Logger
+	atRepo *database.ApiTokenRepository
+	tokens *services.TokenService
+}
+
+func NewApiTokenController(auth *Authenticator, logger *zap.Logger, atRepo *database.ApiTokenRepository,
+	tokens *services.TokenService) *ApiTokenController {
+	return &ApiTokenController{auth: auth, logger: logger, atRepo: atRepo, tokens: tokens}
+}
+
+func (atc *ApiTokenController) RegisterRoutes(app *fiber.App) {
+	app.Get("/api/user/tokens", atc.GetApiTokens)
+	app.Post("/api/user/tokens", atc.CreateApiToken)
+	app.Delete("/api/user/tokens/:id", atc.RevokeApiToken)
+}
+
+func (atc *ApiTokenController) GetApiTokens(c *fiber.Ctx) error {
+	user, status := atc.auth.getUserFromJwt(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	tokens := atc.atRepo.GetUserApiTokens(user.Id)
+
+	if tokens == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot get API tokens"})
+	}
+
+	return c.JSON(tokens)
+}
+
+func (atc *ApiTokenController) CreateApiToken(c *fiber.Ctx) error {
+	user, status := atc.auth.getUserFromSession(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	tokenDto := new(dtos.CreateApiTokenDto)
+
+	if err := c.BodyParser(&tokenDto); err != nil {
+		atc.logger.Warn("Cannot parse API token data", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	if errors := validation.Validate(tokenDto); errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	apiToken, apiTokenHash, err := atc.tokens.CreateApiToken()
+
+	if err != nil {
+		atc.logger.Error("Cannot create API token", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot create API token"})
+	}
+
+	token := atc.atRepo.CreateApiToken(user.Id, tokenDto.Name, apiTokenHash, strings.Join(tokenDto.Scopes, " "),
+		time.Now().AddDate(0, 0, tokenDto.ExpiresInDays))
+
+	if token == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot create API token"})
+	}
+
+	// The token itself is not stored, so it can be shown only once
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{"token": apiToken, "apiToken": token})
+}
+
+func (atc *ApiTokenController) RevokeApiToken(c *fiber.Ctx) error {
+	user, status := atc.auth.getUserFromSession(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	tokenId, err := c.ParamsInt("id")
+
+	if err != nil || tokenId <= 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	if atc.atRepo.RevokeApiToken(uint(tokenId), user.Id) == false {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
@@ -0,0 +1,207 @@
+package controllers
+
+import (
+	"dfs/auth/config"
+	"dfs/auth/database"
+	"dfs/auth/models"
+	"dfs/auth/services"
+	"dfs/common/middleware"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// Authenticator finds the user of a request and sets the session cookies, for all controllers of the service.
+type Authenticator struct {
+	logger   *zap.Logger
+	userRepo *database.UserRepository
+	sessRepo *database.SessionRepository
+	atRepo   *database.ApiTokenRepository
+	tokens   *services.TokenService
+	cfg      *config.Config
+}
+
+func NewAuthenticator(logger *zap.Logger, usrRepo *database.UserRepository, sessRepo *database.SessionRepository,
+	atRepo *database.ApiTokenRepository, tokens *services.TokenService, cfg *config.Config) *Authenticator {
+	return &Authenticator{logger: logger, userRepo: usrRepo, sessRepo: sessRepo, atRepo: atRepo, tokens: tokens,
+		cfg: cfg}
+}
+
+// getUserFromJwt returns the user of the session or of an API token with the "auth" scope.
+func (au *Authenticator) getUserFromJwt(c *fiber.Ctx) (*models.User, int) {
+	user, status := au.authenticate(c, true)
+
+	if user == nil {
+		return nil, status
+	}
+
+	if user.Disabled {
+		return nil, fiber.StatusForbidden
+	}
+
+	return user, fiber.StatusOK
+}
+
+// getUserFromSession returns the user of the session only, for the routes an API token must not reach, like creating
+// more tokens.
+func (au *Authenticator) getUserFromSession(c *fiber.Ctx) (*models.User, int) {
+	user, status := au.authenticate(c, false)
+
+	if user == nil {
+		return nil, status
+	}
+
+	if user.Disabled {
+		return nil, fiber.StatusForbidden
+	}
+
+	return user, fiber.StatusOK
+}
+
+// getEnrollingUserFromJwt returns the user of the session also while a required second factor is not enrolled, for
+// the routes that enroll it or end the session.
+func (au *Authenticator) getEnrollingUserFromJwt(c *fiber.Ctx) (*models.User, int) {
+	user, status := au.authenticateSession(c)
+
+	if user == nil {
+		return nil, status
+	}
+
+	if user.Disabled {
+		return nil, fiber.StatusForbidden
+	}
+
+	return user, fiber.StatusOK
+}
+
+// getAdminFromJwt accepts only the session, API tokens cannot manage other accounts.
+func (au *Authenticator) getAdminFromJwt(c *fiber.Ctx) (*models.User, int) {
+	user, status := au.getUserFromSession(c)
+
+	if user == nil {
+		return nil, status
+	}
+
+	if user.Role != models.RoleAdmin {
+		return nil, fiber.StatusForbidden
+	}
+
+	return user, fiber.StatusOK
+}
+
+// authenticate returns the user of the session, or of the API token when allowed, even if the account is disabled.
+// Users who have to enroll two-factor authentication first get 403.
+func (au *Authenticator) authenticate(c *fiber.Ctx, allowApiToken bool) (*models.User, int) {
+	var user *models.User
+	var status int
+
+	if apiToken := middleware.BearerToken(c); allowApiToken && apiToken != "" {
+		user, status = au.authenticateApiToken(c, apiToken)
+	} else {
+		user, status = au.authenticateSession(c)
+	}
+
+	if user == nil {
+		return nil, status
+	}
+
+	if au.cfg.RequireTwoFactor && user.TotpEnabled == false {
+		return nil, fiber.StatusForbidden
+	}
+
+	return user, fiber.StatusOK
+}
+
+// authenticateApiToken accepts the token with the same scope check as the other services, for the "auth" scope.
+func (au *Authenticator) authenticateApiToken(c *fiber.Ctx, rawToken string) (*models.User, int) {
+	apiToken := au.atRepo.GetActiveApiToken(au.tokens.HashApiToken(rawToken))
+
+	if apiToken == nil {
+		return nil, fiber.StatusUnauthorized
+	}
+
+	if services.ApiTokenAllows(apiToken, "auth", middleware.ReadOnlyRequest(c)) == false {
+		return nil, fiber.StatusForbidden
+	}
+
+	user := au.userRepo.GetUserById(apiToken.UserId)
+
+	if user == nil {
+		return nil, fiber.StatusUnauthorized
+	}
+
+	// Recording every request would mean a write per call, a minute is precise enough
+	if time.Since(apiToken.LastUsedAt) > time.Minute {
+		au.atRepo.UpdateLastUsed(apiToken)
+	}
+
+	return user, fiber.StatusOK
+}
+
+func (au *Authenticator) authenticateSession(c *fiber.Ctx) (*models.User, int) {
+	cookie := c.Cookies("jwt")
+
+	accessToken, err := au.tokens.ParseToken(cookie)
+
+	if err != nil {
+		au.logger.Error("Cannot parse JWT claims", zap.Error(err))
+		return nil, fiber.StatusUnauthorized
+	}
+
+	if au.sessRepo.IsSessionActive(accessToken.SessionId, accessToken.UserId) == false {
+		return nil, fiber.StatusUnauthorized
+	}
+
+	user := au.userRepo.GetUserById(accessToken.UserId)
+
+	if user == nil {
+		return nil, fiber.StatusUnauthorized
+	}
+
+	return user, fiber.StatusOK
+}
+
+func (au *Authenticator) setTokenCookies(c *fiber.Ctx, session *models.Session, refreshToken string) bool {
+	expiresAt := time.Now().Add(au.cfg.AccessTokenTtl)
+	token, err := au.tokens.CreateToken(session.UserId, session.Id, expiresAt)
+
+	if err != nil {
+		au.logger.Error("Cannot create access token", zap.Uint("SessionId", session.Id), zap.Error(err))
+		return false
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    token,
+		Expires:  expiresAt,
+		HTTPOnly: true,
+	})
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    refreshToken,
+		Path:     "/api",
+		Expires:  time.Now().Add(au.cfg.RefreshTokenTtl),
+		HTTPOnly: true,
+	})
+
+	return true
+}
+
+func (au *Authenticator) clearTokenCookies(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "jwt",
+		Value:    "",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+	})
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "refresh_token",
+		Value:    "",
+		Path:     "/api",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+	})
+}
@@ -0,0 +1,114 @@
+package controllers
+
+import (
+	"dfs/auth/database"
+	"dfs/auth/dtos"
+	"dfs/auth/models"
+	"dfs/auth/services"
+	"dfs/common/audit"
+	"dfs/common/events"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+const deadLetterPreviewSize = 256
+
+type DeadLetterController struct {
+	auth   *Authenticator
+	logger *zap.Logger
+	dlRepo *database.DeadLetterRepository
+	dlSrv  *services.DeadLetterService
+	events *events.Bus
+}
+
+func NewDeadLetterController(auth *Authenticator, logger *zap.Logger, dlRepo *database.DeadLetterRepository,
+	dlSrv *services.DeadLetterService, bus *events.Bus) *DeadLetterController {
+	return &DeadLetterController{auth: auth, logger: logger, dlRepo: dlRepo, dlSrv: dlSrv, events: bus}
+}
+
+func (dlc *DeadLetterController) RegisterRoutes(app *fiber.App) {
+	app.Get("/api/admin/dead-letters", dlc.GetDeadLetters)
+	app.Post("/api/admin/dead-letters/:id/replay", dlc.ReplayDeadLetter)
+}
+
+func (dlc *DeadLetterController) GetDeadLetters(c *fiber.Ctx) error {
+	if admin, status := dlc.auth.getAdminFromJwt(c); admin == nil {
+		return c.SendStatus(status)
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	pageSize, sizeErr := strconv.Atoi(c.Query("pageSize", "50"))
+
+	if err != nil || sizeErr != nil || page < 1 || pageSize < 1 || pageSize > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid page"})
+	}
+
+	deadLetters, total, ok := dlc.dlRepo.GetDeadLetters(c.Query("queue"), (page-1)*pageSize, pageSize)
+
+	if ok == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot get dead letters"})
+	}
+
+	deadLetterDtos := make([]dtos.DeadLetterDto, 0, len(deadLetters))
+
+	for i := range deadLetters {
+		deadLetterDtos = append(deadLetterDtos, createDeadLetterDto(&deadLetters[i]))
+	}
+
+	return c.JSON(dtos.DeadLetterListDto{DeadLetters: deadLetterDtos, Total: total, Page: page, PageSize: pageSize})
+}
+
+// ReplayDeadLetter sends the message to its original queue again. A message can be replayed more than once, e.g.
+// when it failed again after the first replay.
+func (dlc *DeadLetterController) ReplayDeadLetter(c *fiber.Ctx) error {
+	admin, status := dlc.auth.getAdminFromJwt(c)
+
+	if admin == nil {
+		return c.SendStatus(status)
+	}
+
+	defer audit.Record(c, dlc.events, dlc.logger, events.AuditRecordedV1{ActorId: admin.Id,
+		Action: audit.AdminDeadLetterReplay, Resource: "dead_letter:" + c.Params("id")})
+
+	deadLetterId, err := c.ParamsInt("id")
+
+	if err != nil || deadLetterId <= 0 {
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	deadLetter := dlc.dlRepo.GetDeadLetterById(uint(deadLetterId))
+
+	if deadLetter == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	if dlc.dlSrv.Replay(c.UserContext(), deadLetter) == false {
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Cannot replay dead letter, try again"})
+	}
+
+	return c.JSON(createDeadLetterDto(deadLetter))
+}
+
+// createDeadLetterDto shows only the beginning of the body, which is enough to identify the message and does not
+// blow up the list with large payloads.
+func createDeadLetterDto(deadLetter *models.DeadLetter) dtos.DeadLetterDto {
+	preview := deadLetter.Body
+
+	if len(preview) > deadLetterPreviewSize {
+		preview = preview[:deadLetterPreviewSize]
+	}
+
+	return dtos.DeadLetterDto{
+		Id:             deadLetter.Id,
+		Queue:          deadLetter.Queue,
+		ContentType:    deadLetter.ContentType,
+		Size:           len(deadLetter.Body),
+		Preview:        string(preview),
+		Error:          deadLetter.Error,
+		Retries:        deadLetter.Retries,
+		DeadLetteredAt: deadLetter.DeadLetteredAt,
+		ReplayedAt:     deadLetter.ReplayedAt,
+	}
+}
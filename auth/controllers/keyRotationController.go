@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"dfs/auth/database"
+	"dfs/auth/models"
+	"dfs/auth/services"
+	"dfs/common/masterkey"
+	"encoding/base64"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type KeyRotationController struct {
+	auth    *Authenticator
+	logger  *zap.Logger
+	rotRepo *database.KeyRotationRepository
+	rotSrv  *services.KeyRotationService
+	keySrv  *masterkey.KeyService
+}
+
+func NewKeyRotationController(auth *Authenticator, logger *zap.Logger, rotRepo *database.KeyRotationRepository,
+	rotSrv *services.KeyRotationService, keySrv *masterkey.KeyService) *KeyRotationController {
+	return &KeyRotationController{auth: auth, logger: logger, rotRepo: rotRepo, rotSrv: rotSrv, keySrv: keySrv}
+}
+
+func (krc *KeyRotationController) RegisterRoutes(app *fiber.App) {
+	app.Post("/api/user/key/rotate", krc.RotateKey)
+	app.Get("/api/user/key/rotation", krc.GetKeyRotation)
+}
+
+func (krc *KeyRotationController) RotateKey(c *fiber.Ctx) error {
+	user, status := krc.auth.getUserFromJwt(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	latestRotation := krc.rotRepo.GetLatestKeyRotation(user.Id)
+
+	if latestRotation != nil {
+		switch latestRotation.Status {
+		case models.RotationInProgress:
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Key rotation is already in progress"})
+		case models.RotationFailed:
+			if krc.rotRepo.UpdateKeyRotationStatus(latestRotation, models.RotationInProgress) == false {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot resume key rotation"})
+			}
+
+			krc.rotSrv.Start(latestRotation.Id)
+
+			return c.Status(fiber.StatusAccepted).JSON(latestRotation)
+		}
+	}
+
+	key := make([]byte, 32)
+
+	if _, err := rand.Read(key); err != nil {
+		krc.logger.Error("Cannot generate encryption key", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot rotate key"})
+	}
+
+	wrappedKey, err := krc.keySrv.WrapKey(base64.StdEncoding.EncodeToString(key))
+
+	if err != nil {
+		krc.logger.Error("Cannot wrap encryption key", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot rotate key"})
+	}
+
+	rotation, err := krc.rotRepo.CreateKeyRotation(user, wrappedKey)
+
+	if err == database.ErrKeyRotationConflict {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Key rotation is already in progress"})
+	} else if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot rotate key"})
+	}
+
+	krc.rotSrv.Start(rotation.Id)
+
+	return c.Status(fiber.StatusAccepted).JSON(rotation)
+}
+
+func (krc *KeyRotationController) GetKeyRotation(c *fiber.Ctx) error {
+	user, status := krc.auth.getUserFromJwt(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	rotation := krc.rotRepo.GetLatestKeyRotation(user.Id)
+
+	if rotation == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	return c.JSON(rotation)
+}
@@ -0,0 +1,603 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"dfs/auth/config"
+	"dfs/auth/database"
+	"dfs/auth/dtos"
+	"dfs/auth/models"
+	"dfs/auth/services"
+	"dfs/auth/validation"
+	"dfs/common/masterkey"
+	"dfs/common/middleware"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type SessionController struct {
+	auth     *Authenticator
+	logger   *zap.Logger
+	userRepo *database.UserRepository
+	sessRepo *database.SessionRepository
+	rcRepo   *database.RecoveryCodeRepository
+	rpc      *services.RpcClient
+	keySrv   *masterkey.KeyService
+	tokens   *services.TokenService
+	totp     *services.TotpService
+	guard    *services.LoginGuardService
+	oidc     *services.OidcService
+	limiter  fiber.Handler
+	cfg      *config.Config
+}
+
+func NewSessionController(auth *Authenticator, logger *zap.Logger, usrRepo *database.UserRepository,
+	sessRepo *database.SessionRepository, rcRepo *database.RecoveryCodeRepository, rpcClient *services.RpcClient,
+	keySrv *masterkey.KeyService, tokens *services.TokenService, totp *services.TotpService,
+	guard *services.LoginGuardService, oidc *services.OidcService, limiter fiber.Handler,
+	cfg *config.Config) *SessionController {
+	return &SessionController{auth: auth, logger: logger, userRepo: usrRepo, sessRepo: sessRepo, rcRepo: rcRepo,
+		rpc: rpcClient, keySrv: keySrv, tokens: tokens, totp: totp, guard: guard, oidc: oidc, limiter: limiter,
+		cfg: cfg}
+}
+
+func (sc *SessionController) RegisterRoutes(app *fiber.App) {
+	app.Post("/api/login", sc.limiter, sc.Login)
+	app.Post("/api/login/2fa", sc.limiter, sc.LoginTwoFactor)
+	app.Get("/api/oidc/login", sc.limiter, sc.OidcLogin)
+	app.Get("/api/oidc/callback", sc.limiter, sc.OidcCallback)
+	app.Post("/api/refresh", sc.Refresh)
+	app.Post("/api/logout", sc.Logout)
+	app.Post("/api/logout/all", sc.LogoutAll)
+	app.Post("/api/user/2fa/enroll", sc.EnrollTwoFactor)
+	app.Post("/api/user/2fa/confirm", sc.ConfirmTwoFactor)
+	app.Post("/api/user/2fa/disable", sc.DisableTwoFactor)
+	app.Post("/api/user/2fa/recovery-codes", sc.RegenerateRecoveryCodes)
+	app.Get("/.well-known/jwks.json", sc.Jwks)
+}
+
+func (sc *SessionController) Login(c *fiber.Ctx) error {
+	loginDto := new(dtos.LoginDto)
+
+	if err := c.BodyParser(&loginDto); err != nil {
+		sc.logger.Warn("Cannot parse login data.", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	errors := validation.Validate(loginDto)
+
+	if errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	if retryAfter, allowed := sc.guard.Check(middleware.ClientIp(c), loginDto.Email); allowed == false {
+		return sc.tooManyLoginAttempts(c, retryAfter)
+	}
+
+	user := sc.userRepo.GetUserByEmail(loginDto.Email)
+
+	if user == nil {
+		sc.guard.RegisterFailure(c.UserContext(), middleware.ClientIp(c), loginDto.Email, 0)
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Incorrect login or password",
+		})
+	}
+
+	if user.Verified == false {
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "You have to verify your email address",
+		})
+	}
+
+	if err := bcrypt.CompareHashAndPassword(user.Password, []byte(loginDto.Password)); err != nil {
+		sc.guard.RegisterFailure(c.UserContext(), middleware.ClientIp(c), user.Email, user.Id)
+		c.Status(fiber.StatusBadRequest)
+		return c.JSON(fiber.Map{
+			"message": "Incorrect login or password",
+		})
+	}
+
+	if user.TotpEnabled {
+		return sc.requireSecondFactor(c, user)
+	}
+
+	sc.guard.RegisterSuccess(user.Email)
+
+	return sc.startSession(c, user)
+}
+
+func (sc *SessionController) LoginTwoFactor(c *fiber.Ctx) error {
+	loginDto := new(dtos.TwoFactorLoginDto)
+
+	if err := c.BodyParser(&loginDto); err != nil {
+		sc.logger.Warn("Cannot parse two-factor login data", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	errors := validation.Validate(loginDto)
+
+	if errors != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(errors)
+	}
+
+	if loginDto.Code == "" && loginDto.RecoveryCode == "" {
+		return c.Status(fiber.StatusBadRequest).JSON([]string{"Code", "RecoveryCode"})
+	}
+
+	userId, err := sc.tokens.ParsePendingToken(loginDto.PendingToken)
+
+	if err != nil {
+		sc.logger.Warn("Cannot parse pending login token", zap.Error(err))
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	user := sc.userRepo.GetUserById(userId)
+
+	if user == nil || user.TotpEnabled == false {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if retryAfter, allowed := sc.guard.Check(middleware.ClientIp(c), user.Email); allowed == false {
+		return sc.tooManyLoginAttempts(c, retryAfter)
+	}
+
+	var verified bool
+
+	if loginDto.Code != "" {
+		verified = sc.verifyTotpCode(user, loginDto.Code)
+	} else {
+		verified = sc.rcRepo.UseRecoveryCode(user.Id, sc.totp.HashRecoveryCode(loginDto.RecoveryCode))
+	}
+
+	if verified == false {
+		sc.guard.RegisterFailure(c.UserContext(), middleware.ClientIp(c), user.Email, user.Id)
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Invalid two-factor code"})
+	}
+
+	sc.guard.RegisterSuccess(user.Email)
+
+	return sc.startSession(c, user)
+}
+
+func (sc *SessionController) OidcLogin(c *fiber.Ctx) error {
+	if sc.oidc.Enabled() == false {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	loginState, err := sc.oidc.NewLoginState()
+
+	if err != nil {
+		sc.logger.Error("Cannot create OIDC login state", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Could not login"})
+	}
+
+	authCodeUrl, err := sc.oidc.AuthCodeUrl(loginState)
+
+	if err != nil {
+		sc.logger.Error("Cannot create OIDC authorization URL", zap.Error(err))
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Identity provider is not available"})
+	}
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "oidc_state",
+		Value:    strings.Join([]string{loginState.State, loginState.Nonce, loginState.CodeVerifier}, "."),
+		Path:     "/api/oidc",
+		Expires:  time.Now().Add(time.Minute * 10),
+		HTTPOnly: true,
+		SameSite: "Lax",
+	})
+
+	return c.Redirect(authCodeUrl)
+}
+
+func (sc *SessionController) OidcCallback(c *fiber.Ctx) error {
+	if sc.oidc.Enabled() == false {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	stateParts := strings.Split(c.Cookies("oidc_state"), ".")
+
+	c.Cookie(&fiber.Cookie{
+		Name:     "oidc_state",
+		Value:    "",
+		Path:     "/api/oidc",
+		Expires:  time.Now().Add(-time.Hour),
+		HTTPOnly: true,
+	})
+
+	if providerError := c.Query("error"); providerError != "" {
+		sc.logger.Warn("Identity provider rejected login", zap.String("Error", providerError))
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Could not login"})
+	}
+
+	if len(stateParts) != 3 || subtle.ConstantTimeCompare([]byte(stateParts[0]), []byte(c.Query("state"))) != 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid login state"})
+	}
+
+	identity, err := sc.oidc.Exchange(c.Query("code"), &services.OidcLoginState{
+		State:        stateParts[0],
+		Nonce:        stateParts[1],
+		CodeVerifier: stateParts[2],
+	})
+
+	if err != nil {
+		sc.logger.Warn("Cannot complete OIDC login", zap.Error(err))
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "Could not login"})
+	}
+
+	user, status, message := sc.getOidcUser(c.UserContext(), identity)
+
+	if user == nil {
+		return c.Status(status).JSON(fiber.Map{"message": message})
+	}
+
+	if user.TotpEnabled {
+		return sc.requireSecondFactor(c, user)
+	}
+
+	return sc.startSession(c, user)
+}
+
+func (sc *SessionController) Refresh(c *fiber.Ctx) error {
+	refreshTokenHash := sc.tokens.HashRefreshToken(c.Cookies("refresh_token"))
+
+	session := sc.sessRepo.GetSessionByRefreshTokenHash(refreshTokenHash)
+
+	if session == nil {
+		if reusedSession := sc.sessRepo.GetSessionByPreviousRefreshTokenHash(refreshTokenHash); reusedSession != nil {
+			sc.logger.Warn("Refresh token reuse detected, revoking session",
+				zap.Uint("SessionId", reusedSession.Id), zap.Uint("UserId", reusedSession.UserId))
+			sc.sessRepo.RevokeSession(reusedSession.Id)
+		}
+
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if session.Revoked || session.ExpiresAt.Before(time.Now()) {
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	refreshToken, newRefreshTokenHash, err := sc.tokens.CreateRefreshToken()
+
+	if err != nil {
+		sc.logger.Error("Cannot create refresh token", zap.Error(err))
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	// Another refresh with the same token won the race, which is handled like a reused token
+	if sc.sessRepo.RotateRefreshToken(session, newRefreshTokenHash, time.Now().Add(sc.cfg.RefreshTokenTtl)) == false {
+		sc.logger.Warn("Refresh token reuse detected, revoking session",
+			zap.Uint("SessionId", session.Id), zap.Uint("UserId", session.UserId))
+		sc.sessRepo.RevokeSession(session.Id)
+
+		return c.SendStatus(fiber.StatusUnauthorized)
+	}
+
+	if sc.auth.setTokenCookies(c, session, refreshToken) == false {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (sc *SessionController) Logout(c *fiber.Ctx) error {
+	refreshTokenHash := sc.tokens.HashRefreshToken(c.Cookies("refresh_token"))
+
+	if session := sc.sessRepo.GetSessionByRefreshTokenHash(refreshTokenHash); session != nil {
+		sc.sessRepo.RevokeSession(session.Id)
+	} else if accessToken, err := sc.tokens.ParseToken(c.Cookies("jwt")); err == nil {
+		sc.sessRepo.RevokeSession(accessToken.SessionId)
+	}
+
+	sc.auth.clearTokenCookies(c)
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (sc *SessionController) LogoutAll(c *fiber.Ctx) error {
+	user, status := sc.auth.getEnrollingUserFromJwt(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	if sc.sessRepo.RevokeUserSessions(user.Id) == false {
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	sc.auth.clearTokenCookies(c)
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (sc *SessionController) EnrollTwoFactor(c *fiber.Ctx) error {
+	user, status := sc.auth.getEnrollingUserFromJwt(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	if user.TotpEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Two-factor authentication is already enabled"})
+	}
+
+	secret, err := sc.totp.GenerateSecret()
+
+	if err != nil {
+		sc.logger.Error("Cannot generate TOTP secret", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot enroll two-factor authentication"})
+	}
+
+	wrappedSecret, err := sc.keySrv.WrapKey(secret)
+
+	if err != nil {
+		sc.logger.Error("Cannot wrap TOTP secret", zap.Error(err))
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot enroll two-factor authentication"})
+	}
+
+	if sc.userRepo.SetTotpSecret(user, wrappedSecret) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot enroll two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{"secret": secret, "provisioningUri": sc.totp.ProvisioningUri(user.Email, secret)})
+}
+
+func (sc *SessionController) ConfirmTwoFactor(c *fiber.Ctx) error {
+	user, codeDto, status := sc.parseTwoFactorCode(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	if user.TotpEnabled {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "Two-factor authentication is already enabled"})
+	}
+
+	if user.TotpSecret == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Two-factor enrollment was not started"})
+	}
+
+	secret, err := sc.keySrv.UnwrapKey(user.TotpSecret)
+
+	if err != nil {
+		sc.logger.Error("Cannot unwrap TOTP secret", zap.Uint("UserId", user.Id), zap.Error(err))
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	counter, ok := sc.totp.ValidateCode(secret, codeDto.Code, user.TotpLastCounter)
+
+	if ok == false {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid two-factor code"})
+	}
+
+	recoveryCodes := sc.replaceRecoveryCodes(user)
+
+	if recoveryCodes == nil || sc.userRepo.EnableTotp(user, counter) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot enable two-factor authentication"})
+	}
+
+	return c.JSON(fiber.Map{"recoveryCodes": recoveryCodes})
+}
+
+func (sc *SessionController) DisableTwoFactor(c *fiber.Ctx) error {
+	user, codeDto, status := sc.parseTwoFactorCode(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	if sc.cfg.RequireTwoFactor {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Two-factor authentication is required"})
+	}
+
+	if user.TotpEnabled == false {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Two-factor authentication is not enabled"})
+	}
+
+	if sc.verifyTotpCode(user, codeDto.Code) == false {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid two-factor code"})
+	}
+
+	if sc.userRepo.DisableTotp(user) == false || sc.rcRepo.DeleteRecoveryCodes(user.Id) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Cannot disable two-factor authentication",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (sc *SessionController) RegenerateRecoveryCodes(c *fiber.Ctx) error {
+	user, codeDto, status := sc.parseTwoFactorCode(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	if user.TotpEnabled == false {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Two-factor authentication is not enabled"})
+	}
+
+	if sc.verifyTotpCode(user, codeDto.Code) == false {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid two-factor code"})
+	}
+
+	recoveryCodes := sc.replaceRecoveryCodes(user)
+
+	if recoveryCodes == nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot generate recovery codes"})
+	}
+
+	return c.JSON(fiber.Map{"recoveryCodes": recoveryCodes})
+}
+
+func (sc *SessionController) Jwks(c *fiber.Ctx) error {
+	return c.JSON(sc.tokens.Jwks())
+}
+
+func (sc *SessionController) startSession(c *fiber.Ctx, user *models.User) error {
+	if user.Disabled {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Your account is disabled"})
+	}
+
+	refreshToken, refreshTokenHash, err := sc.tokens.CreateRefreshToken()
+
+	if err != nil {
+		sc.logger.Error("Cannot create refresh token", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Could not login"})
+	}
+
+	session := sc.sessRepo.CreateSession(user.Id, refreshTokenHash, time.Now().Add(sc.cfg.RefreshTokenTtl))
+
+	if session == nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Could not login"})
+	}
+
+	if sc.auth.setTokenCookies(c, session, refreshToken) == false {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Could not login"})
+	}
+
+	if sc.cfg.RequireTwoFactor && user.TotpEnabled == false {
+		return c.JSON(fiber.Map{"twoFactorEnrollmentRequired": true})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// requireSecondFactor answers a login with a token that has to be exchanged at /api/login/2fa together with a code.
+func (sc *SessionController) requireSecondFactor(c *fiber.Ctx, user *models.User) error {
+	if user.Disabled {
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "Your account is disabled"})
+	}
+
+	pendingToken, err := sc.tokens.CreatePendingToken(user.Id, time.Now().Add(time.Minute*5))
+
+	if err != nil {
+		sc.logger.Error("Cannot create pending login token", zap.Error(err))
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Could not login"})
+	}
+
+	return c.JSON(fiber.Map{"twoFactorRequired": true, "pendingToken": pendingToken})
+}
+
+// getOidcUser returns the user linked to the identity. An account with the same email address is linked on the first
+// login, otherwise a new account is provisioned. Both require the provider to have verified the email address.
+func (sc *SessionController) getOidcUser(ctx context.Context,
+	identity *services.OidcIdentity) (*models.User, int, string) {
+	if user := sc.userRepo.GetUserByOidcSubject(identity.Subject); user != nil {
+		return user, fiber.StatusOK, ""
+	}
+
+	if identity.Email == "" || identity.EmailVerified == false {
+		return nil, fiber.StatusForbidden, "Identity provider did not confirm your email address"
+	}
+
+	if user := sc.userRepo.GetUserByEmail(identity.Email); user != nil {
+		if user.OidcSubject != "" {
+			return nil, fiber.StatusConflict, "This email address is linked to another identity"
+		}
+
+		if sc.userRepo.LinkOidcSubject(user, identity.Subject) == false {
+			return nil, fiber.StatusInternalServerError, "Could not login"
+		}
+
+		return user, fiber.StatusOK, ""
+	}
+
+	wrappedKey, err := generateCryptKey(sc.keySrv)
+
+	if err != nil {
+		sc.logger.Error("Cannot generate encryption key", zap.Error(err))
+		return nil, fiber.StatusInternalServerError, "Cannot create account"
+	}
+
+	if isCreated, err := sc.rpc.CreateHomeDirectory(ctx, identity.Email); isCreated == false {
+		sc.logger.Error("Cannot create home directory for user:", zap.String("User", identity.Email), zap.Error(err))
+		return nil, fiber.StatusInternalServerError, "Cannot create account"
+	}
+
+	name := identity.Name
+
+	if name == "" {
+		name = identity.Email
+	}
+
+	user := sc.userRepo.CreateOidcUser(name, identity.Email, identity.Subject, wrappedKey)
+
+	if user == nil {
+		sc.rpc.DeleteHomeDirectory(ctx, identity.Email)
+		return nil, fiber.StatusInternalServerError, "Cannot create account"
+	}
+
+	return user, fiber.StatusOK, ""
+}
+
+func (sc *SessionController) tooManyLoginAttempts(c *fiber.Ctx, retryAfter time.Duration) error {
+	c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+
+	return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+		"message": "Too many failed login attempts, try again later",
+	})
+}
+
+// parseTwoFactorCode accepts users who still have to enroll, disabling and new recovery codes need an enabled factor.
+func (sc *SessionController) parseTwoFactorCode(c *fiber.Ctx) (*models.User, *dtos.TwoFactorCodeDto, int) {
+	user, status := sc.auth.getEnrollingUserFromJwt(c)
+
+	if user == nil {
+		return nil, nil, status
+	}
+
+	codeDto := new(dtos.TwoFactorCodeDto)
+
+	if err := c.BodyParser(&codeDto); err != nil {
+		sc.logger.Warn("Cannot parse two-factor code", zap.Error(err))
+		return nil, nil, fiber.StatusBadRequest
+	}
+
+	if errors := validation.Validate(codeDto); errors != nil {
+		return nil, nil, fiber.StatusBadRequest
+	}
+
+	return user, codeDto, fiber.StatusOK
+}
+
+func (sc *SessionController) verifyTotpCode(user *models.User, code string) bool {
+	secret, err := sc.keySrv.UnwrapKey(user.TotpSecret)
+
+	if err != nil {
+		sc.logger.Error("Cannot unwrap TOTP secret", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	counter, ok := sc.totp.ValidateCode(secret, code, user.TotpLastCounter)
+
+	if ok == false {
+		return false
+	}
+
+	return sc.userRepo.UpdateTotpCounter(user, counter)
+}
+
+func (sc *SessionController) replaceRecoveryCodes(user *models.User) []string {
+	recoveryCodes, recoveryCodeHashes, err := sc.totp.GenerateRecoveryCodes()
+
+	if err != nil {
+		sc.logger.Error("Cannot generate recovery codes", zap.Error(err))
+		return nil
+	}
+
+	if sc.rcRepo.ReplaceRecoveryCodes(user.Id, recoveryCodeHashes) == false {
+		return nil
+	}
+
+	return recoveryCodes
+}
@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"bufio"
+	"context"
+	"dfs/auth/database"
+	"dfs/auth/dtos"
+	"dfs/auth/models"
+	"dfs/auth/services"
+	"dfs/common/audit"
+	"dfs/common/events"
+	"strconv"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// UserDataController deletes and exports the whole account of the user, including the data kept by other services.
+type UserDataController struct {
+	auth    *Authenticator
+	logger  *zap.Logger
+	delRepo *database.AccountDeletionRepository
+	delSrv  *services.AccountDeletionService
+	export  *services.ExportService
+	events  *events.Bus
+}
+
+func NewUserDataController(auth *Authenticator, logger *zap.Logger, delRepo *database.AccountDeletionRepository,
+	delSrv *services.AccountDeletionService, export *services.ExportService, bus *events.Bus) *UserDataController {
+	return &UserDataController{auth: auth, logger: logger, delRepo: delRepo, delSrv: delSrv, export: export,
+		events: bus}
+}
+
+func (udc *UserDataController) RegisterRoutes(app *fiber.App) {
+	app.Delete("/api/user", udc.DeleteAccount)
+	app.Get("/api/user/deletion/:id", udc.GetAccountDeletion)
+	app.Get("/api/user/export", udc.ExportUserData)
+}
+
+// DeleteAccount starts deleting the account in the background. Calling it again returns the running deletion or
+// retries a failed one.
+func (udc *UserDataController) DeleteAccount(c *fiber.Ctx) error {
+	user, status := udc.auth.authenticate(c, false)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	defer audit.Record(c, udc.events, udc.logger, events.AuditRecordedV1{ActorId: user.Id, Action: audit.UserDelete,
+		Resource: "user:" + strconv.Itoa(int(user.Id))})
+
+	deletion := udc.delRepo.GetAccountDeletionByUserId(user.Id)
+
+	if deletion == nil {
+		if user.Disabled {
+			return c.SendStatus(fiber.StatusForbidden)
+		}
+
+		deleteDto := new(dtos.DeleteAccountDto)
+
+		if err := c.BodyParser(&deleteDto); err != nil && len(c.Body()) != 0 {
+			udc.logger.Warn("Cannot parse account deletion data", zap.Error(err))
+			return c.SendStatus(fiber.StatusBadRequest)
+		}
+
+		// Accounts created through the identity provider have no password to confirm
+		if len(user.Password) != 0 && bcrypt.CompareHashAndPassword(user.Password, []byte(deleteDto.Password)) != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Incorrect password"})
+		}
+
+		if deletion = udc.delRepo.CreateAccountDeletion(user); deletion == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot delete account"})
+		}
+	} else if deletion.Status == models.DeletionFailed {
+		if udc.delRepo.UpdateAccountDeletionStatus(deletion, models.DeletionInProgress) == false {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "Cannot delete account"})
+		}
+
+		deletion.Status = models.DeletionInProgress
+	}
+
+	udc.delSrv.Start(deletion.Id)
+
+	return c.Status(fiber.StatusAccepted).JSON(deletion)
+}
+
+// GetAccountDeletion is public, because the account and its sessions are gone once the deletion completes. The
+// deletion id is a random UUID known only to the user who requested it.
+func (udc *UserDataController) GetAccountDeletion(c *fiber.Ctx) error {
+	deletion := udc.delRepo.GetAccountDeletionById(c.Params("id"))
+
+	if deletion == nil {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	return c.JSON(deletion)
+}
+
+func (udc *UserDataController) ExportUserData(c *fiber.Ctx) error {
+	user, status := udc.auth.getUserFromJwt(c)
+
+	if user == nil {
+		return c.SendStatus(status)
+	}
+
+	defer audit.Record(c, udc.events, udc.logger, events.AuditRecordedV1{ActorId: user.Id, Action: audit.UserExport,
+		Resource: "user:" + strconv.Itoa(int(user.Id))})
+
+	export, err := udc.export.Collect(c.UserContext(), user)
+
+	if err != nil {
+		udc.logger.Error("Cannot collect user data", zap.Uint("UserId", user.Id), zap.Error(err))
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Cannot export user data, try again"})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/zip")
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="dfs-export.zip"`)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		// The archive is written after the handler returned, so it cannot use the request context
+		if err := udc.export.WriteArchive(context.Background(), w, export); err != nil {
+			udc.logger.Error("Cannot write user data archive", zap.Uint("UserId", user.Id), zap.Error(err))
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package database
+
+import (
+	"dfs/auth/models"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type AccountDeletionRepository struct {
+	database *gorm.DB
+	logger   *zap.Logger
+}
+
+func NewAccountDeletionRepository(db *gorm.DB, log *zap.Logger) *AccountDeletionRepository {
+	return &AccountDeletionRepository{database: db, logger: log}
+}
+
+// CreateAccountDeletion disables the user in the same transaction, so other services reject the user's tokens from
+// the moment the deletion is accepted.
+func (adr *AccountDeletionRepository) CreateAccountDeletion(user *models.User) *models.AccountDeletion {
+	deletion := models.AccountDeletion{
+		Id:        uuid.New().String(),
+		UserId:    user.Id,
+		Status:    models.DeletionInProgress,
+		StartedAt: time.Now(),
+	}
+
+	err := adr.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Update("disabled", true).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&deletion).Error
+	})
+
+	if err != nil {
+		adr.logger.Error("Cannot create account deletion", zap.Uint("UserId", user.Id), zap.Error(err))
+		return nil
+	}
+
+	return &deletion
+}
+
+func (adr *AccountDeletionRepository) GetAccountDeletionById(deletionId string) *models.AccountDeletion {
+	var deletion models.AccountDeletion
+
+	if err := adr.database.Where("id = ?", deletionId).First(&deletion).Error; err != nil {
+		return nil
+	}
+
+	return &deletion
+}
+
+func (adr *AccountDeletionRepository) GetAccountDeletionByUserId(userId uint) *models.AccountDeletion {
+	var deletion models.AccountDeletion
+
+	if err := adr.database.Where("user_id = ?", userId).First(&deletion).Error; err != nil {
+		return nil
+	}
+
+	return &deletion
+}
+
+func (adr *AccountDeletionRepository) GetAccountDeletionsInProgress() []models.AccountDeletion {
+	var deletions []models.AccountDeletion
+
+	if err := adr.database.Where("status = ?", models.DeletionInProgress).Find(&deletions).Error; err != nil {
+		adr.logger.Error("Cannot get account deletions in progress", zap.Error(err))
+		return nil
+	}
+
+	return deletions
+}
+
+func (adr *AccountDeletionRepository) UpdateAccountDeletionStatus(deletion *models.AccountDeletion,
+	status models.AccountDeletionStatus) bool {
+	updates := map[string]interface{}{"status": status}
+
+	if status != models.DeletionInProgress {
+		updates["finished_at"] = time.Now()
+	}
+
+	if err := adr.database.Model(deletion).Updates(updates).Error; err != nil {
+		adr.logger.Error("Cannot update account deletion status", zap.String("DeletionId", deletion.Id),
+			zap.Error(err))
+		return false
+	}
+
+	return true
+}
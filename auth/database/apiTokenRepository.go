@@ -0,0 +1,83 @@
+package database
+
+import (
+	"dfs/auth/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type ApiTokenRepository struct {
+	database *gorm.DB
+	logger   *zap.Logger
+}
+
+func NewApiTokenRepository(db *gorm.DB, log *zap.Logger) *ApiTokenRepository {
+	return &ApiTokenRepository{database: db, logger: log}
+}
+
+func (atr *ApiTokenRepository) CreateApiToken(userId uint, name string, tokenHash string, scopes string,
+	expiresAt time.Time) *models.ApiToken {
+	token := models.ApiToken{
+		UserId:    userId,
+		Name:      name,
+		TokenHash: tokenHash,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+		ExpiresAt: expiresAt,
+	}
+
+	if err := atr.database.Create(&token).Error; err != nil {
+		atr.logger.Error("Cannot create API token", zap.Uint("UserId", userId), zap.Error(err))
+		return nil
+	}
+
+	return &token
+}
+
+func (atr *ApiTokenRepository) GetUserApiTokens(userId uint) []models.ApiToken {
+	tokens := []models.ApiToken{}
+
+	if err := atr.database.Where("user_id = ?", userId).Order("created_at desc").Find(&tokens).Error; err != nil {
+		atr.logger.Error("Cannot get API tokens", zap.Uint("UserId", userId), zap.Error(err))
+		return nil
+	}
+
+	return tokens
+}
+
+// GetActiveApiToken returns the token with the hash if it is neither revoked nor expired.
+func (atr *ApiTokenRepository) GetActiveApiToken(tokenHash string) *models.ApiToken {
+	var token models.ApiToken
+
+	err := atr.database.Where("token_hash = ? AND revoked = ? AND expires_at > ?", tokenHash, false, time.Now()).
+		First(&token).Error
+
+	if err != nil {
+		return nil
+	}
+
+	return &token
+}
+
+func (atr *ApiTokenRepository) UpdateLastUsed(token *models.ApiToken) bool {
+	if err := atr.database.Model(token).Update("last_used_at", time.Now()).Error; err != nil {
+		atr.logger.Error("Cannot update API token", zap.Uint("TokenId", token.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// RevokeApiToken revokes the token of the user and reports whether there was such a token.
+func (atr *ApiTokenRepository) RevokeApiToken(tokenId uint, userId uint) bool {
+	result := atr.database.Model(&models.ApiToken{}).Where("id = ? AND user_id = ?", tokenId, userId).
+		Update("revoked", true)
+
+	if result.Error != nil {
+		atr.logger.Error("Cannot revoke API token", zap.Uint("TokenId", tokenId), zap.Error(result.Error))
+		return false
+	}
+
+	return result.RowsAffected == 1
+}
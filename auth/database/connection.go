@@ -15,7 +15,21 @@ func Connect(connectionString string) (*gorm.DB, error) {
 	}
 
 	connection.AutoMigrate(&models.User{})
+
+	// Email used to be unique on its own, now it is unique per verification purpose
+	if connection.Migrator().HasConstraint(&models.VerificationData{}, "verification_data_email_key") {
+		connection.Migrator().DropConstraint(&models.VerificationData{}, "verification_data_email_key")
+	}
+
 	connection.AutoMigrate(&models.VerificationData{})
+	connection.AutoMigrate(&models.KeyRotation{})
+	connection.AutoMigrate(&models.KeyRotationFile{})
+	connection.AutoMigrate(&models.Session{})
+	connection.AutoMigrate(&models.RecoveryCode{})
+	connection.AutoMigrate(&models.LoginThrottle{})
+	connection.AutoMigrate(&models.ApiToken{})
+	connection.AutoMigrate(&models.AccountDeletion{})
+	connection.AutoMigrate(&models.DeadLetter{})
 
 	return connection, nil
 }
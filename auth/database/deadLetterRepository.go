@@ -0,0 +1,76 @@
+package database
+
+import (
+	"dfs/auth/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type DeadLetterRepository struct {
+	database *gorm.DB
+	logger   *zap.Logger
+}
+
+func NewDeadLetterRepository(db *gorm.DB, log *zap.Logger) *DeadLetterRepository {
+	return &DeadLetterRepository{database: db, logger: log}
+}
+
+func (dlr *DeadLetterRepository) CreateDeadLetter(deadLetter *models.DeadLetter) bool {
+	if err := dlr.database.Create(deadLetter).Error; err != nil {
+		dlr.logger.Error("Cannot create dead letter", zap.String("Queue", deadLetter.Queue), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// GetDeadLetters returns a page of dead letters, newest first, optionally only those of one queue, and the number of
+// all matches.
+func (dlr *DeadLetterRepository) GetDeadLetters(queueName string, offset int, limit int) ([]models.DeadLetter, int64,
+	bool) {
+	var deadLetters []models.DeadLetter
+	var total int64
+
+	query := dlr.database.Model(&models.DeadLetter{})
+
+	if queueName != "" {
+		query = query.Where("queue = ?", queueName)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		dlr.logger.Error("Cannot count dead letters", zap.Error(err))
+		return nil, 0, false
+	}
+
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&deadLetters).Error; err != nil {
+		dlr.logger.Error("Cannot get dead letters", zap.Error(err))
+		return nil, 0, false
+	}
+
+	return deadLetters, total, true
+}
+
+func (dlr *DeadLetterRepository) GetDeadLetterById(deadLetterId uint) *models.DeadLetter {
+	var deadLetter models.DeadLetter
+
+	if err := dlr.database.Where("id = ?", deadLetterId).First(&deadLetter).Error; err != nil {
+		return nil
+	}
+
+	return &deadLetter
+}
+
+func (dlr *DeadLetterRepository) MarkReplayed(deadLetter *models.DeadLetter) bool {
+	now := time.Now()
+
+	if err := dlr.database.Model(deadLetter).Update("replayed_at", now).Error; err != nil {
+		dlr.logger.Error("Cannot mark dead letter as replayed", zap.Uint("DeadLetterId", deadLetter.Id),
+			zap.Error(err))
+		return false
+	}
+
+	deadLetter.ReplayedAt = &now
+
+	return true
+}
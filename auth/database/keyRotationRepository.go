@@ -0,0 +1,162 @@
+package database
+
+import (
+	"dfs/auth/models"
+	"errors"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type KeyRotationRepository struct {
+	database *gorm.DB
+	logger   *zap.Logger
+}
+
+func NewKeyRotationRepository(db *gorm.DB, log *zap.Logger) *KeyRotationRepository {
+	return &KeyRotationRepository{database: db, logger: log}
+}
+
+// ErrKeyRotationConflict is returned when the key of the user changed since it was read, e.g. by a concurrent rotation.
+var ErrKeyRotationConflict = errors.New("key of the user changed or is being rotated")
+
+// CreateKeyRotation replaces the key the user was read with, the previous key is kept until all files are migrated.
+func (krr *KeyRotationRepository) CreateKeyRotation(user *models.User, newKey string) (*models.KeyRotation, error) {
+	rotation := models.KeyRotation{
+		UserId:    user.Id,
+		Status:    models.RotationInProgress,
+		StartedAt: time.Now(),
+	}
+
+	err := krr.database.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.User{}).
+			Where("id = ? AND crypt_key = ? AND previous_crypt_key = ?", user.Id, user.CryptKey, "").
+			Updates(map[string]interface{}{"crypt_key": newKey, "previous_crypt_key": user.CryptKey})
+
+		if result.Error != nil {
+			return result.Error
+		}
+
+		if result.RowsAffected != 1 {
+			return ErrKeyRotationConflict
+		}
+
+		return tx.Create(&rotation).Error
+	})
+
+	if errors.Is(err, ErrKeyRotationConflict) {
+		return nil, err
+	} else if err != nil {
+		krr.logger.Error("Cannot create key rotation", zap.Uint("UserId", user.Id), zap.Error(err))
+		return nil, err
+	}
+
+	return &rotation, nil
+}
+
+func (krr *KeyRotationRepository) GetKeyRotationById(rotationId uint) *models.KeyRotation {
+	var rotation models.KeyRotation
+
+	if err := krr.database.Where("id = ?", rotationId).First(&rotation).Error; err != nil {
+		return nil
+	}
+
+	return &rotation
+}
+
+func (krr *KeyRotationRepository) GetLatestKeyRotation(userId uint) *models.KeyRotation {
+	var rotation models.KeyRotation
+
+	if err := krr.database.Where("user_id = ?", userId).Order("started_at desc").First(&rotation).Error; err != nil {
+		return nil
+	}
+
+	return &rotation
+}
+
+func (krr *KeyRotationRepository) GetKeyRotationsInProgress() []models.KeyRotation {
+	var rotations []models.KeyRotation
+
+	if err := krr.database.Where("status = ?", models.RotationInProgress).Find(&rotations).Error; err != nil {
+		krr.logger.Error("Cannot get key rotations in progress", zap.Error(err))
+		return nil
+	}
+
+	return rotations
+}
+
+func (krr *KeyRotationRepository) AddKeyRotationFiles(rotation *models.KeyRotation, filesPath []string) bool {
+	err := krr.database.Transaction(func(tx *gorm.DB) error {
+		for _, filePath := range filesPath {
+			if err := tx.Create(&models.KeyRotationFile{RotationId: rotation.Id, FilePath: filePath}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(rotation).Updates(map[string]interface{}{"files_listed": true,
+			"total_files": len(filesPath)}).Error
+	})
+
+	if err != nil {
+		krr.logger.Error("Cannot save key rotation files", zap.Uint("RotationId", rotation.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (krr *KeyRotationRepository) GetPendingKeyRotationFiles(rotationId uint) []models.KeyRotationFile {
+	var files []models.KeyRotationFile
+
+	if err := krr.database.Where("rotation_id = ? AND migrated = ?", rotationId, false).Find(&files).Error; err != nil {
+		krr.logger.Error("Cannot get pending key rotation files", zap.Uint("RotationId", rotationId), zap.Error(err))
+		return nil
+	}
+
+	return files
+}
+
+func (krr *KeyRotationRepository) MarkKeyRotationFileMigrated(file *models.KeyRotationFile) bool {
+	err := krr.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(file).Update("migrated", true).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.KeyRotation{Id: file.RotationId}).
+			Update("migrated_files", gorm.Expr("migrated_files + ?", 1)).Error
+	})
+
+	if err != nil {
+		krr.logger.Error("Cannot mark file as migrated", zap.String("FilePath", file.FilePath), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (krr *KeyRotationRepository) CompleteKeyRotation(rotation *models.KeyRotation) bool {
+	err := krr.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{Id: rotation.UserId}).Update("previous_crypt_key", "").Error; err != nil {
+			return err
+		}
+
+		return tx.Model(rotation).Updates(map[string]interface{}{"status": models.RotationCompleted,
+			"finished_at": time.Now()}).Error
+	})
+
+	if err != nil {
+		krr.logger.Error("Cannot complete key rotation", zap.Uint("RotationId", rotation.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (krr *KeyRotationRepository) UpdateKeyRotationStatus(rotation *models.KeyRotation, status models.KeyRotationStatus) bool {
+	if err := krr.database.Model(rotation).Update("status", status).Error; err != nil {
+		krr.logger.Error("Cannot update key rotation status", zap.Uint("RotationId", rotation.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
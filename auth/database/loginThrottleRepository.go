@@ -0,0 +1,73 @@
+package database
+
+import (
+	"dfs/auth/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type LoginThrottleRepository struct {
+	database *gorm.DB
+	logger   *zap.Logger
+}
+
+func NewLoginThrottleRepository(db *gorm.DB, log *zap.Logger) *LoginThrottleRepository {
+	return &LoginThrottleRepository{database: db, logger: log}
+}
+
+func (ltr *LoginThrottleRepository) GetLoginThrottle(key string) *models.LoginThrottle {
+	var throttle models.LoginThrottle
+
+	if err := ltr.database.Where("key = ?", key).First(&throttle).Error; err != nil {
+		return nil
+	}
+
+	return &throttle
+}
+
+// RegisterFailedAttempt increments the failed attempts counter of the key. The counter starts over when the last
+// failure happened before resetBefore.
+func (ltr *LoginThrottleRepository) RegisterFailedAttempt(key string, resetBefore time.Time) *models.LoginThrottle {
+	now := time.Now()
+
+	err := ltr.database.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"failed_attempts": gorm.Expr("CASE WHEN login_throttles.last_failed_at < ? THEN 1 "+
+				"ELSE login_throttles.failed_attempts + 1 END", resetBefore),
+			"last_failed_at": now,
+		}),
+	}).Create(&models.LoginThrottle{Key: key, FailedAttempts: 1, LastFailedAt: now}).Error
+
+	if err != nil {
+		ltr.logger.Error("Cannot register failed login attempt", zap.String("Key", key), zap.Error(err))
+		return nil
+	}
+
+	return ltr.GetLoginThrottle(key)
+}
+
+func (ltr *LoginThrottleRepository) Lock(key string, lockedUntil time.Time) bool {
+	err := ltr.database.Model(&models.LoginThrottle{}).Where("key = ?", key).Updates(map[string]interface{}{
+		"failed_attempts": 0,
+		"locked_until":    lockedUntil,
+	}).Error
+
+	if err != nil {
+		ltr.logger.Error("Cannot lock login", zap.String("Key", key), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (ltr *LoginThrottleRepository) DeleteLoginThrottle(key string) bool {
+	if err := ltr.database.Where("key = ?", key).Delete(&models.LoginThrottle{}).Error; err != nil {
+		ltr.logger.Error("Cannot delete login throttle", zap.String("Key", key), zap.Error(err))
+		return false
+	}
+
+	return true
+}
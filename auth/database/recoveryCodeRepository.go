@@ -0,0 +1,62 @@
+package database
+
+import (
+	"dfs/auth/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type RecoveryCodeRepository struct {
+	database *gorm.DB
+	logger   *zap.Logger
+}
+
+func NewRecoveryCodeRepository(db *gorm.DB, log *zap.Logger) *RecoveryCodeRepository {
+	return &RecoveryCodeRepository{database: db, logger: log}
+}
+
+func (rcr *RecoveryCodeRepository) ReplaceRecoveryCodes(userId uint, codeHashes []string) bool {
+	err := rcr.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		for _, codeHash := range codeHashes {
+			if err := tx.Create(&models.RecoveryCode{UserId: userId, CodeHash: codeHash}).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		rcr.logger.Error("Cannot save recovery codes", zap.Uint("UserId", userId), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// UseRecoveryCode marks the matching unused code as used and reports whether there was one.
+func (rcr *RecoveryCodeRepository) UseRecoveryCode(userId uint, codeHash string) bool {
+	result := rcr.database.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used = ?", userId, codeHash, false).
+		Update("used", true)
+
+	if result.Error != nil {
+		rcr.logger.Error("Cannot use recovery code", zap.Uint("UserId", userId), zap.Error(result.Error))
+		return false
+	}
+
+	return result.RowsAffected == 1
+}
+
+func (rcr *RecoveryCodeRepository) DeleteRecoveryCodes(userId uint) bool {
+	if err := rcr.database.Where("user_id = ?", userId).Delete(&models.RecoveryCode{}).Error; err != nil {
+		rcr.logger.Error("Cannot delete recovery codes", zap.Uint("UserId", userId), zap.Error(err))
+		return false
+	}
+
+	return true
+}
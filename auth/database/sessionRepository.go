@@ -0,0 +1,112 @@
+package database
+
+import (
+	"dfs/auth/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"time"
+)
+
+type SessionRepository struct {
+	database *gorm.DB
+	logger   *zap.Logger
+}
+
+func NewSessionRepository(db *gorm.DB, log *zap.Logger) *SessionRepository {
+	return &SessionRepository{database: db, logger: log}
+}
+
+func (sr *SessionRepository) CreateSession(userId uint, refreshTokenHash string, expiresAt time.Time) *models.Session {
+	session := models.Session{
+		UserId:           userId,
+		RefreshTokenHash: refreshTokenHash,
+		CreatedAt:        time.Now(),
+		RefreshedAt:      time.Now(),
+		ExpiresAt:        expiresAt,
+	}
+
+	if err := sr.database.Create(&session).Error; err != nil {
+		sr.logger.Error("Cannot create session", zap.Uint("UserId", userId), zap.Error(err))
+		return nil
+	}
+
+	return &session
+}
+
+func (sr *SessionRepository) GetSessionByRefreshTokenHash(refreshTokenHash string) *models.Session {
+	var session models.Session
+
+	if err := sr.database.Where("refresh_token_hash = ?", refreshTokenHash).First(&session).Error; err != nil {
+		return nil
+	}
+
+	return &session
+}
+
+func (sr *SessionRepository) GetSessionByPreviousRefreshTokenHash(refreshTokenHash string) *models.Session {
+	var session models.Session
+
+	if err := sr.database.Where("previous_refresh_token_hash = ?", refreshTokenHash).First(&session).Error; err != nil {
+		return nil
+	}
+
+	return &session
+}
+
+// RotateRefreshToken replaces the refresh token of the session unless a concurrent refresh already replaced it, so
+// the same token is rotated only once.
+func (sr *SessionRepository) RotateRefreshToken(session *models.Session, refreshTokenHash string,
+	expiresAt time.Time) bool {
+	result := sr.database.Model(session).Where("refresh_token_hash = ?", session.RefreshTokenHash).
+		Updates(map[string]interface{}{
+			"refresh_token_hash":          refreshTokenHash,
+			"previous_refresh_token_hash": session.RefreshTokenHash,
+			"refreshed_at":                time.Now(),
+			"expires_at":                  expiresAt,
+		})
+
+	if result.Error != nil {
+		sr.logger.Error("Cannot rotate refresh token", zap.Uint("SessionId", session.Id), zap.Error(result.Error))
+		return false
+	}
+
+	return result.RowsAffected == 1
+}
+
+func (sr *SessionRepository) IsSessionActive(sessionId uint, userId uint) bool {
+	var count int64
+
+	err := sr.database.Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked = ? AND expires_at > ?", sessionId, userId, false, time.Now()).
+		Count(&count).Error
+
+	if err != nil {
+		sr.logger.Error("Cannot check session", zap.Uint("SessionId", sessionId), zap.Error(err))
+		return false
+	}
+
+	return count > 0
+}
+
+func (sr *SessionRepository) RevokeSession(sessionId uint) bool {
+	err := sr.database.Model(&models.Session{}).Where("id = ?", sessionId).Update("revoked", true).Error
+
+	if err != nil {
+		sr.logger.Error("Cannot revoke session", zap.Uint("SessionId", sessionId), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (sr *SessionRepository) RevokeUserSessions(userId uint) bool {
+	err := sr.database.Model(&models.Session{}).Where("user_id = ? AND revoked = ?", userId, false).
+		Update("revoked", true).Error
+
+	if err != nil {
+		sr.logger.Error("Cannot revoke user sessions", zap.Uint("UserId", userId), zap.Error(err))
+		return false
+	}
+
+	return true
+}
@@ -4,6 +4,7 @@ import (
 	"dfs/auth/models"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
+	"strings"
 )
 
 type UserRepository struct {
@@ -33,11 +34,28 @@ func (ur *UserRepository) CreateUser(name string, email string, password []byte,
 	return user.Id
 }
 
-func (ur *UserRepository) DeleteUserByEmail(email string) bool {
-	user := models.User{Email: email}
+// CreateOidcUser creates a verified user without a password, who can only log in through the identity provider.
+func (ur *UserRepository) CreateOidcUser(name string, email string, subject string, key string) *models.User {
+	user := models.User{
+		Name:          name,
+		Email:         email,
+		Verified:      true,
+		HomeDirectory: email,
+		CryptKey:      key,
+		OidcSubject:   subject,
+	}
+
+	if err := ur.database.Create(&user).Error; err != nil {
+		ur.logger.Error("Cannot create user", zap.Error(err))
+		return nil
+	}
 
-	if err := ur.database.Delete(&user).Error; err != nil {
-		ur.logger.Error("Cannot delete user", zap.Error(err))
+	return &user
+}
+
+func (ur *UserRepository) DeleteUnverifiedUser(user *models.User) bool {
+	if err := ur.database.Where("id = ? AND verified = ?", user.Id, false).Delete(&models.User{}).Error; err != nil {
+		ur.logger.Error("Cannot delete user", zap.Uint("UserId", user.Id), zap.Error(err))
 		return false
 	}
 
@@ -64,6 +82,46 @@ func (ur *UserRepository) GetUserByEmail(email string) *models.User {
 	return &user
 }
 
+func (ur *UserRepository) GetUserByPendingEmail(email string) *models.User {
+	var user models.User
+
+	if err := ur.database.Where("pending_email = ?", email).First(&user).Error; err != nil {
+		return nil
+	}
+
+	return &user
+}
+
+func (ur *UserRepository) GetUserByOidcSubject(subject string) *models.User {
+	var user models.User
+
+	if err := ur.database.Where("oidc_subject = ?", subject).First(&user).Error; err != nil {
+		return nil
+	}
+
+	return &user
+}
+
+// LinkOidcSubject connects the account to the identity provider user. The provider verified the email address, so the
+// account is verified as well. A password chosen during an unverified registration may belong to someone else than
+// the owner of the address, so it is dropped.
+func (ur *UserRepository) LinkOidcSubject(user *models.User, subject string) bool {
+	updates := map[string]interface{}{"oidc_subject": subject, "verified": true}
+
+	if user.Verified == false {
+		updates["password"] = nil
+	}
+
+	err := ur.database.Model(user).Updates(updates).Error
+
+	if err != nil {
+		ur.logger.Error("Cannot link OIDC subject", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
 func (ur *UserRepository) VerifyUser(user *models.User) bool {
 	if err := ur.database.Model(&user).Update("verified", true).Error; err != nil {
 		ur.logger.Error("Cannot update user", zap.Error(err))
@@ -72,3 +130,244 @@ func (ur *UserRepository) VerifyUser(user *models.User) bool {
 
 	return true
 }
+
+func (ur *UserRepository) RewrapCryptKeys(rewrap func(key string) (string, error)) bool {
+	var users []models.User
+
+	if err := ur.database.Find(&users).Error; err != nil {
+		ur.logger.Error("Cannot get users", zap.Error(err))
+		return false
+	}
+
+	err := ur.database.Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			rewrapped, err := rewrap(user.CryptKey)
+
+			if err != nil {
+				ur.logger.Error("Cannot rewrap user key", zap.Uint("UserId", user.Id), zap.Error(err))
+				return err
+			}
+
+			previousRewrapped := user.PreviousCryptKey
+
+			if user.PreviousCryptKey != "" {
+				if previousRewrapped, err = rewrap(user.PreviousCryptKey); err != nil {
+					ur.logger.Error("Cannot rewrap previous user key", zap.Uint("UserId", user.Id), zap.Error(err))
+					return err
+				}
+			}
+
+			if rewrapped == user.CryptKey && previousRewrapped == user.PreviousCryptKey {
+				continue
+			}
+
+			if err := tx.Model(&user).Updates(map[string]interface{}{"crypt_key": rewrapped,
+				"previous_crypt_key": previousRewrapped}).Error; err != nil {
+				ur.logger.Error("Cannot update user key", zap.Uint("UserId", user.Id), zap.Error(err))
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return false
+	}
+
+	ur.logger.Info("Rewrapped users keys", zap.Int("Users", len(users)))
+
+	return true
+}
+
+func (ur *UserRepository) SetTotpSecret(user *models.User, secret string) bool {
+	if err := ur.database.Model(user).Updates(map[string]interface{}{"totp_secret": secret,
+		"totp_enabled": false, "totp_last_counter": 0}).Error; err != nil {
+		ur.logger.Error("Cannot update user TOTP secret", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (ur *UserRepository) EnableTotp(user *models.User, counter uint64) bool {
+	if err := ur.database.Model(user).Updates(map[string]interface{}{"totp_enabled": true,
+		"totp_last_counter": counter}).Error; err != nil {
+		ur.logger.Error("Cannot enable user TOTP", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (ur *UserRepository) DisableTotp(user *models.User) bool {
+	if err := ur.database.Model(user).Updates(map[string]interface{}{"totp_secret": "", "totp_enabled": false,
+		"totp_last_counter": 0}).Error; err != nil {
+		ur.logger.Error("Cannot disable user TOTP", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// UpdateTotpCounter stores the last used time step unless a concurrent login already used the same or a later one.
+func (ur *UserRepository) UpdateTotpCounter(user *models.User, counter uint64) bool {
+	result := ur.database.Model(user).Where("totp_last_counter < ?", counter).Update("totp_last_counter", counter)
+
+	if result.Error != nil {
+		ur.logger.Error("Cannot update user TOTP counter", zap.Uint("UserId", user.Id), zap.Error(result.Error))
+		return false
+	}
+
+	return result.RowsAffected == 1
+}
+
+func (ur *UserRepository) UpdatePassword(user *models.User, password []byte) bool {
+	if err := ur.database.Model(user).Update("password", password).Error; err != nil {
+		ur.logger.Error("Cannot update user password", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// SearchUsers returns a page of users whose name or email contains the search phrase and the number of all matches.
+func (ur *UserRepository) SearchUsers(search string, offset int, limit int) ([]models.User, int64, bool) {
+	var users []models.User
+	var total int64
+
+	query := ur.database.Model(&models.User{})
+
+	if search != "" {
+		pattern := "%" + strings.ToLower(search) + "%"
+		query = query.Where("LOWER(name) LIKE ? OR LOWER(email) LIKE ?", pattern, pattern)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		ur.logger.Error("Cannot count users", zap.Error(err))
+		return nil, 0, false
+	}
+
+	if err := query.Order("id").Offset(offset).Limit(limit).Find(&users).Error; err != nil {
+		ur.logger.Error("Cannot get users", zap.Error(err))
+		return nil, 0, false
+	}
+
+	return users, total, true
+}
+
+func (ur *UserRepository) SetRole(user *models.User, role string) bool {
+	if err := ur.database.Model(user).Update("role", role).Error; err != nil {
+		ur.logger.Error("Cannot update user role", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (ur *UserRepository) SetDisabled(user *models.User, disabled bool) bool {
+	if err := ur.database.Model(user).Update("disabled", disabled).Error; err != nil {
+		ur.logger.Error("Cannot update user status", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// DeleteUser removes the user together with everything the auth service stores for them. Audit entries are kept.
+func (ur *UserRepository) DeleteUser(user *models.User) bool {
+	err := ur.database.Transaction(func(tx *gorm.DB) error {
+		var rotationIds []uint
+
+		if err := tx.Model(&models.KeyRotation{}).Where("user_id = ?", user.Id).
+			Pluck("id", &rotationIds).Error; err != nil {
+			return err
+		}
+
+		if len(rotationIds) != 0 {
+			if err := tx.Where("rotation_id IN ?", rotationIds).Delete(&models.KeyRotationFile{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, model := range []interface{}{&models.KeyRotation{}, &models.Session{}, &models.RecoveryCode{},
+			&models.ApiToken{}} {
+			if err := tx.Where("user_id = ?", user.Id).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("email IN ?", []string{user.Email, user.PendingEmail}).
+			Delete(&models.VerificationData{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&models.User{}, user.Id).Error
+	})
+
+	if err != nil {
+		ur.logger.Error("Cannot delete user", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (ur *UserRepository) UpdateName(user *models.User, name string) bool {
+	if err := ur.database.Model(user).Update("name", name).Error; err != nil {
+		ur.logger.Error("Cannot update user name", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (ur *UserRepository) SetPendingEmail(user *models.User, email string) bool {
+	if err := ur.database.Model(user).Update("pending_email", email).Error; err != nil {
+		ur.logger.Error("Cannot update user pending email", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// ClearPendingEmail cancels the email change of whichever user requested the address.
+func (ur *UserRepository) ClearPendingEmail(email string) bool {
+	err := ur.database.Model(&models.User{}).Where("pending_email = ?", email).Update("pending_email", "").Error
+
+	if err != nil {
+		ur.logger.Error("Cannot clear pending email", zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (ur *UserRepository) ConfirmEmailChange(user *models.User) bool {
+	if err := ur.database.Model(user).Updates(map[string]interface{}{"email": user.PendingEmail,
+		"pending_email": ""}).Error; err != nil {
+		ur.logger.Error("Cannot change user email", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// SearchDirectory returns at most limit active users whose name or email starts with the query. Matching only
+// prefixes keeps the directory from being listed with short generic queries.
+func (ur *UserRepository) SearchDirectory(query string, limit int) []models.User {
+	users := []models.User{}
+	// Wildcards in the query would turn the prefix search into a listing again
+	escaper := strings.NewReplacer("\\", "\\\\", "%", "\\%", "_", "\\_")
+	pattern := escaper.Replace(strings.ToLower(query)) + "%"
+
+	err := ur.database.Where("verified = ? AND disabled = ? AND (LOWER(name) LIKE ? OR LOWER(email) LIKE ?)", true,
+		false, pattern, pattern).Order("name").Limit(limit).Find(&users).Error
+
+	if err != nil {
+		ur.logger.Error("Cannot search users", zap.Error(err))
+		return nil
+	}
+
+	return users
+}
@@ -18,10 +18,12 @@ func NewVerificationRepository(db *gorm.DB, log *zap.Logger) *VerificationReposi
 	return &VerificationRepository{database: db, logger: log}
 }
 
-func (vr *VerificationRepository) CreateAndReturnVerificationData(email string) *models.VerificationData {
+func (vr *VerificationRepository) CreateAndReturnVerificationData(email string, purpose models.VerificationPurpose,
+	ttl time.Duration) *models.VerificationData {
 	verificationData := models.VerificationData{
 		Email:     email,
-		ExpiresAt: time.Now().Add(time.Hour * 1),
+		Purpose:   purpose,
+		ExpiresAt: time.Now().Add(ttl),
 		Code:      strings.Replace(uuid.New().String(), "-", "", -1),
 	}
 
@@ -43,10 +45,32 @@ func (vr *VerificationRepository) DeleteVerification(id uint) bool {
 	return true
 }
 
-func (vr *VerificationRepository) GetVerificationByCode(code string) *models.VerificationData {
+func (vr *VerificationRepository) DeleteVerificationsByEmail(email string, purpose models.VerificationPurpose) bool {
+	if err := vr.database.Where("email = ? AND purpose = ?", email, purpose).
+		Delete(&models.VerificationData{}).Error; err != nil {
+		vr.logger.Error("Cannot delete verification data entries", zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (vr *VerificationRepository) GetExpiredVerifications() []models.VerificationData {
+	var verifications []models.VerificationData
+
+	if err := vr.database.Where("expires_at < ?", time.Now()).Find(&verifications).Error; err != nil {
+		vr.logger.Error("Cannot get expired verification data entries", zap.Error(err))
+		return nil
+	}
+
+	return verifications
+}
+
+func (vr *VerificationRepository) GetVerificationByCode(code string,
+	purpose models.VerificationPurpose) *models.VerificationData {
 	var verificationData models.VerificationData
 
-	if err := vr.database.Where("code = ?", code).First(&verificationData).Error; err != nil {
+	if err := vr.database.Where("code = ? AND purpose = ?", code, purpose).First(&verificationData).Error; err != nil {
 		return nil
 	}
 
@@ -0,0 +1,25 @@
+package dtos
+
+type AdminUserDto struct {
+	Id            uint   `json:"id"`
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	Verified      bool   `json:"verified"`
+	HomeDirectory string `json:"directory"`
+	Role          string `json:"role"`
+	Disabled      bool   `json:"disabled"`
+	TotpEnabled   bool   `json:"totpEnabled"`
+	OidcLinked    bool   `json:"oidcLinked"`
+}
+
+type AdminUserDetailsDto struct {
+	User    AdminUserDto     `json:"user"`
+	Storage *StorageUsageDto `json:"storage"`
+}
+
+type AdminUserListDto struct {
+	Users    []AdminUserDto `json:"users"`
+	Total    int64          `json:"total"`
+	Page     int            `json:"page"`
+	PageSize int            `json:"pageSize"`
+}
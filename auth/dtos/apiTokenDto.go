@@ -0,0 +1,7 @@
+package dtos
+
+type CreateApiTokenDto struct {
+	Name          string   `json:"name" validate:"required,max=64"`
+	Scopes        []string `json:"scopes" validate:"required,min=1,dive,oneof=auth auth:read storage storage:read share share:read sharespace sharespace:read webhook webhook:read audit:read"`
+	ExpiresInDays int      `json:"expiresInDays" validate:"required,min=1,max=365"`
+}
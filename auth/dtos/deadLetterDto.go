@@ -0,0 +1,22 @@
+package dtos
+
+import "time"
+
+type DeadLetterDto struct {
+	Id             uint       `json:"id"`
+	Queue          string     `json:"queue"`
+	ContentType    string     `json:"contentType"`
+	Size           int        `json:"size"`
+	Preview        string     `json:"preview"`
+	Error          string     `json:"error"`
+	Retries        int        `json:"retries"`
+	DeadLetteredAt time.Time  `json:"deadLetteredAt"`
+	ReplayedAt     *time.Time `json:"replayedAt"`
+}
+
+type DeadLetterListDto struct {
+	DeadLetters []DeadLetterDto `json:"deadLetters"`
+	Total       int64           `json:"total"`
+	Page        int             `json:"page"`
+	PageSize    int             `json:"pageSize"`
+}
@@ -0,0 +1,42 @@
+package dtos
+
+import (
+	"dfs/auth/models"
+	"time"
+)
+
+type UserShareDto struct {
+	FileId         uint      `json:"fileId"`
+	SharedForId    uint      `json:"sharedForId"`
+	SharedById     uint      `json:"sharedById"`
+	ExpirationTime time.Time `json:"expirationTime"`
+}
+
+type MembershipDto struct {
+	ShareSpaceId uint   `json:"shareSpaceId"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+}
+
+type ExportedFileDto struct {
+	Name            string `json:"name"`
+	ArchivePath     string `json:"archivePath,omitempty"`
+	ClientEncrypted bool   `json:"clientEncrypted"`
+	KeyMetadata     string `json:"keyMetadata,omitempty"`
+	Exported        bool   `json:"exported"`
+}
+
+type AccountExportDto struct {
+	Id          uint              `json:"id"`
+	Name        string            `json:"name"`
+	Email       string            `json:"email"`
+	Role        string            `json:"role"`
+	TotpEnabled bool              `json:"totpEnabled"`
+	OidcLinked  bool              `json:"oidcLinked"`
+	ApiTokens   []models.ApiToken `json:"apiTokens"`
+	ExportedAt  time.Time         `json:"exportedAt"`
+}
+
+type DeleteAccountDto struct {
+	Password string `json:"password"`
+}
@@ -0,0 +1,10 @@
+package dtos
+
+type FileDto struct {
+	Id              uint   `json:"id"`
+	UniqueName      string `json:"uniqueName"`
+	Name            string `json:"name"`
+	OwnerId         uint   `json:"ownerId"`
+	ClientEncrypted bool   `json:"clientEncrypted"`
+	KeyMetadata     string `json:"keyMetadata"`
+}
@@ -0,0 +1,19 @@
+package dtos
+
+type ResendVerificationDto struct {
+	Email string `json:"email" validate:"required,email,min=6,max=48"`
+}
+
+type ForgotPasswordDto struct {
+	Email string `json:"email" validate:"required,email,min=6,max=48"`
+}
+
+type ResetPasswordDto struct {
+	Code     string `json:"code" validate:"required,max=64"`
+	Password string `json:"password" validate:"required,min=12,max=48,password"`
+}
+
+type ChangePasswordDto struct {
+	CurrentPassword string `json:"currentPassword" validate:"required,max=48"`
+	NewPassword     string `json:"newPassword" validate:"required,min=12,max=48,password"`
+}
@@ -0,0 +1,13 @@
+package dtos
+
+type UpdateProfileDto struct {
+	Name            string `json:"name" validate:"omitempty,min=6,max=32"`
+	Email           string `json:"email" validate:"omitempty,email,min=6,max=48"`
+	CurrentPassword string `json:"currentPassword" validate:"max=48"`
+}
+
+type UserSearchResultDto struct {
+	Id    uint   `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+}
@@ -0,0 +1,7 @@
+package dtos
+
+type ReEncryptFileDto struct {
+	FilePath string `json:"filePath"`
+	OldKey   []byte `json:"oldKey"`
+	NewKey   []byte `json:"newKey"`
+}
@@ -0,0 +1,8 @@
+package dtos
+
+type ReadFileDto struct {
+	ReadPath              string `json:"savePath"`
+	DecryptionKey         []byte `json:"decryptionKey"`
+	FallbackDecryptionKey []byte `json:"fallbackDecryptionKey"`
+	ClientEncrypted       bool   `json:"clientEncrypted"`
+}
@@ -0,0 +1,6 @@
+package dtos
+
+type StorageUsageDto struct {
+	FileCount  uint64 `json:"fileCount"`
+	TotalBytes uint64 `json:"totalBytes"`
+}
@@ -0,0 +1,11 @@
+package dtos
+
+type TwoFactorCodeDto struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type TwoFactorLoginDto struct {
+	PendingToken string `json:"pendingToken" validate:"required"`
+	Code         string `json:"code" validate:"omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recoveryCode" validate:"omitempty,max=16"`
+}
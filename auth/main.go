@@ -1,10 +1,25 @@
 package main
 
-import "dfs/auth/microservice"
+import (
+	"dfs/auth/config"
+	"dfs/auth/microservice"
+)
 
 func main() {
-	authMicroservice := microservice.NewAuthMicroservice()
+	cfg := config.Create()
+
+	if cfg.RewrapKeys {
+		microservice.RewrapKeys(cfg)
+		return
+	}
+
+	if cfg.MakeAdmin != "" {
+		microservice.MakeAdmin(cfg)
+		return
+	}
+
+	authMicroservice := microservice.NewAuthMicroservice(cfg)
 	authMicroservice.Setup()
-	authMicroservice.Run()
 	defer authMicroservice.Cleanup()
+	authMicroservice.Run()
 }
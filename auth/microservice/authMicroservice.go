@@ -1,15 +1,30 @@
 package microservice
 
 import (
+	"context"
+	"dfs/common/discovery"
+	"dfs/common/masterkey"
 	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
 
 	"dfs/auth/config"
 	"dfs/auth/controllers"
 	"dfs/auth/database"
+	"dfs/auth/models"
 	"dfs/auth/services"
+	"dfs/common/audit"
+	"dfs/common/events"
+	"dfs/common/middleware"
+	"dfs/common/rpc"
+	"dfs/proto"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -19,40 +34,211 @@ type AuthMicroservice struct {
 	logger         *zap.Logger
 	app            *fiber.App
 	database       *gorm.DB
+	broker         *rpc.Connection
 	usrRepo        *database.UserRepository
 	vrfRepo        *database.VerificationRepository
+	rotRepo        *database.KeyRotationRepository
+	sessRepo       *database.SessionRepository
+	rcRepo         *database.RecoveryCodeRepository
+	throttleRepo   *database.LoginThrottleRepository
+	atRepo         *database.ApiTokenRepository
+	delRepo        *database.AccountDeletionRepository
+	dlRepo         *database.DeadLetterRepository
 	rpcClient      *services.RpcClient
-	rpcServer      *services.RpcServer
+	grpcServer     *services.GRpcAuthServer
 	mail           *services.MailService
-	authController *controllers.AuthController
+	keys           *masterkey.KeyService
+	tokens         *services.TokenService
+	keyRotation    *services.KeyRotationService
+	cleanup        *services.CleanupService
+	delSrv         *services.AccountDeletionService
+	dlSrv          *services.DeadLetterService
+	sessionCtrl    *controllers.SessionController
+	accountCtrl    *controllers.AccountController
+	userDataCtrl   *controllers.UserDataController
+	apiTokenCtrl   *controllers.ApiTokenController
+	keyRotCtrl     *controllers.KeyRotationController
+	adminCtrl      *controllers.AdminController
+	deadLetterCtrl *controllers.DeadLetterController
 }
 
-func NewAuthMicroservice() *AuthMicroservice {
-	cfg := config.Create()
-	loggerCfg := zap.NewDevelopmentConfig()
-	loggerCfg.EncoderConfig.FunctionKey = "func"
-	logger, err := loggerCfg.Build()
+func NewAuthMicroservice(cfg *config.Config) *AuthMicroservice {
+	logger := createLogger()
+
+	databaseService, err := database.Connect(cfg.DbConnectionString)
 
 	if err != nil {
-		log.Fatalf("Cannot initialize zap logger. Reason: %s", err)
+		log.Fatalf("Cannot initialize database service. Reason: %s", err)
 	}
 
-	databaseService, err := database.Connect(cfg.DbConnectionString)
+	keys, err := masterkey.NewKeyService(cfg.MasterKeys())
 
 	if err != nil {
-		log.Fatalf("Cannot initialize database service. Reason: %s", err)
+		log.Fatalf("Cannot initialize key service. Reason: %s", err)
+	}
+
+	tokens, err := services.NewTokenService(cfg, logger)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize token service. Reason: %s", err)
+	}
+
+	mailer, err := services.NewMailer(cfg, logger)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize mailer. Reason: %s", err)
+	}
+
+	mail, err := services.NewMailService(cfg, logger, mailer)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize mail service. Reason: %s", err)
+	}
+
+	broker, err := rpc.Dial(cfg.AmqpUrl, logger, cfg.AmqpConnectTimeout)
+
+	if err != nil {
+		log.Fatalf("Cannot connect to RabbitMQ. Reason: %s", err)
+	}
+
+	broker.SetWorkers(cfg.RpcWorkers)
+
+	rpcClient, err := services.NewRpcClient(logger, broker, cfg)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize RPC client. Reason: %s", err)
+	}
+
+	bus, err := events.NewBus(broker, logger, "auth")
+
+	if err != nil {
+		log.Fatalf("Cannot initialize event bus. Reason: %s", err)
 	}
 
 	app := fiber.New()
-	rpcClient := services.NewRpcClient(logger)
-	rpcServer := services.NewRpcServer(logger, databaseService)
 	usrRepo := database.NewUserRepository(databaseService, logger)
 	vrfRepo := database.NewVerificationRepository(databaseService, logger)
-	mail := services.NewMailService(logger)
-	authController := controllers.NewAuthController(logger, usrRepo, vrfRepo, mail, rpcClient)
+	rotRepo := database.NewKeyRotationRepository(databaseService, logger)
+	sessRepo := database.NewSessionRepository(databaseService, logger)
+	rcRepo := database.NewRecoveryCodeRepository(databaseService, logger)
+	throttleRepo := database.NewLoginThrottleRepository(databaseService, logger)
+	atRepo := database.NewApiTokenRepository(databaseService, logger)
+	delRepo := database.NewAccountDeletionRepository(databaseService, logger)
+	dlRepo := database.NewDeadLetterRepository(databaseService, logger)
+	grpcServer := services.NewGrpcAuthServer(logger, databaseService, keys, tokens, sessRepo, atRepo, cfg)
+	keyRotation := services.NewKeyRotationService(logger, rotRepo, usrRepo, keys, rpcClient)
+	totp := services.NewTotpService(cfg)
+	cleanup := services.NewCleanupService(cfg, logger, usrRepo, vrfRepo, rpcClient)
+	guard := services.NewLoginGuardService(cfg, logger, throttleRepo, bus)
+	oidc := services.NewOidcService(cfg, logger)
+	delSrv := services.NewAccountDeletionService(logger, delRepo, usrRepo, rpcClient, bus)
+	export := services.NewExportService(logger, keys, rpcClient, atRepo)
+	dlSrv := services.NewDeadLetterService(logger, broker, dlRepo)
+	// One limiter for all login and registration routes, so a client cannot spread its attempts over them
+	limiter := middleware.RateLimiter(middleware.RateLimiterConfig{
+		Max:      cfg.RateLimitMax,
+		Window:   cfg.RateLimitWindow,
+		MaxBlock: time.Hour,
+	})
+	searchLimiter := middleware.RateLimiter(middleware.RateLimiterConfig{
+		Max:      cfg.SearchRateLimit,
+		Window:   cfg.RateLimitWindow,
+		MaxBlock: time.Hour,
+	})
+	auth := controllers.NewAuthenticator(logger, usrRepo, sessRepo, atRepo, tokens, cfg)
+	sessionCtrl := controllers.NewSessionController(auth, logger, usrRepo, sessRepo, rcRepo, rpcClient, keys, tokens,
+		totp, guard, oidc, limiter, cfg)
+	accountCtrl := controllers.NewAccountController(auth, logger, usrRepo, vrfRepo, sessRepo, mail, rpcClient, keys,
+		bus, limiter, searchLimiter)
+	userDataCtrl := controllers.NewUserDataController(auth, logger, delRepo, delSrv, export, bus)
+	apiTokenCtrl := controllers.NewApiTokenController(auth, logger, atRepo, tokens)
+	keyRotCtrl := controllers.NewKeyRotationController(auth, logger, rotRepo, keyRotation, keys)
+	adminCtrl := controllers.NewAdminController(auth, logger, usrRepo, sessRepo, rpcClient, delSrv, bus)
+	deadLetterCtrl := controllers.NewDeadLetterController(auth, logger, dlRepo, dlSrv, bus)
+
+	return &AuthMicroservice{config: cfg, logger: logger, app: app, database: databaseService, broker: broker,
+		usrRepo: usrRepo, vrfRepo: vrfRepo, rotRepo: rotRepo, sessRepo: sessRepo, rcRepo: rcRepo,
+		throttleRepo: throttleRepo, atRepo: atRepo, delRepo: delRepo, rpcClient: rpcClient,
+		grpcServer: grpcServer, mail: mail, keys: keys, tokens: tokens, keyRotation: keyRotation, cleanup: cleanup,
+		dlRepo: dlRepo, delSrv: delSrv, dlSrv: dlSrv, sessionCtrl: sessionCtrl, accountCtrl: accountCtrl,
+		userDataCtrl: userDataCtrl, apiTokenCtrl: apiTokenCtrl, keyRotCtrl: keyRotCtrl, adminCtrl: adminCtrl,
+		deadLetterCtrl: deadLetterCtrl}
+}
+
+func RewrapKeys(cfg *config.Config) {
+	logger := createLogger()
+	defer logger.Sync()
 
-	return &AuthMicroservice{config: cfg, logger: logger, app: app, database: databaseService, usrRepo: usrRepo,
-		vrfRepo: vrfRepo, rpcClient: rpcClient, rpcServer: rpcServer, authController: authController}
+	databaseService, err := database.Connect(cfg.DbConnectionString)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize database service. Reason: %s", err)
+	}
+
+	keys, err := masterkey.NewKeyService(cfg.MasterKeys())
+
+	if err != nil {
+		log.Fatalf("Cannot initialize key service. Reason: %s", err)
+	}
+
+	usrRepo := database.NewUserRepository(databaseService, logger)
+
+	if usrRepo.RewrapCryptKeys(keys.RewrapKey) == false {
+		log.Fatal("Cannot rewrap users keys")
+	}
+}
+
+func MakeAdmin(cfg *config.Config) {
+	logger := createLogger()
+	defer logger.Sync()
+
+	databaseService, err := database.Connect(cfg.DbConnectionString)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize database service. Reason: %s", err)
+	}
+
+	broker, err := rpc.Dial(cfg.AmqpUrl, logger, cfg.AmqpConnectTimeout)
+
+	if err != nil {
+		log.Fatalf("Cannot connect to RabbitMQ. Reason: %s", err)
+	}
+
+	defer broker.Close()
+
+	bus, err := events.NewBus(broker, logger, "auth")
+
+	if err != nil {
+		log.Fatalf("Cannot initialize event bus. Reason: %s", err)
+	}
+
+	usrRepo := database.NewUserRepository(databaseService, logger)
+
+	user := usrRepo.GetUserByEmail(cfg.MakeAdmin)
+
+	if user == nil {
+		log.Fatalf("User '%s' does not exist", cfg.MakeAdmin)
+	}
+
+	if usrRepo.SetRole(user, models.RoleAdmin) == false {
+		log.Fatal("Cannot grant the admin role")
+	}
+
+	audit.Publish(context.Background(), bus, logger, events.AuditRecordedV1{Action: audit.AdminUserRoleGrant,
+		Resource: "user:" + strconv.Itoa(int(user.Id)), Result: audit.ResultSuccess,
+		Details: "admin granted from command line"})
+}
+
+func createLogger() *zap.Logger {
+	loggerCfg := zap.NewDevelopmentConfig()
+	loggerCfg.EncoderConfig.FunctionKey = "func"
+	logger, err := loggerCfg.Build()
+
+	if err != nil {
+		log.Fatalf("Cannot initialize zap logger. Reason: %s", err)
+	}
+
+	return logger
 }
 
 func (ams *AuthMicroservice) Setup() {
@@ -60,17 +246,65 @@ func (ams *AuthMicroservice) Setup() {
 		AllowCredentials: true,
 	}))
 
-	ams.authController.RegisterRoutes(ams.app)
+	ams.app.Get("/ready", middleware.Readiness(map[string]func() bool{"broker": ams.broker.Ready}))
+	ams.app.Use(middleware.Identity(ams.config.IdentitySecret))
+
+	ams.sessionCtrl.RegisterRoutes(ams.app)
+	ams.accountCtrl.RegisterRoutes(ams.app)
+	ams.userDataCtrl.RegisterRoutes(ams.app)
+	ams.apiTokenCtrl.RegisterRoutes(ams.app)
+	ams.keyRotCtrl.RegisterRoutes(ams.app)
+	ams.adminCtrl.RegisterRoutes(ams.app)
+	ams.deadLetterCtrl.RegisterRoutes(ams.app)
 }
 
 func (ams *AuthMicroservice) Run() {
-	go ams.rpcServer.RegisterGetUserDataByJwt()
-	go ams.rpcServer.RegisterGetUserDataById()
-	ams.app.Listen(":8080")
+	lis, err := net.Listen("tcp", ams.config.GrpcAddress)
+
+	if err != nil {
+		ams.Cleanup()
+		ams.logger.Panic("Cannot create listener for GRPC server", zap.Error(err))
+	}
+
+	grpcServer := rpc.NewGrpcServer(ams.config.IdentitySecret)
+	proto.RegisterAuthServer(grpcServer, ams.grpcServer)
+
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			ams.logger.Panic("Cannot serve GRPC server", zap.Error(err))
+		}
+	}()
+
+	ams.keyRotation.ResumeKeyRotations()
+	ams.delSrv.ResumeAccountDeletions()
+	ams.cleanup.Start()
+	ams.dlSrv.Start()
+	ams.HandleInterrupt()
+	ams.config.Discovery.Register(ams.logger, discovery.Instance{Service: "auth", Id: uuid.NewString(),
+		Endpoints: map[string]string{"http": ams.config.HttpAddress, "grpc": ams.config.GrpcAddress}})
+	ams.app.Listen(ams.config.HttpAddress)
+}
+
+func (ams *AuthMicroservice) HandleInterrupt() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		_ = <-c
+		ams.logger.Debug("Gracefully shutting down...")
+		_ = ams.app.Shutdown()
+	}()
 }
 
+// Cleanup lets the consumers finish the messages they already received, for at most the shutdown timeout.
 func (ams *AuthMicroservice) Cleanup() {
-	ams.logger.Sync()
-	ams.rpcServer.Close()
+	ams.config.Discovery.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), ams.config.ShutdownTimeout)
+	defer cancel()
+
+	if err := ams.broker.Shutdown(ctx); err != nil {
+		ams.logger.Warn("Cannot close RabbitMQ connection", zap.Error(err))
+	}
+
 	ams.rpcClient.Close()
+	ams.logger.Sync()
 }
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+type AccountDeletionStatus uint
+
+const (
+	DeletionInProgress AccountDeletionStatus = iota
+	DeletionCompleted  AccountDeletionStatus = iota
+	DeletionFailed     AccountDeletionStatus = iota
+)
+
+// AccountDeletion outlives the deleted user, so it only keeps the user id, which is not reused.
+type AccountDeletion struct {
+	Id         string                `json:"id" gorm:"primaryKey"`
+	UserId     uint                  `json:"-" gorm:"uniqueIndex"`
+	Status     AccountDeletionStatus `json:"status"`
+	StartedAt  time.Time             `json:"startedAt"`
+	FinishedAt time.Time             `json:"finishedAt"`
+}
@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+type ApiToken struct {
+	Id        uint   `json:"id"`
+	UserId    uint   `json:"userId" gorm:"index"`
+	Name      string `json:"name"`
+	TokenHash string `json:"-" gorm:"unique"`
+	// Space separated services the token can be used for, a ":read" suffix allows only reading
+	Scopes     string    `json:"scopes"`
+	CreatedAt  time.Time `json:"createdAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	LastUsedAt time.Time `json:"lastUsedAt"`
+	Revoked    bool      `json:"revoked"`
+}
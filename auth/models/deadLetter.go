@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// DeadLetter is a message that one of the services failed to handle, kept until an administrator replays it.
+type DeadLetter struct {
+	Id             uint       `json:"id"`
+	Queue          string     `json:"queue" gorm:"index"`
+	ContentType    string     `json:"contentType"`
+	Body           []byte     `json:"-"`
+	Error          string     `json:"error"`
+	Retries        int        `json:"retries"`
+	DeadLetteredAt time.Time  `json:"deadLetteredAt"`
+	ReplayedAt     *time.Time `json:"replayedAt"`
+}
@@ -2,9 +2,18 @@ package models
 
 import "time"
 
+type VerificationPurpose uint
+
+const (
+	PurposeEmailVerification VerificationPurpose = iota
+	PurposePasswordReset     VerificationPurpose = iota
+	PurposeEmailChange       VerificationPurpose = iota
+)
+
 type VerificationData struct {
-	Id        uint      `json:"id"`
-	Email     string    `json:"email" gorm:"unique"`
-	Code      string    `json:"code" gorm:"unique"`
-	ExpiresAt time.Time `json:"expiresAt"`
+	Id        uint                `json:"id"`
+	Email     string              `json:"email" gorm:"uniqueIndex:idx_verification_email_purpose"`
+	Purpose   VerificationPurpose `json:"purpose" gorm:"uniqueIndex:idx_verification_email_purpose"`
+	Code      string              `json:"code" gorm:"unique"`
+	ExpiresAt time.Time           `json:"expiresAt"`
 }
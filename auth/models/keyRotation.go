@@ -0,0 +1,28 @@
+package models
+
+import "time"
+
+type KeyRotationStatus uint
+
+const (
+	RotationInProgress KeyRotationStatus = iota
+	RotationCompleted  KeyRotationStatus = iota
+	RotationFailed     KeyRotationStatus = iota
+)
+
+type KeyRotation struct {
+	Id            uint              `json:"id"`
+	UserId        uint              `json:"userId"`
+	Status        KeyRotationStatus `json:"status"`
+	FilesListed   bool              `json:"-"`
+	TotalFiles    uint              `json:"totalFiles"`
+	MigratedFiles uint              `json:"migratedFiles"`
+	StartedAt     time.Time         `json:"startedAt"`
+	FinishedAt    time.Time         `json:"finishedAt"`
+}
+
+type KeyRotationFile struct {
+	RotationId uint   `gorm:"primaryKey;autoIncrement:false"`
+	FilePath   string `gorm:"primaryKey"`
+	Migrated   bool
+}
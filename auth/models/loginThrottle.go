@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginThrottle counts failed logins for a client IP ("ip:<address>") or an account ("account:<email>").
+type LoginThrottle struct {
+	Key            string    `json:"key" gorm:"primaryKey"`
+	FailedAttempts int       `json:"failedAttempts"`
+	LastFailedAt   time.Time `json:"lastFailedAt"`
+	LockedUntil    time.Time `json:"lockedUntil"`
+}
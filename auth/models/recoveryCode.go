@@ -0,0 +1,8 @@
+package models
+
+type RecoveryCode struct {
+	Id       uint   `json:"id"`
+	UserId   uint   `json:"userId" gorm:"index"`
+	CodeHash string `json:"-" gorm:"unique"`
+	Used     bool   `json:"used"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+type Session struct {
+	Id                       uint      `json:"id"`
+	UserId                   uint      `json:"userId" gorm:"index"`
+	RefreshTokenHash         string    `json:"-" gorm:"unique"`
+	PreviousRefreshTokenHash string    `json:"-" gorm:"index"`
+	CreatedAt                time.Time `json:"createdAt"`
+	RefreshedAt              time.Time `json:"refreshedAt"`
+	ExpiresAt                time.Time `json:"expiresAt"`
+	Revoked                  bool      `json:"revoked"`
+}
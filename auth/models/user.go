@@ -1,11 +1,24 @@
 package models
 
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
+)
+
 type User struct {
-	Id            uint   `json:"id"`
-	Name          string `json:"name"`
-	Email         string `json:"email" gorm:"unique"`
-	Password      []byte `json:"-"`
-	Verified      bool   `json:"-"`
-	HomeDirectory string `json:"directory"`
-	CryptKey      string `json:"cryptKey"`
+	Id               uint   `json:"id"`
+	Name             string `json:"name"`
+	Email            string `json:"email" gorm:"unique"`
+	Password         []byte `json:"-"`
+	Verified         bool   `json:"-"`
+	HomeDirectory    string `json:"directory"`
+	CryptKey         string `json:"cryptKey"`
+	PreviousCryptKey string `json:"-"`
+	TotpSecret       string `json:"-"`
+	TotpEnabled      bool   `json:"totpEnabled"`
+	TotpLastCounter  uint64 `json:"-"`
+	OidcSubject      string `json:"-" gorm:"index"`
+	Role             string `json:"role" gorm:"default:user"`
+	Disabled         bool   `json:"disabled"`
+	PendingEmail     string `json:"pendingEmail,omitempty" gorm:"index"`
 }
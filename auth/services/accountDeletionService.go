@@ -0,0 +1,113 @@
+package services
+
+import (
+	"context"
+	"dfs/auth/database"
+	"dfs/auth/models"
+	"dfs/common/events"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type AccountDeletionService struct {
+	logger   *zap.Logger
+	delRepo  *database.AccountDeletionRepository
+	userRepo *database.UserRepository
+	rpc      *RpcClient
+	events   *events.Bus
+	mutex    *sync.Mutex
+	running  map[string]bool
+}
+
+func NewAccountDeletionService(logger *zap.Logger, delRepo *database.AccountDeletionRepository,
+	userRepo *database.UserRepository, rpc *RpcClient, bus *events.Bus) *AccountDeletionService {
+	return &AccountDeletionService{logger: logger, delRepo: delRepo, userRepo: userRepo, rpc: rpc, events: bus,
+		mutex: &sync.Mutex{}, running: map[string]bool{}}
+}
+
+func (ads *AccountDeletionService) Start(deletionId string) {
+	ads.mutex.Lock()
+	defer ads.mutex.Unlock()
+
+	if ads.running[deletionId] {
+		return
+	}
+
+	ads.running[deletionId] = true
+
+	go func() {
+		ads.delete(deletionId)
+
+		ads.mutex.Lock()
+		delete(ads.running, deletionId)
+		ads.mutex.Unlock()
+	}()
+}
+
+func (ads *AccountDeletionService) ResumeAccountDeletions() {
+	for _, deletion := range ads.delRepo.GetAccountDeletionsInProgress() {
+		ads.logger.Info("Resuming account deletion", zap.String("DeletionId", deletion.Id),
+			zap.Uint("UserId", deletion.UserId))
+		ads.Start(deletion.Id)
+	}
+}
+
+// DeleteAccount removes the user's shares, ShareSpaces, files and home directory through the other services and then
+// the account itself. Every step can be repeated, so a failed deletion is retried by calling it again. The deletion
+// is announced with the user.deleted event, which lets the services clean up anything created in the meantime.
+func (ads *AccountDeletionService) DeleteAccount(ctx context.Context, user *models.User) bool {
+	if isDeleted, err := ads.rpc.DeleteUserShares(ctx, user.Id); isDeleted == false {
+		ads.logger.Error("Cannot delete user shares", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	if isRemoved, err := ads.rpc.RemoveShareSpaceUser(ctx, user.Id); isRemoved == false {
+		ads.logger.Error("Cannot remove user from ShareSpaces", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	if isDeleted, err := ads.rpc.DeleteOwnedFiles(ctx, user.Id); isDeleted == false {
+		ads.logger.Error("Cannot delete user files", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	if isDeleted, err := ads.rpc.DeleteHomeDirectory(ctx, user.HomeDirectory); isDeleted == false {
+		ads.logger.Error("Cannot delete home directory", zap.Uint("UserId", user.Id), zap.Error(err))
+		return false
+	}
+
+	// Published while the user still exists, a retry after a failed publish then finds the user and publishes again.
+	// The handlers of the event are idempotent.
+	err := ads.events.Publish(ctx, events.UserDeleted, 1, events.UserDeletedV1{UserId: user.Id})
+
+	if err != nil {
+		ads.logger.Error("Cannot publish event", zap.String("Event", events.UserDeleted), zap.Error(err))
+		return false
+	}
+
+	return ads.userRepo.DeleteUser(user)
+}
+
+func (ads *AccountDeletionService) delete(deletionId string) {
+	deletion := ads.delRepo.GetAccountDeletionById(deletionId)
+
+	if deletion == nil || deletion.Status != models.DeletionInProgress {
+		return
+	}
+
+	// A missing user means the account row was already removed by a previous attempt
+	user := ads.userRepo.GetUserById(deletion.UserId)
+
+	if user != nil && ads.DeleteAccount(context.Background(), user) == false {
+		ads.logger.Error("Account deletion failed", zap.String("DeletionId", deletion.Id),
+			zap.Uint("UserId", deletion.UserId))
+		ads.delRepo.UpdateAccountDeletionStatus(deletion, models.DeletionFailed)
+		return
+	}
+
+	if ads.delRepo.UpdateAccountDeletionStatus(deletion, models.DeletionCompleted) {
+		ads.logger.Info("Account deletion completed", zap.String("DeletionId", deletion.Id),
+			zap.Uint("UserId", deletion.UserId))
+	}
+}
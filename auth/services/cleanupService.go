@@ -0,0 +1,75 @@
+package services
+
+import (
+	"context"
+	"dfs/auth/config"
+	"dfs/auth/database"
+	"dfs/auth/models"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// CleanupService periodically removes expired verification data together with the registrations that were never
+// verified, including their home directories on the storage nodes, and cancels unconfirmed email changes.
+type CleanupService struct {
+	logger   *zap.Logger
+	userRepo *database.UserRepository
+	vrfRepo  *database.VerificationRepository
+	rpc      *RpcClient
+	interval time.Duration
+}
+
+func NewCleanupService(cfg *config.Config, logger *zap.Logger, userRepo *database.UserRepository,
+	vrfRepo *database.VerificationRepository, rpc *RpcClient) *CleanupService {
+	return &CleanupService{logger: logger, userRepo: userRepo, vrfRepo: vrfRepo, rpc: rpc,
+		interval: cfg.CleanupInterval}
+}
+
+func (cs *CleanupService) Start() {
+	go func() {
+		ticker := time.NewTicker(cs.interval)
+		defer ticker.Stop()
+
+		for {
+			cs.Cleanup()
+			<-ticker.C
+		}
+	}()
+}
+
+func (cs *CleanupService) Cleanup() {
+	expiredVerifications := cs.vrfRepo.GetExpiredVerifications()
+
+	var removedUsers int
+
+	for _, verification := range expiredVerifications {
+		if verification.Purpose == models.PurposeEmailVerification {
+			user := cs.userRepo.GetUserByEmail(verification.Email)
+
+			if user != nil && user.Verified == false {
+				// Keep the verification entry on failure, so the registration is retried on the next run
+				if isDeleted, err := cs.rpc.DeleteHomeDirectory(context.Background(), user.HomeDirectory); isDeleted == false {
+					cs.logger.Warn("Cannot delete home directory of unverified user", zap.Uint("UserId", user.Id),
+						zap.Error(err))
+					continue
+				}
+
+				if cs.userRepo.DeleteUnverifiedUser(user) == false {
+					continue
+				}
+
+				removedUsers++
+			}
+		} else if verification.Purpose == models.PurposeEmailChange {
+			cs.userRepo.ClearPendingEmail(verification.Email)
+		}
+
+		cs.vrfRepo.DeleteVerification(verification.Id)
+	}
+
+	if len(expiredVerifications) > 0 {
+		cs.logger.Info("Expired registrations cleaned up", zap.Int("Verifications", len(expiredVerifications)),
+			zap.Int("Users", removedUsers))
+	}
+}
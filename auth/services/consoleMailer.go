@@ -0,0 +1,18 @@
+package services
+
+import "go.uber.org/zap"
+
+type ConsoleMailer struct {
+	logger *zap.Logger
+}
+
+func NewConsoleMailer(logger *zap.Logger) *ConsoleMailer {
+	return &ConsoleMailer{logger: logger}
+}
+
+func (cm *ConsoleMailer) Send(message *MailMessage) error {
+	cm.logger.Info("Mail", zap.String("To", message.ToEmail), zap.String("Subject", message.Subject),
+		zap.String("Content", message.PlainText))
+
+	return nil
+}
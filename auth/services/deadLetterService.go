@@ -0,0 +1,54 @@
+package services
+
+import (
+	"context"
+	"dfs/auth/database"
+	"dfs/auth/models"
+	"dfs/common/rpc"
+	"errors"
+
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+// DeadLetterService stores the messages that the services of the cluster failed to handle, so administrators can
+// inspect them and send them to their queue again once the cause is fixed.
+type DeadLetterService struct {
+	logger *zap.Logger
+	broker *rpc.Connection
+	dlRepo *database.DeadLetterRepository
+}
+
+func NewDeadLetterService(logger *zap.Logger, broker *rpc.Connection,
+	dlRepo *database.DeadLetterRepository) *DeadLetterService {
+	return &DeadLetterService{logger: logger, broker: broker, dlRepo: dlRepo}
+}
+
+func (dls *DeadLetterService) Start() {
+	go dls.broker.Consume(rpc.DeadLetterQueue, func(ch *amqp.Channel, msg amqp.Delivery) error {
+		deadLetter := rpc.ParseDeadLetter(msg)
+
+		dls.logger.Warn("Dead letter received", zap.String("Queue", deadLetter.Queue),
+			zap.String("Error", deadLetter.Error))
+
+		// Rejected messages stay in the queue until the database is back
+		if dls.dlRepo.CreateDeadLetter(&models.DeadLetter{Queue: deadLetter.Queue, ContentType: deadLetter.ContentType,
+			Body: deadLetter.Body, Error: deadLetter.Error, Retries: deadLetter.Retries,
+			DeadLetteredAt: deadLetter.DeadLetteredAt}) == false {
+			return errors.New("cannot store dead letter")
+		}
+
+		return nil
+	})
+}
+
+// Replay publishes the message to its original queue again. Nobody waits for the response of a replayed request, so
+// it is not sent.
+func (dls *DeadLetterService) Replay(ctx context.Context, deadLetter *models.DeadLetter) bool {
+	if err := dls.broker.Send(ctx, deadLetter.Queue, deadLetter.ContentType, deadLetter.Body); err != nil {
+		dls.logger.Error("Cannot replay dead letter", zap.Uint("DeadLetterId", deadLetter.Id), zap.Error(err))
+		return false
+	}
+
+	return dls.dlRepo.MarkReplayed(deadLetter)
+}
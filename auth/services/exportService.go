@@ -0,0 +1,192 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"dfs/auth/database"
+	"dfs/auth/dtos"
+	"dfs/auth/models"
+	"dfs/common/masterkey"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// UserExport holds everything known about the user before the archive is written. Collecting it first lets the
+// request fail with a proper status, because once the archive is streamed the status cannot be changed anymore.
+type UserExport struct {
+	user        *models.User
+	files       []dtos.FileDto
+	shares      []dtos.UserShareDto
+	memberships []dtos.MembershipDto
+	apiTokens   []models.ApiToken
+	key         []byte
+	previousKey []byte
+}
+
+type ExportService struct {
+	logger *zap.Logger
+	keys   *masterkey.KeyService
+	rpc    *RpcClient
+	atRepo *database.ApiTokenRepository
+}
+
+func NewExportService(logger *zap.Logger, keys *masterkey.KeyService, rpc *RpcClient,
+	atRepo *database.ApiTokenRepository) *ExportService {
+	return &ExportService{logger: logger, keys: keys, rpc: rpc, atRepo: atRepo}
+}
+
+func (es *ExportService) Collect(ctx context.Context, user *models.User) (*UserExport, error) {
+	export := &UserExport{user: user}
+	var err error
+
+	if export.files, err = es.rpc.GetOwnedFiles(ctx, user.Id); err != nil {
+		return nil, fmt.Errorf("cannot get owned files: %w", err)
+	}
+
+	if export.shares, err = es.rpc.GetUserShares(ctx, user.Id); err != nil {
+		return nil, fmt.Errorf("cannot get shares: %w", err)
+	}
+
+	if export.memberships, err = es.rpc.GetShareSpaceMemberships(ctx, user.Id); err != nil {
+		return nil, fmt.Errorf("cannot get ShareSpace memberships: %w", err)
+	}
+
+	if export.apiTokens = es.atRepo.GetUserApiTokens(user.Id); export.apiTokens == nil {
+		return nil, errors.New("cannot get API tokens")
+	}
+
+	if export.key, err = es.decodeKey(user.CryptKey); err != nil {
+		return nil, err
+	}
+
+	if export.previousKey, err = es.decodeKey(user.PreviousCryptKey); err != nil {
+		return nil, err
+	}
+
+	return export, nil
+}
+
+// WriteArchive writes a zip archive with the account data, share metadata, ShareSpace memberships and decrypted owned
+// files. Files that cannot be read are listed in files.json as not exported instead of failing the whole archive.
+func (es *ExportService) WriteArchive(ctx context.Context, w io.Writer, export *UserExport) error {
+	archive := zip.NewWriter(w)
+
+	account := dtos.AccountExportDto{
+		Id:          export.user.Id,
+		Name:        export.user.Name,
+		Email:       export.user.Email,
+		Role:        export.user.Role,
+		TotpEnabled: export.user.TotpEnabled,
+		OidcLinked:  export.user.OidcSubject != "",
+		ApiTokens:   export.apiTokens,
+		ExportedAt:  time.Now(),
+	}
+
+	if err := writeJsonEntry(archive, "account.json", account); err != nil {
+		return err
+	}
+
+	if err := writeJsonEntry(archive, "shares.json", export.shares); err != nil {
+		return err
+	}
+
+	if err := writeJsonEntry(archive, "sharespaces.json", export.memberships); err != nil {
+		return err
+	}
+
+	exportedFiles := []dtos.ExportedFileDto{}
+	usedNames := map[string]bool{}
+
+	for _, file := range export.files {
+		exportedFile := dtos.ExportedFileDto{Name: file.Name, ClientEncrypted: file.ClientEncrypted,
+			KeyMetadata: file.KeyMetadata}
+
+		fileContent, err := es.rpc.ReadFileFromDisk(ctx, dtos.ReadFileDto{
+			ReadPath:              path.Join(export.user.HomeDirectory, file.UniqueName),
+			DecryptionKey:         export.key,
+			FallbackDecryptionKey: export.previousKey,
+			ClientEncrypted:       file.ClientEncrypted,
+		})
+
+		if err != nil {
+			es.logger.Warn("Cannot read file for export", zap.Uint("UserId", export.user.Id),
+				zap.String("UniqueName", file.UniqueName), zap.Error(err))
+			exportedFiles = append(exportedFiles, exportedFile)
+			continue
+		}
+
+		exportedFile.ArchivePath = archiveFileName(file, usedNames)
+		exportedFile.Exported = true
+
+		entry, err := archive.Create(exportedFile.ArchivePath)
+
+		if err != nil {
+			return err
+		}
+
+		if _, err := entry.Write(fileContent); err != nil {
+			return err
+		}
+
+		exportedFiles = append(exportedFiles, exportedFile)
+	}
+
+	if err := writeJsonEntry(archive, "files.json", exportedFiles); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+func (es *ExportService) decodeKey(wrapped string) ([]byte, error) {
+	if wrapped == "" {
+		return nil, nil
+	}
+
+	key, err := es.keys.UnwrapKey(wrapped)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(key)
+}
+
+func writeJsonEntry(archive *zip.Writer, name string, value interface{}) error {
+	entry, err := archive.Create(name)
+
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(entry)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(value)
+}
+
+// archiveFileName keeps only the base name of the uploaded file, so the archive cannot write outside of its directory
+// when extracted, and prefixes duplicates with the unique name.
+func archiveFileName(file dtos.FileDto, usedNames map[string]bool) string {
+	name := path.Base(strings.ReplaceAll(file.Name, "\\", "/"))
+
+	if name == "." || name == "/" || name == ".." {
+		name = file.UniqueName
+	}
+
+	if usedNames[name] {
+		name = file.UniqueName + "_" + name
+	}
+
+	usedNames[name] = true
+
+	return path.Join("files", name)
+}
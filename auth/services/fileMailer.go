@@ -0,0 +1,48 @@
+package services
+
+import (
+	"dfs/auth/config"
+	"fmt"
+	"net/mail"
+	"os"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// FileMailer drops every message as an .eml file into a directory instead of sending it.
+type FileMailer struct {
+	logger    *zap.Logger
+	from      mail.Address
+	directory string
+}
+
+func NewFileMailer(cfg *config.Config, logger *zap.Logger) *FileMailer {
+	return &FileMailer{logger: logger, from: mail.Address{Name: cfg.MailFromName, Address: cfg.MailFromAddress},
+		directory: cfg.MailDropDirectory}
+}
+
+func (fm *FileMailer) Send(message *MailMessage) error {
+	content, err := buildMimeMessage(fm.from, message)
+
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(fm.directory, 0750); err != nil {
+		return err
+	}
+
+	fileName := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102T150405"), uuid.New().String())
+	filePath := path.Join(fm.directory, fileName)
+
+	if err := os.WriteFile(filePath, content, 0640); err != nil {
+		return err
+	}
+
+	fm.logger.Info("Mail saved to file", zap.String("To", message.ToEmail), zap.String("Path", filePath))
+
+	return nil
+}
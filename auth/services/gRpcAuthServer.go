@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"dfs/auth/config"
+	"dfs/auth/database"
+	"dfs/auth/models"
+	"dfs/common/masterkey"
+	"dfs/proto"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+type GRpcAuthServer struct {
+	proto.UnimplementedAuthServer
+	logger    *zap.Logger
+	db        *gorm.DB
+	keys      *masterkey.KeyService
+	tokens    *TokenService
+	sessRepo  *database.SessionRepository
+	tokenRepo *database.ApiTokenRepository
+	cfg       *config.Config
+}
+
+func NewGrpcAuthServer(logger *zap.Logger, db *gorm.DB, keys *masterkey.KeyService, tokens *TokenService,
+	sessRepo *database.SessionRepository, tokenRepo *database.ApiTokenRepository, cfg *config.Config) *GRpcAuthServer {
+	return &GRpcAuthServer{logger: logger, db: db, keys: keys, tokens: tokens, sessRepo: sessRepo,
+		tokenRepo: tokenRepo, cfg: cfg}
+}
+
+func (gas *GRpcAuthServer) GetUserDataByJwt(_ context.Context, req *proto.JwtRequest) (*proto.UserData, error) {
+	accessToken, err := gas.tokens.ParseToken(req.Jwt)
+
+	if err != nil {
+		gas.logger.Warn("Cannot parse token", zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	if gas.sessRepo.IsSessionActive(accessToken.SessionId, accessToken.UserId) == false {
+		gas.logger.Debug("Session is not active", zap.Uint("SessionId", accessToken.SessionId))
+		return nil, status.Error(codes.Unauthenticated, "session is not active")
+	}
+
+	return gas.getActiveUser(accessToken.UserId)
+}
+
+func (gas *GRpcAuthServer) GetUserDataByApiToken(_ context.Context,
+	req *proto.ApiTokenRequest) (*proto.UserData, error) {
+	apiToken := gas.tokenRepo.GetActiveApiToken(gas.tokens.HashApiToken(req.Token))
+
+	if apiToken == nil {
+		gas.logger.Debug("API token is not active")
+		return nil, status.Error(codes.Unauthenticated, "API token is not active")
+	}
+
+	if ApiTokenAllows(apiToken, req.Scope, req.ReadOnly) == false {
+		gas.logger.Debug("API token scope does not allow the request", zap.Uint("TokenId", apiToken.Id),
+			zap.String("Scope", req.Scope), zap.Bool("ReadOnly", req.ReadOnly))
+		return nil, status.Error(codes.Unauthenticated, "API token scope does not allow the request")
+	}
+
+	userData, err := gas.getActiveUser(apiToken.UserId)
+
+	// Recording every request would mean a write per call, a minute is precise enough
+	if err == nil && time.Since(apiToken.LastUsedAt) > time.Minute {
+		gas.tokenRepo.UpdateLastUsed(apiToken)
+	}
+
+	return userData, err
+}
+
+func (gas *GRpcAuthServer) GetUserDataById(_ context.Context, req *proto.UserIdRequest) (*proto.UserData, error) {
+	var user models.User
+
+	if err := gas.db.Where("id = ?", req.UserId).First(&user).Error; err != nil {
+		gas.logger.Debug("Cannot find user with id", zap.Uint64("UserID", req.UserId))
+		return nil, status.Error(codes.NotFound, "user does not exist")
+	}
+
+	return gas.createUserData(&user)
+}
+
+// getActiveUser returns the user a token was issued for, unless the user is disabled or has to enroll two-factor
+// authentication first.
+func (gas *GRpcAuthServer) getActiveUser(userId uint) (*proto.UserData, error) {
+	var user models.User
+
+	if err := gas.db.Where("id = ?", userId).First(&user).Error; err != nil {
+		gas.logger.Debug("Cannot find user", zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "user does not exist")
+	}
+
+	if user.Disabled {
+		gas.logger.Debug("User is disabled", zap.Uint("UserId", user.Id))
+		return nil, status.Error(codes.Unauthenticated, "user is disabled")
+	}
+
+	if gas.cfg.RequireTwoFactor && user.TotpEnabled == false {
+		gas.logger.Debug("User has not enrolled two-factor authentication", zap.Uint("UserId", user.Id))
+		return nil, status.Error(codes.Unauthenticated, "two-factor authentication is required")
+	}
+
+	return gas.createUserData(&user)
+}
+
+func (gas *GRpcAuthServer) createUserData(user *models.User) (*proto.UserData, error) {
+	cryptKey, err := gas.keys.UnwrapKey(user.CryptKey)
+
+	if err != nil {
+		gas.logger.Error("Cannot unwrap user key", zap.Uint("UserId", user.Id), zap.Error(err))
+		return nil, status.Error(codes.Internal, "cannot unwrap user key")
+	}
+
+	var previousCryptKey string
+
+	if user.PreviousCryptKey != "" {
+		previousCryptKey, err = gas.keys.UnwrapKey(user.PreviousCryptKey)
+
+		if err != nil {
+			gas.logger.Error("Cannot unwrap previous user key", zap.Uint("UserId", user.Id), zap.Error(err))
+			return nil, status.Error(codes.Internal, "cannot unwrap previous user key")
+		}
+	}
+
+	return &proto.UserData{
+		Id:               uint64(user.Id),
+		Name:             user.Name,
+		Email:            user.Email,
+		Verified:         user.Verified,
+		HomeDirectory:    user.HomeDirectory,
+		CryptKey:         cryptKey,
+		PreviousCryptKey: previousCryptKey,
+		Role:             user.Role,
+	}, nil
+}
+
+// ApiTokenAllows reports whether the token grants access to the service, a ":read" scope only for read only requests.
+func ApiTokenAllows(apiToken *models.ApiToken, scope string, readOnly bool) bool {
+	for _, tokenScope := range strings.Fields(apiToken.Scopes) {
+		if tokenScope == scope || (readOnly && tokenScope == scope+":read") {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,38 @@
+package services
+
+import (
+	"dfs/auth/models"
+	"testing"
+)
+
+func TestApiTokenAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		scopes   string
+		scope    string
+		readOnly bool
+		allowed  bool
+	}{
+		{"scope", "storage", "storage", false, true},
+		{"scope for reading", "storage", "storage", true, true},
+		{"one of several scopes", "share storage webhook", "storage", false, true},
+		{"extra spaces", "  share   storage ", "storage", false, true},
+		{"read scope for reading", "storage:read", "storage", true, true},
+		{"read scope for writing", "storage:read", "storage", false, false},
+		{"other scope", "share", "storage", true, false},
+		{"scope prefix", "storage", "stor", true, false},
+		{"read scope of other service", "share:read", "storage", true, false},
+		{"without scopes", "", "storage", true, false},
+		{"request without scope", "storage", "", true, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			apiToken := &models.ApiToken{Scopes: test.scopes}
+
+			if allowed := ApiTokenAllows(apiToken, test.scope, test.readOnly); allowed != test.allowed {
+				t.Fatalf("expected %t, got %t", test.allowed, allowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"context"
+	"dfs/auth/database"
+	"dfs/auth/dtos"
+	"dfs/auth/models"
+	"dfs/common/masterkey"
+	"encoding/base64"
+	"sync"
+
+	"go.uber.org/zap"
+)
+
+type KeyRotationService struct {
+	logger   *zap.Logger
+	rotRepo  *database.KeyRotationRepository
+	userRepo *database.UserRepository
+	keys     *masterkey.KeyService
+	rpc      *RpcClient
+	mutex    *sync.Mutex
+	running  map[uint]bool
+}
+
+func NewKeyRotationService(logger *zap.Logger, rotRepo *database.KeyRotationRepository,
+	userRepo *database.UserRepository, keys *masterkey.KeyService, rpc *RpcClient) *KeyRotationService {
+	return &KeyRotationService{logger: logger, rotRepo: rotRepo, userRepo: userRepo, keys: keys, rpc: rpc,
+		mutex: &sync.Mutex{}, running: map[uint]bool{}}
+}
+
+func (krs *KeyRotationService) Start(rotationId uint) {
+	krs.mutex.Lock()
+	defer krs.mutex.Unlock()
+
+	if krs.running[rotationId] {
+		return
+	}
+
+	krs.running[rotationId] = true
+
+	go func() {
+		krs.migrate(rotationId)
+
+		krs.mutex.Lock()
+		delete(krs.running, rotationId)
+		krs.mutex.Unlock()
+	}()
+}
+
+func (krs *KeyRotationService) ResumeKeyRotations() {
+	for _, rotation := range krs.rotRepo.GetKeyRotationsInProgress() {
+		krs.logger.Info("Resuming key rotation", zap.Uint("RotationId", rotation.Id),
+			zap.Uint("UserId", rotation.UserId))
+		krs.Start(rotation.Id)
+	}
+}
+
+func (krs *KeyRotationService) migrate(rotationId uint) {
+	rotation := krs.rotRepo.GetKeyRotationById(rotationId)
+
+	if rotation == nil || rotation.Status != models.RotationInProgress {
+		return
+	}
+
+	user := krs.userRepo.GetUserById(rotation.UserId)
+
+	if user == nil {
+		krs.fail(rotation, "Cannot find user")
+		return
+	}
+
+	newKey, err := krs.decodeKey(user.CryptKey)
+
+	if err != nil {
+		krs.fail(rotation, "Cannot decode new user key", zap.Error(err))
+		return
+	}
+
+	oldKey, err := krs.decodeKey(user.PreviousCryptKey)
+
+	if err != nil {
+		krs.fail(rotation, "Cannot decode previous user key", zap.Error(err))
+		return
+	}
+
+	if rotation.FilesListed == false {
+		filesPath, err := krs.rpc.ListDirectory(context.Background(), user.HomeDirectory)
+
+		if err != nil {
+			krs.fail(rotation, "Cannot list user home directory", zap.Error(err))
+			return
+		}
+
+		if krs.rotRepo.AddKeyRotationFiles(rotation, filesPath) == false {
+			krs.fail(rotation, "Cannot save files to migrate")
+			return
+		}
+	}
+
+	pendingFiles := krs.rotRepo.GetPendingKeyRotationFiles(rotation.Id)
+
+	if pendingFiles == nil {
+		krs.fail(rotation, "Cannot get files to migrate")
+		return
+	}
+
+	for i := range pendingFiles {
+		file := &pendingFiles[i]
+
+		reEncryptFileDto := dtos.ReEncryptFileDto{FilePath: file.FilePath, OldKey: oldKey, NewKey: newKey}
+
+		if isReEncrypted, err := krs.rpc.ReEncryptFile(context.Background(), reEncryptFileDto); isReEncrypted == false {
+			krs.fail(rotation, "Cannot re-encrypt file", zap.String("FilePath", file.FilePath), zap.Error(err))
+			return
+		}
+
+		if krs.rotRepo.MarkKeyRotationFileMigrated(file) == false {
+			krs.fail(rotation, "Cannot save key rotation progress", zap.String("FilePath", file.FilePath))
+			return
+		}
+	}
+
+	if krs.rotRepo.CompleteKeyRotation(rotation) == false {
+		krs.fail(rotation, "Cannot complete key rotation")
+		return
+	}
+
+	krs.logger.Info("Key rotation completed", zap.Uint("RotationId", rotation.Id), zap.Uint("UserId", user.Id))
+}
+
+func (krs *KeyRotationService) decodeKey(wrapped string) ([]byte, error) {
+	key, err := krs.keys.UnwrapKey(wrapped)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(key)
+}
+
+func (krs *KeyRotationService) fail(rotation *models.KeyRotation, msg string, fields ...zap.Field) {
+	fields = append(fields, zap.Uint("RotationId", rotation.Id), zap.Uint("UserId", rotation.UserId))
+	krs.logger.Error(msg, fields...)
+	krs.rotRepo.UpdateKeyRotationStatus(rotation, models.RotationFailed)
+}
@@ -0,0 +1,122 @@
+package services
+
+import (
+	"context"
+	"dfs/auth/config"
+	"dfs/auth/database"
+	"dfs/auth/models"
+	"dfs/common/audit"
+	"dfs/common/events"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+const (
+	// Failed attempts allowed before every next attempt has to wait
+	freeLoginAttempts = 3
+	loginBackoffBase  = time.Second
+)
+
+type LoginGuardService struct {
+	cfg          *config.Config
+	logger       *zap.Logger
+	throttleRepo *database.LoginThrottleRepository
+	events       *events.Bus
+}
+
+func NewLoginGuardService(cfg *config.Config, logger *zap.Logger, throttleRepo *database.LoginThrottleRepository,
+	bus *events.Bus) *LoginGuardService {
+	return &LoginGuardService{cfg: cfg, logger: logger, throttleRepo: throttleRepo, events: bus}
+}
+
+// Check reports whether a login attempt from the IP address for the email is allowed now. Otherwise it returns how
+// long the client has to wait.
+func (lgs *LoginGuardService) Check(ipAddress string, email string) (time.Duration, bool) {
+	var wait time.Duration
+
+	for _, key := range []string{ipKey(ipAddress), accountKey(email)} {
+		throttle := lgs.throttleRepo.GetLoginThrottle(key)
+
+		if throttle == nil {
+			continue
+		}
+
+		if remaining := lgs.remainingDelay(throttle); remaining > wait {
+			wait = remaining
+		}
+	}
+
+	return wait, wait == 0
+}
+
+// RegisterFailure counts a failed attempt for both the IP address and the account. Reaching the configured limit
+// locks logins for the lockout duration and reports it to the audit log.
+func (lgs *LoginGuardService) RegisterFailure(ctx context.Context, ipAddress string, email string, userId uint) {
+	resetBefore := time.Now().Add(-lgs.cfg.LoginLockout)
+
+	if throttle := lgs.throttleRepo.RegisterFailedAttempt(accountKey(email), resetBefore); throttle != nil &&
+		throttle.FailedAttempts >= lgs.cfg.LoginMaxAttempts {
+		lgs.lock(ctx, throttle, userId, ipAddress)
+	}
+
+	if throttle := lgs.throttleRepo.RegisterFailedAttempt(ipKey(ipAddress), resetBefore); throttle != nil &&
+		throttle.FailedAttempts >= lgs.cfg.LoginIpMaxAttempts {
+		lgs.lock(ctx, throttle, 0, ipAddress)
+	}
+}
+
+func (lgs *LoginGuardService) RegisterSuccess(email string) {
+	lgs.throttleRepo.DeleteLoginThrottle(accountKey(email))
+}
+
+func (lgs *LoginGuardService) remainingDelay(throttle *models.LoginThrottle) time.Duration {
+	now := time.Now()
+
+	if now.Before(throttle.LockedUntil) {
+		return throttle.LockedUntil.Sub(now)
+	}
+
+	if throttle.FailedAttempts <= freeLoginAttempts || now.Sub(throttle.LastFailedAt) > lgs.cfg.LoginLockout {
+		return 0
+	}
+
+	delay := loginBackoffBase << (throttle.FailedAttempts - freeLoginAttempts - 1)
+
+	if delay > lgs.cfg.LoginLockout || delay <= 0 {
+		delay = lgs.cfg.LoginLockout
+	}
+
+	if allowedAt := throttle.LastFailedAt.Add(delay); now.Before(allowedAt) {
+		return allowedAt.Sub(now)
+	}
+
+	return 0
+}
+
+func (lgs *LoginGuardService) lock(ctx context.Context, throttle *models.LoginThrottle, userId uint,
+	ipAddress string) {
+	lockedUntil := time.Now().Add(lgs.cfg.LoginLockout)
+
+	if lgs.throttleRepo.Lock(throttle.Key, lockedUntil) == false {
+		return
+	}
+
+	lgs.logger.Warn("Login locked after too many failed attempts", zap.String("Key", throttle.Key),
+		zap.Time("LockedUntil", lockedUntil))
+
+	audit.Publish(ctx, lgs.events, lgs.logger, events.AuditRecordedV1{ActorId: userId, Action: audit.LoginLockout,
+		Resource: throttle.Key, Ip: ipAddress, Result: audit.ResultSuccess,
+		Details: fmt.Sprintf("locked until %s after %d failed attempts", lockedUntil.Format(time.RFC3339),
+			throttle.FailedAttempts)})
+}
+
+func ipKey(ipAddress string) string {
+	return "ip:" + ipAddress
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
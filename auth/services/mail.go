@@ -1,40 +1,93 @@
 package services
 
 import (
-	"fmt"
+	"bytes"
+	"dfs/auth/config"
+	"embed"
+	htmltemplate "html/template"
+	"io/fs"
 	"os"
+	"strings"
+	texttemplate "text/template"
 
-	"github.com/sendgrid/sendgrid-go"
-	"github.com/sendgrid/sendgrid-go/helpers/mail"
 	"go.uber.org/zap"
 )
 
+//go:embed templates
+var defaultTemplates embed.FS
+
 type MailService struct {
-	logger *zap.Logger
+	logger        *zap.Logger
+	mailer        Mailer
+	publicBaseUrl string
+	textTemplates *texttemplate.Template
+	htmlTemplates *htmltemplate.Template
 }
 
-func NewMailService(logger *zap.Logger) *MailService {
-	return &MailService{logger: logger}
+type mailTemplateData struct {
+	Name string
+	Link string
+	Code string
 }
 
-func (ms *MailService) SendMail(userName string, userEmail string, code string) error {
-	from := mail.NewEmail("DFS Team", "dfs.pk.proj@gmail.com")
-	subject := "Email verification for DFS"
-	to := mail.NewEmail(userName, userEmail)
+// NewMailService loads message templates from cfg.MailTemplatesDir, or uses the built-in ones when it is not set.
+func NewMailService(cfg *config.Config, logger *zap.Logger, mailer Mailer) (*MailService, error) {
+	var templates fs.FS
 
-	plainTextContent := fmt.Sprintf("Go there and verify your account: http://localhost/api/verify/%s", code)
-	htmlContent := fmt.Sprintf("Go there and verify your account: <a href=\"http://localhost/api/verify/%s\">DFS Account verification</a>", code)
+	if cfg.MailTemplatesDir != "" {
+		templates = os.DirFS(cfg.MailTemplatesDir)
+	} else {
+		var err error
 
-	message := mail.NewSingleEmail(from, subject, to, plainTextContent, htmlContent)
-	client := sendgrid.NewSendClient(os.Getenv("SENDGRID_API_KEY"))
-	response, err := client.Send(message)
+		if templates, err = fs.Sub(defaultTemplates, "templates"); err != nil {
+			return nil, err
+		}
+	}
+
+	textTemplates, err := texttemplate.ParseFS(templates, "*.txt.tmpl")
 
 	if err != nil {
+		return nil, err
+	}
+
+	htmlTemplates, err := htmltemplate.ParseFS(templates, "*.html.tmpl")
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &MailService{logger: logger, mailer: mailer, publicBaseUrl: strings.TrimSuffix(cfg.PublicBaseUrl, "/"),
+		textTemplates: textTemplates, htmlTemplates: htmlTemplates}, nil
+}
+
+func (ms *MailService) SendMail(userName string, userEmail string, code string) error {
+	data := mailTemplateData{Name: userName, Link: ms.publicBaseUrl + "/api/verify/" + code}
+	return ms.send(userName, userEmail, "Email verification for DFS", "verification", data)
+}
+
+func (ms *MailService) SendPasswordResetMail(userName string, userEmail string, code string) error {
+	data := mailTemplateData{Name: userName, Code: code}
+	return ms.send(userName, userEmail, "Password reset for DFS", "passwordReset", data)
+}
+
+func (ms *MailService) SendEmailChangeMail(userName string, newEmail string, code string) error {
+	data := mailTemplateData{Name: userName, Link: ms.publicBaseUrl + "/api/user/email/verify/" + code}
+	return ms.send(userName, newEmail, "Email address change for DFS", "emailChange", data)
+}
+
+func (ms *MailService) send(userName string, userEmail string, subject string, templateName string,
+	data mailTemplateData) error {
+	var plainText bytes.Buffer
+	var html bytes.Buffer
+
+	if err := ms.textTemplates.ExecuteTemplate(&plainText, templateName+".txt.tmpl", data); err != nil {
+		return err
+	}
+
+	if err := ms.htmlTemplates.ExecuteTemplate(&html, templateName+".html.tmpl", data); err != nil {
 		return err
-	} else {
-		ms.logger.Debug("Response status code: {Code}", zap.Int("Code", response.StatusCode))
-		ms.logger.Debug("Response body: {Body}", zap.String("Body", response.Body))
-		ms.logger.Debug("Response headers: {Headers}", zap.Any("Headers", response.Headers))
-		return nil
 	}
+
+	return ms.mailer.Send(&MailMessage{ToName: userName, ToEmail: userEmail, Subject: subject,
+		PlainText: plainText.String(), Html: html.String()})
 }
@@ -0,0 +1,118 @@
+package services
+
+import (
+	"dfs/auth/config"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestMailServiceWithFileMailer(t *testing.T) {
+	tests := []struct {
+		name     string
+		send     func(ms *MailService) error
+		subject  string
+		expected string
+	}{
+		{"verification", func(ms *MailService) error {
+			return ms.SendMail("User", "user@example.com", "verification-code")
+		}, "Email verification for DFS", "https://dfs.example.com/api/verify/verification-code"},
+		{"password reset", func(ms *MailService) error {
+			return ms.SendPasswordResetMail("User", "user@example.com", "reset-code")
+		}, "Password reset for DFS", "reset-code"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			cfg := &config.Config{MailFromName: "DFS", MailFromAddress: "noreply@example.com",
+				MailDropDirectory: path.Join(t.TempDir(), "mail"), PublicBaseUrl: "https://dfs.example.com/"}
+
+			ms, err := NewMailService(cfg, zap.NewNop(), NewFileMailer(cfg, zap.NewNop()))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if err := test.send(ms); err != nil {
+				t.Fatal(err)
+			}
+
+			files, err := os.ReadDir(cfg.MailDropDirectory)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(files) != 1 {
+				t.Fatalf("expected 1 message, got %d", len(files))
+			}
+
+			file, err := os.Open(path.Join(cfg.MailDropDirectory, files[0].Name()))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer file.Close()
+
+			message, err := mail.ReadMessage(file)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if to := message.Header.Get("To"); to != `"User" <user@example.com>` {
+				t.Fatalf("unexpected recipient %s", to)
+			}
+
+			if subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject")); err != nil ||
+				subject != test.subject {
+				t.Fatalf("unexpected subject %s", subject)
+			}
+
+			_, params, err := mime.ParseMediaType(message.Header.Get("Content-Type"))
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			reader := multipart.NewReader(message.Body, params["boundary"])
+			parts := 0
+
+			for {
+				part, err := reader.NextPart()
+
+				if err == io.EOF {
+					break
+				}
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				content, err := io.ReadAll(part)
+
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if strings.Contains(string(content), test.expected) == false {
+					t.Fatalf("%s part does not contain %s:\n%s", part.Header.Get("Content-Type"), test.expected,
+						content)
+				}
+
+				parts++
+			}
+
+			if parts != 2 {
+				t.Fatalf("expected a plain text and an HTML part, got %d parts", parts)
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"dfs/auth/config"
+	"fmt"
+
+	"go.uber.org/zap"
+)
+
+type MailMessage struct {
+	ToName    string
+	ToEmail   string
+	Subject   string
+	PlainText string
+	Html      string
+}
+
+type Mailer interface {
+	Send(message *MailMessage) error
+}
+
+func NewMailer(cfg *config.Config, logger *zap.Logger) (Mailer, error) {
+	switch cfg.MailTransport {
+	case "sendgrid":
+		return NewSendGridMailer(cfg, logger), nil
+	case "smtp":
+		return NewSmtpMailer(cfg), nil
+	case "file":
+		return NewFileMailer(cfg, logger), nil
+	case "console":
+		return NewConsoleMailer(logger), nil
+	default:
+		return nil, fmt.Errorf("unknown mail transport '%s'", cfg.MailTransport)
+	}
+}
@@ -0,0 +1,344 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"dfs/auth/config"
+	"dfs/auth/dtos"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JwksUri               string `json:"jwks_uri"`
+}
+
+type oidcTokenResponse struct {
+	IdToken string `json:"id_token"`
+}
+
+type oidcClaims struct {
+	jwt.RegisteredClaims
+	Nonce         string      `json:"nonce"`
+	Email         string      `json:"email"`
+	EmailVerified interface{} `json:"email_verified"`
+	Name          string      `json:"name"`
+}
+
+// OidcIdentity is the user identity asserted by the identity provider in a verified ID token.
+type OidcIdentity struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// OidcLoginState binds the callback to the login request started in the same browser.
+type OidcLoginState struct {
+	State        string
+	Nonce        string
+	CodeVerifier string
+}
+
+type OidcService struct {
+	cfg       *config.Config
+	logger    *zap.Logger
+	client    *http.Client
+	mutex     sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]interface{}
+}
+
+func NewOidcService(cfg *config.Config, logger *zap.Logger) *OidcService {
+	return &OidcService{cfg: cfg, logger: logger, client: &http.Client{Timeout: time.Second * 10},
+		keys: map[string]interface{}{}}
+}
+
+func (oidc *OidcService) Enabled() bool {
+	return oidc.cfg.OidcIssuerUrl != ""
+}
+
+func (oidc *OidcService) NewLoginState() (*OidcLoginState, error) {
+	values := make([]string, 3)
+
+	for i := range values {
+		value := make([]byte, 32)
+
+		if _, err := rand.Read(value); err != nil {
+			return nil, err
+		}
+
+		values[i] = base64.RawURLEncoding.EncodeToString(value)
+	}
+
+	return &OidcLoginState{State: values[0], Nonce: values[1], CodeVerifier: values[2]}, nil
+}
+
+// AuthCodeUrl returns the identity provider URL the browser is redirected to. The code challenge (PKCE) makes the
+// authorization code useless without the verifier kept by the auth service.
+func (oidc *OidcService) AuthCodeUrl(loginState *OidcLoginState) (string, error) {
+	discovery, err := oidc.getDiscovery()
+
+	if err != nil {
+		return "", err
+	}
+
+	challenge := sha256.Sum256([]byte(loginState.CodeVerifier))
+
+	query := url.Values{}
+	query.Set("response_type", "code")
+	query.Set("client_id", oidc.cfg.OidcClientId)
+	query.Set("redirect_uri", oidc.cfg.OidcRedirectUrl)
+	query.Set("scope", "openid email profile")
+	query.Set("state", loginState.State)
+	query.Set("nonce", loginState.Nonce)
+	query.Set("code_challenge", base64.RawURLEncoding.EncodeToString(challenge[:]))
+	query.Set("code_challenge_method", "S256")
+
+	separator := "?"
+
+	if strings.Contains(discovery.AuthorizationEndpoint, "?") {
+		separator = "&"
+	}
+
+	return discovery.AuthorizationEndpoint + separator + query.Encode(), nil
+}
+
+// Exchange redeems the authorization code at the token endpoint and returns the identity from the verified ID token.
+func (oidc *OidcService) Exchange(code string, loginState *OidcLoginState) (*OidcIdentity, error) {
+	discovery, err := oidc.getDiscovery()
+
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", oidc.cfg.OidcRedirectUrl)
+	form.Set("client_id", oidc.cfg.OidcClientId)
+	form.Set("client_secret", oidc.cfg.OidcClientSecret)
+	form.Set("code_verifier", loginState.CodeVerifier)
+
+	response, err := oidc.client.PostForm(discovery.TokenEndpoint, form)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint responded with status %d", response.StatusCode)
+	}
+
+	var tokenResponse oidcTokenResponse
+
+	if err := json.NewDecoder(response.Body).Decode(&tokenResponse); err != nil {
+		return nil, err
+	}
+
+	if tokenResponse.IdToken == "" {
+		return nil, errors.New("token response does not contain an ID token")
+	}
+
+	return oidc.verifyIdToken(tokenResponse.IdToken, discovery, loginState.Nonce)
+}
+
+func (oidc *OidcService) verifyIdToken(rawToken string, discovery *oidcDiscovery, nonce string) (*OidcIdentity, error) {
+	token, err := jwt.ParseWithClaims(rawToken, &oidcClaims{}, func(token *jwt.Token) (interface{}, error) {
+		keyId, _ := token.Header["kid"].(string)
+		key, err := oidc.getKey(keyId, discovery)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch key.(type) {
+		case *rsa.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodRSA); ok == false {
+				return nil, fmt.Errorf("unexpected signing method '%s'", token.Method.Alg())
+			}
+		case ed25519.PublicKey:
+			if _, ok := token.Method.(*jwt.SigningMethodEd25519); ok == false {
+				return nil, fmt.Errorf("unexpected signing method '%s'", token.Method.Alg())
+			}
+		}
+
+		return key, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	claims := token.Claims.(*oidcClaims)
+
+	if claims.VerifyIssuer(discovery.Issuer, true) == false {
+		return nil, fmt.Errorf("unexpected ID token issuer '%s'", claims.Issuer)
+	}
+
+	if claims.VerifyAudience(oidc.cfg.OidcClientId, true) == false {
+		return nil, errors.New("ID token was issued for another client")
+	}
+
+	if claims.ExpiresAt == nil {
+		return nil, errors.New("ID token does not expire")
+	}
+
+	if claims.Nonce != nonce {
+		return nil, errors.New("ID token nonce does not match")
+	}
+
+	if claims.Subject == "" {
+		return nil, errors.New("ID token does not contain a subject")
+	}
+
+	// Some providers send email_verified as a string
+	emailVerified := claims.EmailVerified == true || claims.EmailVerified == "true"
+
+	return &OidcIdentity{Subject: claims.Subject, Email: claims.Email, EmailVerified: emailVerified,
+		Name: claims.Name}, nil
+}
+
+func (oidc *OidcService) getDiscovery() (*oidcDiscovery, error) {
+	oidc.mutex.Lock()
+	defer oidc.mutex.Unlock()
+
+	if oidc.discovery != nil {
+		return oidc.discovery, nil
+	}
+
+	var discovery oidcDiscovery
+	issuer := strings.TrimSuffix(oidc.cfg.OidcIssuerUrl, "/")
+
+	if err := oidc.getJson(issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("cannot get OIDC discovery document: %w", err)
+	}
+
+	if strings.TrimSuffix(discovery.Issuer, "/") != issuer {
+		return nil, fmt.Errorf("discovered issuer '%s' does not match the configured one", discovery.Issuer)
+	}
+
+	oidc.discovery = &discovery
+
+	return oidc.discovery, nil
+}
+
+// getKey returns the provider key with the given id. Unknown ids reload the key set, so rotated provider keys are
+// picked up.
+func (oidc *OidcService) getKey(keyId string, discovery *oidcDiscovery) (interface{}, error) {
+	oidc.mutex.Lock()
+	defer oidc.mutex.Unlock()
+
+	if key, ok := oidc.keys[keyId]; ok {
+		return key, nil
+	}
+
+	var jwks dtos.Jwks
+
+	if err := oidc.getJson(discovery.JwksUri, &jwks); err != nil {
+		return nil, fmt.Errorf("cannot get OIDC provider keys: %w", err)
+	}
+
+	keys := map[string]interface{}{}
+
+	for _, jwk := range jwks.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+
+		key, err := parseJwk(jwk)
+
+		if err != nil {
+			oidc.logger.Warn("Skipping OIDC provider key", zap.String("Kid", jwk.Kid), zap.Error(err))
+			continue
+		}
+
+		keys[jwk.Kid] = key
+	}
+
+	oidc.keys = keys
+
+	if key, ok := oidc.keys[keyId]; ok {
+		return key, nil
+	}
+
+	// A provider with a single key does not have to name it in the token
+	if keyId == "" && len(oidc.keys) == 1 {
+		for _, key := range oidc.keys {
+			return key, nil
+		}
+	}
+
+	return nil, fmt.Errorf("unknown OIDC provider key '%s'", keyId)
+}
+
+func (oidc *OidcService) getJson(url string, target interface{}) error {
+	response, err := oidc.client.Get(url)
+
+	if err != nil {
+		return err
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s responded with status %d", url, response.StatusCode)
+	}
+
+	return json.NewDecoder(response.Body).Decode(target)
+}
+
+func parseJwk(jwk dtos.Jwk) (interface{}, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve '%s'", jwk.Crv)
+		}
+
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type '%s'", jwk.Kty)
+	}
+}
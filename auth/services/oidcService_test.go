@@ -0,0 +1,176 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"dfs/auth/config"
+	"dfs/auth/dtos"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+func TestVerifyIdToken(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	otherRsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edPublicKey, edPrivateKey, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(dtos.Jwks{Keys: []dtos.Jwk{
+			{Kty: "RSA", Use: "sig", Alg: "RS256", Kid: "rsa",
+				N: base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+				E: base64.RawURLEncoding.EncodeToString(big.NewInt(int64(rsaKey.E)).Bytes())},
+			{Kty: "OKP", Use: "sig", Alg: "EdDSA", Kid: "ed", Crv: "Ed25519",
+				X: base64.RawURLEncoding.EncodeToString(edPublicKey)},
+		}})
+	}))
+	defer idp.Close()
+
+	discovery := &oidcDiscovery{Issuer: idp.URL, JwksUri: idp.URL + "/jwks"}
+	oidc := NewOidcService(&config.Config{OidcClientId: "dfs"}, zap.NewNop())
+
+	validClaims := func() oidcClaims {
+		return oidcClaims{
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    idp.URL,
+				Subject:   "subject",
+				Audience:  jwt.ClaimStrings{"dfs"},
+				ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+			},
+			Nonce:         "nonce",
+			Email:         "user@example.com",
+			EmailVerified: true,
+			Name:          "User",
+		}
+	}
+
+	sign := func(method jwt.SigningMethod, key interface{}, keyId string, claims oidcClaims) string {
+		token := jwt.NewWithClaims(method, claims)
+
+		if keyId != "" {
+			token.Header["kid"] = keyId
+		}
+
+		signed, err := token.SignedString(key)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return signed
+	}
+
+	tests := []struct {
+		name          string
+		token         func() string
+		valid         bool
+		emailVerified bool
+	}{
+		{"RS256", func() string {
+			return sign(jwt.SigningMethodRS256, rsaKey, "rsa", validClaims())
+		}, true, true},
+		{"EdDSA", func() string {
+			return sign(jwt.SigningMethodEdDSA, edPrivateKey, "ed", validClaims())
+		}, true, true},
+		{"email verified as string", func() string {
+			claims := validClaims()
+			claims.EmailVerified = "true"
+			return sign(jwt.SigningMethodRS256, rsaKey, "rsa", claims)
+		}, true, true},
+		{"email not verified", func() string {
+			claims := validClaims()
+			claims.EmailVerified = false
+			return sign(jwt.SigningMethodRS256, rsaKey, "rsa", claims)
+		}, true, false},
+		{"other issuer", func() string {
+			claims := validClaims()
+			claims.Issuer = "https://idp.example.com"
+			return sign(jwt.SigningMethodRS256, rsaKey, "rsa", claims)
+		}, false, false},
+		{"other audience", func() string {
+			claims := validClaims()
+			claims.Audience = jwt.ClaimStrings{"other"}
+			return sign(jwt.SigningMethodRS256, rsaKey, "rsa", claims)
+		}, false, false},
+		{"expired", func() string {
+			claims := validClaims()
+			claims.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute))
+			return sign(jwt.SigningMethodRS256, rsaKey, "rsa", claims)
+		}, false, false},
+		{"without expiry", func() string {
+			claims := validClaims()
+			claims.ExpiresAt = nil
+			return sign(jwt.SigningMethodRS256, rsaKey, "rsa", claims)
+		}, false, false},
+		{"other nonce", func() string {
+			claims := validClaims()
+			claims.Nonce = "other"
+			return sign(jwt.SigningMethodRS256, rsaKey, "rsa", claims)
+		}, false, false},
+		{"without subject", func() string {
+			claims := validClaims()
+			claims.Subject = ""
+			return sign(jwt.SigningMethodRS256, rsaKey, "rsa", claims)
+		}, false, false},
+		{"signed by another key", func() string {
+			return sign(jwt.SigningMethodRS256, otherRsaKey, "rsa", validClaims())
+		}, false, false},
+		{"unknown key", func() string {
+			return sign(jwt.SigningMethodRS256, rsaKey, "unknown", validClaims())
+		}, false, false},
+		{"without key id", func() string {
+			return sign(jwt.SigningMethodRS256, rsaKey, "", validClaims())
+		}, false, false},
+		{"signing method of another key", func() string {
+			return sign(jwt.SigningMethodEdDSA, edPrivateKey, "rsa", validClaims())
+		}, false, false},
+		{"HS256 with the public key", func() string {
+			return sign(jwt.SigningMethodHS256, rsaKey.N.Bytes(), "rsa", validClaims())
+		}, false, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			identity, err := oidc.verifyIdToken(test.token(), discovery, "nonce")
+
+			if test.valid == false {
+				if err == nil {
+					t.Fatal("expected the ID token to be rejected")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if identity.Subject != "subject" || identity.Email != "user@example.com" || identity.Name != "User" ||
+				identity.EmailVerified != test.emailVerified {
+				t.Fatalf("unexpected identity %+v", identity)
+			}
+		})
+	}
+}
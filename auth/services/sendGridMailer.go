@@ -0,0 +1,41 @@
+package services
+
+import (
+	"dfs/auth/config"
+	"fmt"
+
+	"github.com/sendgrid/sendgrid-go"
+	"github.com/sendgrid/sendgrid-go/helpers/mail"
+	"go.uber.org/zap"
+)
+
+type SendGridMailer struct {
+	logger *zap.Logger
+	from   *mail.Email
+	client *sendgrid.Client
+}
+
+func NewSendGridMailer(cfg *config.Config, logger *zap.Logger) *SendGridMailer {
+	return &SendGridMailer{logger: logger, from: mail.NewEmail(cfg.MailFromName, cfg.MailFromAddress),
+		client: sendgrid.NewSendClient(cfg.SendGridApiKey)}
+}
+
+func (sgm *SendGridMailer) Send(message *MailMessage) error {
+	to := mail.NewEmail(message.ToName, message.ToEmail)
+	email := mail.NewSingleEmail(sgm.from, message.Subject, to, message.PlainText, message.Html)
+	response, err := sgm.client.Send(email)
+
+	if err != nil {
+		return err
+	}
+
+	sgm.logger.Debug("Response status code: {Code}", zap.Int("Code", response.StatusCode))
+	sgm.logger.Debug("Response body: {Body}", zap.String("Body", response.Body))
+	sgm.logger.Debug("Response headers: {Headers}", zap.Any("Headers", response.Headers))
+
+	if response.StatusCode >= 300 {
+		return fmt.Errorf("SendGrid responded with status code %d", response.StatusCode)
+	}
+
+	return nil
+}
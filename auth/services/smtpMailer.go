@@ -0,0 +1,85 @@
+package services
+
+import (
+	"bytes"
+	"dfs/auth/config"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"time"
+)
+
+type SmtpMailer struct {
+	address string
+	from    mail.Address
+	auth    smtp.Auth
+}
+
+func NewSmtpMailer(cfg *config.Config) *SmtpMailer {
+	var auth smtp.Auth = nil
+
+	if cfg.SmtpUsername != "" {
+		auth = smtp.PlainAuth("", cfg.SmtpUsername, cfg.SmtpPassword, cfg.SmtpHost)
+	}
+
+	return &SmtpMailer{address: cfg.SmtpHost + ":" + strconv.Itoa(cfg.SmtpPort),
+		from: mail.Address{Name: cfg.MailFromName, Address: cfg.MailFromAddress}, auth: auth}
+}
+
+// Send delivers the message through the configured server. net/smtp upgrades the connection with STARTTLS
+// whenever the server supports it.
+func (sm *SmtpMailer) Send(message *MailMessage) error {
+	content, err := buildMimeMessage(sm.from, message)
+
+	if err != nil {
+		return err
+	}
+
+	return smtp.SendMail(sm.address, sm.auth, sm.from.Address, []string{message.ToEmail}, content)
+}
+
+func buildMimeMessage(from mail.Address, message *MailMessage) ([]byte, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+
+	parts := []struct {
+		contentType string
+		content     string
+	}{
+		{"text/plain; charset=UTF-8", message.PlainText},
+		{"text/html; charset=UTF-8", message.Html},
+	}
+
+	for _, part := range parts {
+		partWriter, err := writer.CreatePart(textproto.MIMEHeader{"Content-Type": {part.contentType}})
+
+		if err != nil {
+			return nil, err
+		}
+
+		if _, err := partWriter.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := writer.Close(); err != nil {
+		return nil, err
+	}
+
+	to := mail.Address{Name: message.ToName, Address: message.ToEmail}
+
+	var content bytes.Buffer
+	fmt.Fprintf(&content, "From: %s\r\n", from.String())
+	fmt.Fprintf(&content, "To: %s\r\n", to.String())
+	fmt.Fprintf(&content, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", message.Subject))
+	fmt.Fprintf(&content, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&content, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&content, "Content-Type: multipart/alternative; boundary=%s\r\n\r\n", writer.Boundary())
+	content.Write(body.Bytes())
+
+	return content.Bytes(), nil
+}
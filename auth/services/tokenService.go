@@ -0,0 +1,326 @@
+package services
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"dfs/auth/config"
+	"dfs/auth/dtos"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.uber.org/zap"
+)
+
+const (
+	pendingTokenAudience = "two-factor"
+	apiTokenPrefix       = "dfs_"
+)
+
+// keystoreFile lists the signing keys by id and the id of the key new tokens are signed with
+type keystoreFile struct {
+	CurrentKeyId string            `json:"currentKeyId"`
+	Keys         map[string]string `json:"keys"`
+}
+
+type signingKey struct {
+	private interface{}
+	public  interface{}
+}
+
+type AccessToken struct {
+	UserId    uint
+	SessionId uint
+}
+
+type TokenService struct {
+	logger       *zap.Logger
+	method       jwt.SigningMethod
+	currentKeyId string
+	keys         map[string]signingKey
+}
+
+func NewTokenService(cfg *config.Config, logger *zap.Logger) (*TokenService, error) {
+	method := jwt.GetSigningMethod(cfg.JwtSigningMethod)
+
+	if method == nil || (method != jwt.SigningMethodHS256 && method != jwt.SigningMethodRS256 &&
+		method != jwt.SigningMethodEdDSA) {
+		return nil, fmt.Errorf("unsupported JWT signing method '%s'", cfg.JwtSigningMethod)
+	}
+
+	ts := &TokenService{logger: logger, method: method, keys: map[string]signingKey{}}
+
+	if cfg.JwtKeystorePath != "" {
+		if err := ts.loadKeystore(cfg.JwtKeystorePath); err != nil {
+			return nil, err
+		}
+	} else if method == jwt.SigningMethodHS256 && cfg.JwtSecretKey != "" {
+		if err := ts.addSigningKey(cfg.JwtKeyId, cfg.JwtSecretKey); err != nil {
+			return nil, err
+		}
+
+		ts.currentKeyId = cfg.JwtKeyId
+	} else if method != jwt.SigningMethodHS256 && cfg.JwtPrivateKeyPath != "" {
+		if err := ts.addSigningKey(cfg.JwtKeyId, cfg.JwtPrivateKeyPath); err != nil {
+			return nil, err
+		}
+
+		ts.currentKeyId = cfg.JwtKeyId
+	} else {
+		return nil, errors.New("JWT signing key is not configured")
+	}
+
+	if _, ok := ts.keys[ts.currentKeyId]; ok == false {
+		return nil, fmt.Errorf("current JWT signing key '%s' is not available", ts.currentKeyId)
+	}
+
+	return ts, nil
+}
+
+func (ts *TokenService) CreateToken(userId uint, sessionId uint, expiresAt time.Time) (string, error) {
+	token := jwt.NewWithClaims(ts.method, jwt.RegisteredClaims{
+		Issuer:    strconv.Itoa(int(userId)),
+		ID:        strconv.Itoa(int(sessionId)),
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+
+	token.Header["kid"] = ts.currentKeyId
+
+	return token.SignedString(ts.keys[ts.currentKeyId].private)
+}
+
+// CreatePendingToken issues a token proving that the password was checked, which can only be exchanged for a session
+// after the second factor is verified.
+func (ts *TokenService) CreatePendingToken(userId uint, expiresAt time.Time) (string, error) {
+	token := jwt.NewWithClaims(ts.method, jwt.RegisteredClaims{
+		Issuer:    strconv.Itoa(int(userId)),
+		Audience:  jwt.ClaimStrings{pendingTokenAudience},
+		ExpiresAt: jwt.NewNumericDate(expiresAt),
+	})
+
+	token.Header["kid"] = ts.currentKeyId
+
+	return token.SignedString(ts.keys[ts.currentKeyId].private)
+}
+
+func (ts *TokenService) ParsePendingToken(rawToken string) (uint, error) {
+	claims, err := ts.parseClaims(rawToken)
+
+	if err != nil {
+		return 0, err
+	}
+
+	if claims.VerifyAudience(pendingTokenAudience, true) == false {
+		return 0, errors.New("token is not a pending login token")
+	}
+
+	userId, err := strconv.ParseUint(claims.Issuer, 10, 0)
+
+	if err != nil {
+		return 0, fmt.Errorf("invalid token issuer: %w", err)
+	}
+
+	return uint(userId), nil
+}
+
+func (ts *TokenService) ParseToken(rawToken string) (*AccessToken, error) {
+	claims, err := ts.parseClaims(rawToken)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(claims.Audience) != 0 {
+		return nil, errors.New("token is not an access token")
+	}
+
+	userId, err := strconv.ParseUint(claims.Issuer, 10, 0)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid token issuer: %w", err)
+	}
+
+	sessionId, err := strconv.ParseUint(claims.ID, 10, 0)
+
+	if err != nil {
+		return nil, fmt.Errorf("invalid token session: %w", err)
+	}
+
+	return &AccessToken{UserId: uint(userId), SessionId: uint(sessionId)}, nil
+}
+
+// parseClaims verifies the token with the key named by its kid header. Tokens issued before key ids were introduced
+// are verified with the current key.
+func (ts *TokenService) parseClaims(rawToken string) (*jwt.RegisteredClaims, error) {
+	token, err := jwt.ParseWithClaims(rawToken, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != ts.method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method '%s'", token.Method.Alg())
+		}
+
+		keyId, ok := token.Header["kid"].(string)
+
+		if ok == false {
+			keyId = ts.currentKeyId
+		}
+
+		key, ok := ts.keys[keyId]
+
+		if ok == false {
+			return nil, fmt.Errorf("unknown JWT signing key '%s'", keyId)
+		}
+
+		return key.public, nil
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	return token.Claims.(*jwt.RegisteredClaims), nil
+}
+
+// CreateRefreshToken returns a random refresh token and the hash under which it is stored.
+func (ts *TokenService) CreateRefreshToken() (string, string, error) {
+	token := make([]byte, 32)
+
+	if _, err := rand.Read(token); err != nil {
+		return "", "", err
+	}
+
+	refreshToken := base64.RawURLEncoding.EncodeToString(token)
+
+	return refreshToken, ts.HashRefreshToken(refreshToken), nil
+}
+
+func (ts *TokenService) HashRefreshToken(refreshToken string) string {
+	hash := sha256.Sum256([]byte(refreshToken))
+	return hex.EncodeToString(hash[:])
+}
+
+// CreateApiToken returns a random personal API token and the hash under which it is stored. The prefix makes leaked
+// tokens easy to recognize.
+func (ts *TokenService) CreateApiToken() (string, string, error) {
+	token := make([]byte, 32)
+
+	if _, err := rand.Read(token); err != nil {
+		return "", "", err
+	}
+
+	apiToken := apiTokenPrefix + base64.RawURLEncoding.EncodeToString(token)
+
+	return apiToken, ts.HashApiToken(apiToken), nil
+}
+
+func (ts *TokenService) HashApiToken(apiToken string) string {
+	hash := sha256.Sum256([]byte(apiToken))
+	return hex.EncodeToString(hash[:])
+}
+
+// Jwks returns public keys of all configured signing keys. Shared secrets are never published, so the set is empty
+// for HS256.
+func (ts *TokenService) Jwks() dtos.Jwks {
+	jwks := dtos.Jwks{Keys: []dtos.Jwk{}}
+
+	for keyId, key := range ts.keys {
+		switch publicKey := key.public.(type) {
+		case *rsa.PublicKey:
+			jwks.Keys = append(jwks.Keys, dtos.Jwk{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: ts.method.Alg(),
+				Kid: keyId,
+				N:   base64.RawURLEncoding.EncodeToString(publicKey.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(publicKey.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			jwks.Keys = append(jwks.Keys, dtos.Jwk{
+				Kty: "OKP",
+				Use: "sig",
+				Alg: ts.method.Alg(),
+				Kid: keyId,
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(publicKey),
+			})
+		}
+	}
+
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].Kid < jwks.Keys[j].Kid
+	})
+
+	return jwks
+}
+
+func (ts *TokenService) loadKeystore(keystorePath string) error {
+	content, err := os.ReadFile(keystorePath)
+
+	if err != nil {
+		return err
+	}
+
+	var keystore keystoreFile
+
+	if err := json.Unmarshal(content, &keystore); err != nil {
+		return err
+	}
+
+	for keyId, key := range keystore.Keys {
+		if err := ts.addSigningKey(keyId, key); err != nil {
+			return err
+		}
+	}
+
+	ts.currentKeyId = keystore.CurrentKeyId
+
+	return nil
+}
+
+// addSigningKey registers a shared secret for HS256 or a path to a PEM encoded private key for RS256 and EdDSA.
+func (ts *TokenService) addSigningKey(keyId string, key string) error {
+	if keyId == "" {
+		return errors.New("JWT signing key id cannot be empty")
+	}
+
+	if ts.method == jwt.SigningMethodHS256 {
+		ts.keys[keyId] = signingKey{private: []byte(key), public: []byte(key)}
+		return nil
+	}
+
+	pemKey, err := os.ReadFile(key)
+
+	if err != nil {
+		return err
+	}
+
+	var privateKey crypto.Signer
+
+	if ts.method == jwt.SigningMethodRS256 {
+		privateKey, err = jwt.ParseRSAPrivateKeyFromPEM(pemKey)
+	} else {
+		var edKey crypto.PrivateKey
+		edKey, err = jwt.ParseEdPrivateKeyFromPEM(pemKey)
+
+		if err == nil {
+			privateKey = edKey.(crypto.Signer)
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("cannot parse JWT signing key '%s': %w", keyId, err)
+	}
+
+	ts.keys[keyId] = signingKey{private: privateKey, public: privateKey.Public()}
+
+	return nil
+}
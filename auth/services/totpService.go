@@ -0,0 +1,121 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/subtle"
+	"dfs/auth/config"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	totpPeriod            = 30
+	totpDigits            = 6
+	totpSkew              = 1
+	recoveryCodesCount    = 10
+	recoveryCodeByteCount = 5
+)
+
+type TotpService struct {
+	issuer string
+}
+
+func NewTotpService(cfg *config.Config) *TotpService {
+	return &TotpService{issuer: cfg.TotpIssuer}
+}
+
+func (ts *TotpService) GenerateSecret() (string, error) {
+	secret := make([]byte, 20)
+
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret), nil
+}
+
+func (ts *TotpService) ProvisioningUri(accountName string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", ts.issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(ts.issuer + ":" + accountName)
+
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, query.Encode())
+}
+
+// ValidateCode checks the code against the time steps around now. Codes from a step not later than lastCounter are
+// rejected, so a code cannot be used twice. The matched step is returned to be stored as the new lastCounter.
+func (ts *TotpService) ValidateCode(secret string, code string, lastCounter uint64) (uint64, bool) {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(strings.ToUpper(secret))
+
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := uint64(time.Now().Unix()) / totpPeriod
+
+	for counter := current - totpSkew; counter <= current+totpSkew; counter++ {
+		if counter <= lastCounter {
+			continue
+		}
+
+		if subtle.ConstantTimeCompare([]byte(ts.generateCode(key, counter)), []byte(code)) == 1 {
+			return counter, true
+		}
+	}
+
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns new recovery codes together with their hashes.
+func (ts *TotpService) GenerateRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodesCount)
+	hashes := make([]string, 0, recoveryCodesCount)
+
+	for i := 0; i < recoveryCodesCount; i++ {
+		code := make([]byte, recoveryCodeByteCount)
+
+		if _, err := rand.Read(code); err != nil {
+			return nil, nil, err
+		}
+
+		encoded := hex.EncodeToString(code)
+		formatted := encoded[:5] + "-" + encoded[5:]
+
+		codes = append(codes, formatted)
+		hashes = append(hashes, ts.HashRecoveryCode(formatted))
+	}
+
+	return codes, hashes, nil
+}
+
+func (ts *TotpService) HashRecoveryCode(code string) string {
+	hash := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(code))))
+	return hex.EncodeToString(hash[:])
+}
+
+func (ts *TotpService) generateCode(key []byte, counter uint64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
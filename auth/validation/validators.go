@@ -10,7 +10,9 @@ import (
 var validate = validator.New()
 var _ = validate.RegisterValidation("password", validatePasswordComplexity)
 
-func Validate[V dtos.LoginDto | dtos.RegisterDto](v *V) []string {
+func Validate[V dtos.LoginDto | dtos.RegisterDto | dtos.TwoFactorCodeDto | dtos.TwoFactorLoginDto |
+	dtos.ResendVerificationDto | dtos.ForgotPasswordDto | dtos.ResetPasswordDto | dtos.ChangePasswordDto |
+	dtos.CreateApiTokenDto | dtos.UpdateProfileDto](v *V) []string {
 	var invalidFields []string
 	err := validate.Struct(v)
 
@@ -0,0 +1,75 @@
+package audit
+
+import (
+	"context"
+	"dfs/common/events"
+	"dfs/common/middleware"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// Actions recorded by the services
+const (
+	FileUpload             = "file.upload"
+	FileDownload           = "file.download"
+	FileDelete             = "file.delete"
+	ShareCreate            = "share.create"
+	ShareDelete            = "share.delete"
+	ShareDownload          = "share.download"
+	ShareSpaceCreate       = "sharespace.create"
+	ShareSpaceDelete       = "sharespace.delete"
+	ShareSpaceMemberAdd    = "sharespace.member.add"
+	ShareSpaceMemberRemove = "sharespace.member.remove"
+	ShareSpaceFileUpload   = "sharespace.file.upload"
+	ShareSpaceFileDownload = "sharespace.file.download"
+	ShareSpaceFileDelete   = "sharespace.file.delete"
+	UserExport             = "user.export"
+	UserDelete             = "user.delete"
+	UserEmailChange        = "user.email.change"
+	LoginLockout           = "login.lockout"
+	AdminUserDisable       = "admin.user.disable"
+	AdminUserEnable        = "admin.user.enable"
+	AdminUserDelete        = "admin.user.delete"
+	AdminUserRoleGrant     = "admin.user.role.grant"
+	AdminDeadLetterReplay  = "admin.dead_letter.replay"
+	AuditExport            = "audit.export"
+)
+
+const (
+	ResultSuccess = "success"
+	ResultDenied  = "denied"
+	ResultFailure = "failure"
+)
+
+// Record publishes the record once the handler has answered, with the client IP and the result of the response
+// status, so handlers defer it as soon as the actor is known. Failures are only logged, the action already happened.
+func Record(c *fiber.Ctx, bus *events.Bus, logger *zap.Logger, record events.AuditRecordedV1) {
+	record.Ip = middleware.ClientIp(c)
+
+	if record.Result == "" {
+		record.Result = ResultOf(c.Response().StatusCode())
+	}
+
+	Publish(c.UserContext(), bus, logger, record)
+}
+
+// Publish publishes a record of an action outside of a request, with the Ip and Result set by the caller.
+func Publish(ctx context.Context, bus *events.Bus, logger *zap.Logger, record events.AuditRecordedV1) {
+	if err := bus.Publish(ctx, events.AuditRecorded, 1, record); err != nil {
+		logger.Error("Cannot publish event", zap.String("Event", events.AuditRecorded),
+			zap.String("Action", record.Action), zap.Error(err))
+	}
+}
+
+// ResultOf maps the HTTP status of the response to the result of the action.
+func ResultOf(status int) string {
+	switch {
+	case status < fiber.StatusBadRequest:
+		return ResultSuccess
+	case status == fiber.StatusUnauthorized || status == fiber.StatusForbidden:
+		return ResultDenied
+	default:
+		return ResultFailure
+	}
+}
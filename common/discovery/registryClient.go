@@ -0,0 +1,92 @@
+package discovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+type registryClient struct {
+	baseUrl string
+	token   string
+	client  *http.Client
+}
+
+func newRegistryClient(baseUrl string, token string) *registryClient {
+	return &registryClient{baseUrl: strings.TrimSuffix(baseUrl, "/"), token: token,
+		client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+func (rc *registryClient) register(service string, id string, registration Registration) error {
+	body, err := json.Marshal(registration)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = rc.do(http.MethodPut, rc.instanceUrl(service, id), body)
+	return err
+}
+
+func (rc *registryClient) deregister(service string, id string) error {
+	_, err := rc.do(http.MethodDelete, rc.instanceUrl(service, id), nil)
+	return err
+}
+
+func (rc *registryClient) lookup(service string) ([]Instance, error) {
+	body, err := rc.do(http.MethodGet, rc.baseUrl+"/api/instances/"+url.PathEscape(service), nil)
+
+	if err != nil {
+		return nil, err
+	}
+
+	var instances []Instance
+
+	if err := json.Unmarshal(body, &instances); err != nil {
+		return nil, err
+	}
+
+	return instances, nil
+}
+
+func (rc *registryClient) instanceUrl(service string, id string) string {
+	return rc.baseUrl + "/api/instances/" + url.PathEscape(service) + "/" + url.PathEscape(id)
+}
+
+func (rc *registryClient) do(method string, requestUrl string, body []byte) ([]byte, error) {
+	req, err := http.NewRequest(method, requestUrl, bytes.NewReader(body))
+
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	if rc.token != "" {
+		req.Header.Set("Authorization", "Bearer "+rc.token)
+	}
+
+	res, err := rc.client.Do(req)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer res.Body.Close()
+
+	var response bytes.Buffer
+
+	if _, err := response.ReadFrom(res.Body); err != nil {
+		return nil, err
+	}
+
+	if res.StatusCode >= http.StatusMultipleChoices {
+		return nil, fmt.Errorf("registry answered %d", res.StatusCode)
+	}
+
+	return response.Bytes(), nil
+}
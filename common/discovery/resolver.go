@@ -0,0 +1,92 @@
+package discovery
+
+import (
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+const scheme = "discovery"
+
+// refreshInterval is how often a gRPC connection looks the instances of its service up again.
+const refreshInterval = 10 * time.Second
+
+// Calls are spread over all instances instead of going to the first one
+const serviceConfig = `{"loadBalancingConfig": [{"round_robin": {}}]}`
+
+type resolverBuilder struct {
+	discovery *Discovery
+}
+
+func (rb *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn,
+	_ resolver.BuildOptions) (resolver.Resolver, error) {
+	gr := &grpcResolver{discovery: rb.discovery, service: strings.TrimPrefix(target.URL.Path, "/"), cc: cc,
+		resolveNow: make(chan struct{}, 1), done: make(chan struct{})}
+
+	go gr.watch()
+
+	return gr, nil
+}
+
+func (rb *resolverBuilder) Scheme() string {
+	return scheme
+}
+
+type grpcResolver struct {
+	discovery  *Discovery
+	service    string
+	cc         resolver.ClientConn
+	resolveNow chan struct{}
+	done       chan struct{}
+}
+
+func (gr *grpcResolver) watch() {
+	ticker := time.NewTicker(refreshInterval)
+	defer ticker.Stop()
+
+	for {
+		gr.update()
+
+		select {
+		case <-gr.done:
+			return
+		case <-ticker.C:
+		case <-gr.resolveNow:
+		}
+	}
+}
+
+// update keeps the last addresses when the lookup finds none, so a registry outage does not break connections.
+func (gr *grpcResolver) update() {
+	instances, err := gr.discovery.Lookup(gr.service)
+	var addresses []resolver.Address
+
+	for _, instance := range instances {
+		if address := instance.Endpoints["grpc"]; address != "" {
+			addresses = append(addresses, resolver.Address{Addr: address})
+		}
+	}
+
+	if len(addresses) == 0 {
+		if err != nil {
+			gr.cc.ReportError(err)
+		}
+
+		return
+	}
+
+	_ = gr.cc.UpdateState(resolver.State{Addresses: addresses,
+		ServiceConfig: gr.cc.ParseServiceConfig(serviceConfig)})
+}
+
+func (gr *grpcResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case gr.resolveNow <- struct{}{}:
+	default:
+	}
+}
+
+func (gr *grpcResolver) Close() {
+	close(gr.done)
+}
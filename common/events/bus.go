@@ -0,0 +1,104 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"dfs/common/rpc"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+// Handler handles one event. Events are delivered at least once, so handlers must be idempotent.
+type Handler func(ctx context.Context, event Event) error
+
+// Bus publishes the domain events of a service and subscribes to the events of the others.
+type Bus struct {
+	connection *rpc.Connection
+	logger     *zap.Logger
+	source     string
+}
+
+// NewBus declares the event exchange, so events published before any subscriber exists are not rejected by the broker.
+func NewBus(connection *rpc.Connection, logger *zap.Logger, source string) (*Bus, error) {
+	ch, err := connection.Channel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer ch.Close()
+
+	if err := rpc.DeclareTopic(ch, Exchange); err != nil {
+		return nil, fmt.Errorf("events: cannot declare %s: %w", Exchange, err)
+	}
+
+	return &Bus{connection: connection, logger: logger, source: source}, nil
+}
+
+// Publish sends the event with the payload data and waits until the broker confirms it.
+func (bus *Bus) Publish(ctx context.Context, eventType string, version int, data interface{}) error {
+	serializedData, err := json.Marshal(data)
+
+	if err != nil {
+		return fmt.Errorf("events: cannot serialize %s: %w", eventType, err)
+	}
+
+	event := Event{Id: uuid.New().String(), Type: eventType, Version: version, Source: bus.source,
+		OccurredAt: time.Now().UTC(), Data: serializedData}
+
+	body, err := json.Marshal(event)
+
+	if err != nil {
+		return fmt.Errorf("events: cannot serialize %s: %w", eventType, err)
+	}
+
+	bus.logger.Debug("[-->]", zap.String("Event", eventType), zap.String("EventId", event.Id))
+
+	return bus.connection.Publish(ctx, Exchange, eventType, amqp.Publishing{
+		ContentType:  "application/json",
+		MessageId:    event.Id,
+		Timestamp:    event.OccurredAt,
+		DeliveryMode: amqp.Persistent,
+		Body:         body,
+	})
+}
+
+// Subscribe binds the durable queue to the event types handled by handlers and passes every event to its handler. A
+// handler error retries the event and finally dead-letters it like any other message. Subscribe blocks until the
+// connection is closed. Every service uses its own queue, so each of them receives every event, while instances of
+// one service share the work.
+func (bus *Bus) Subscribe(queueName string, handlers map[string]Handler) {
+	eventTypes := make([]string, 0, len(handlers))
+
+	for eventType := range handlers {
+		eventTypes = append(eventTypes, eventType)
+	}
+
+	bus.connection.Subscribe(queueName, Exchange, eventTypes, func(ch *amqp.Channel, msg amqp.Delivery) error {
+		var event Event
+
+		if err := json.Unmarshal(msg.Body, &event); err != nil {
+			return fmt.Errorf("%w: %s", rpc.ErrMalformed, err)
+		}
+
+		handler, ok := handlers[event.Type]
+
+		if ok == false {
+			// Left over from a binding of an older version of the subscriber
+			bus.logger.Debug("Ignoring event", zap.String("Queue", queueName), zap.String("Event", event.Type))
+			return nil
+		}
+
+		bus.logger.Debug("[<--]", zap.String("Event", event.Type), zap.String("EventId", event.Id))
+
+		ctx, cancel := context.WithTimeout(context.Background(), rpc.DefaultTimeout)
+		defer cancel()
+
+		return handler(ctx, event)
+	})
+}
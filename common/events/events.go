@@ -0,0 +1,103 @@
+package events
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"dfs/common/rpc"
+)
+
+// Exchange is the topic exchange all domain events are published to, with the event type as the routing key.
+const Exchange = "dfs.events"
+
+const (
+	FileCreated             = "file.created"
+	FileDeleted             = "file.deleted"
+	ShareCreated            = "share.created"
+	UserDeleted             = "user.deleted"
+	ShareSpaceMemberRemoved = "sharespace.member.removed"
+	ShareSpaceFileCreated   = "sharespace.file.created"
+	ShareSpaceFileDeleted   = "sharespace.file.deleted"
+	AuditRecorded           = "audit.recorded"
+)
+
+// Event is the envelope of every domain event. Version is raised whenever Data changes incompatibly, so subscribers
+// can tell payloads they do not understand from broken ones.
+type Event struct {
+	Id         string          `json:"id"`
+	Type       string          `json:"type"`
+	Version    int             `json:"version"`
+	Source     string          `json:"source"`
+	OccurredAt time.Time       `json:"occurredAt"`
+	Data       json.RawMessage `json:"data"`
+}
+
+type FileCreatedV1 struct {
+	FileId     uint   `json:"fileId"`
+	UniqueName string `json:"uniqueName"`
+	Name       string `json:"name"`
+	OwnerId    uint   `json:"ownerId"`
+}
+
+type FileDeletedV1 struct {
+	FileId     uint   `json:"fileId"`
+	UniqueName string `json:"uniqueName"`
+	OwnerId    uint   `json:"ownerId"`
+}
+
+type ShareCreatedV1 struct {
+	FileId         uint      `json:"fileId"`
+	SharedForId    uint      `json:"sharedForId"`
+	SharedById     uint      `json:"sharedById"`
+	ExpirationTime time.Time `json:"expirationTime"`
+}
+
+type UserDeletedV1 struct {
+	UserId uint `json:"userId"`
+}
+
+type ShareSpaceMemberRemovedV1 struct {
+	ShareSpaceId uint `json:"shareSpaceId"`
+	UserId       uint `json:"userId"`
+}
+
+type ShareSpaceFileCreatedV1 struct {
+	ShareSpaceId uint   `json:"shareSpaceId"`
+	FileId       uint   `json:"fileId"`
+	Name         string `json:"name"`
+	OwnerId      uint   `json:"ownerId"`
+}
+
+type ShareSpaceFileDeletedV1 struct {
+	ShareSpaceId uint   `json:"shareSpaceId"`
+	FileId       uint   `json:"fileId"`
+	UniqueName   string `json:"uniqueName"`
+	Name         string `json:"name"`
+	DeletedById  uint   `json:"deletedById"`
+}
+
+// AuditRecordedV1 describes an action of a user. Ip and Result are filled in by audit.Record.
+type AuditRecordedV1 struct {
+	ActorId      uint   `json:"actorId"`
+	Action       string `json:"action"`
+	Resource     string `json:"resource"`
+	ShareSpaceId uint   `json:"shareSpaceId"`
+	Ip           string `json:"ip"`
+	Result       string `json:"result"`
+	Details      string `json:"details"`
+}
+
+// Decode deserializes the payload of an event with the given version. Other versions and invalid payloads are
+// reported as rpc.ErrMalformed, so the event is dead-lettered and can be replayed once the subscriber supports it.
+func (event Event) Decode(version int, data interface{}) error {
+	if event.Version != version {
+		return fmt.Errorf("%w: unsupported version %d of %s", rpc.ErrMalformed, event.Version, event.Type)
+	}
+
+	if err := json.Unmarshal(event.Data, data); err != nil {
+		return fmt.Errorf("%w: %s", rpc.ErrMalformed, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,258 @@
+package jwks
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"dfs/common/discovery"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+const (
+	// Keys are fetched again after this long, so retired keys stop being accepted
+	keysTtl = 10 * time.Minute
+	// A token with an unknown kid refreshes the keys at most this often, as rotated keys show up in the set first
+	refreshInterval = 30 * time.Second
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrNoKeys is returned while the auth service publishes no keys, which is the case for HS256
+	ErrNoKeys = errors.New("JWKS does not contain any keys")
+)
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+}
+
+type publicKey struct {
+	alg string
+	key interface{}
+}
+
+type AccessToken struct {
+	UserId    uint
+	SessionId uint
+}
+
+// Verifier checks access tokens against the public keys the auth service publishes at /.well-known/jwks.json. The
+// url function is called on every fetch, so the auth service can be found through discovery.
+type Verifier struct {
+	url       func() string
+	client    *http.Client
+	mutex     sync.Mutex
+	keys      map[string]publicKey
+	fetchedAt time.Time
+	// Failed fetches are not repeated before the refresh interval passes, every request would wait for them otherwise
+	attemptedAt time.Time
+}
+
+func NewVerifier(url func() string) *Verifier {
+	return &Verifier{url: url, client: &http.Client{Timeout: 5 * time.Second}}
+}
+
+// NewFromEnv verifies tokens with the keys at AUTH_JWKS_URL, or with the keys of the auth service at AUTH_URL or found
+// through discovery.
+func NewFromEnv(d *discovery.Discovery) *Verifier {
+	if jwksUrl := os.Getenv("AUTH_JWKS_URL"); jwksUrl != "" {
+		return NewVerifier(func() string { return jwksUrl })
+	}
+
+	if authUrl := os.Getenv("AUTH_URL"); authUrl != "" {
+		jwksUrl := strings.TrimSuffix(authUrl, "/") + "/.well-known/jwks.json"
+		return NewVerifier(func() string { return jwksUrl })
+	}
+
+	return NewVerifier(func() string {
+		if address := d.Address("auth", "http"); address != "" {
+			return "http://" + address + "/.well-known/jwks.json"
+		}
+
+		return ""
+	})
+}
+
+// Verify returns the user and the session of an access token. Errors wrapping ErrInvalidToken mean that the token
+// is forged, expired or not an access token, any other error that the keys are not available.
+func (v *Verifier) Verify(rawToken string) (*AccessToken, error) {
+	unverified, _, err := jwt.NewParser().ParseUnverified(rawToken, &jwt.RegisteredClaims{})
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	keyId, _ := unverified.Header["kid"].(string)
+	key, err := v.key(keyId)
+
+	if err != nil {
+		return nil, err
+	}
+
+	token, err := jwt.ParseWithClaims(rawToken, &jwt.RegisteredClaims{}, func(token *jwt.Token) (interface{}, error) {
+		if token.Method.Alg() != key.alg {
+			return nil, fmt.Errorf("unexpected signing method '%s'", token.Method.Alg())
+		}
+
+		return key.key, nil
+	})
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidToken, err)
+	}
+
+	claims := token.Claims.(*jwt.RegisteredClaims)
+
+	// Pending login tokens carry an audience, access tokens do not
+	if len(claims.Audience) != 0 {
+		return nil, fmt.Errorf("%w: token is not an access token", ErrInvalidToken)
+	}
+
+	userId, err := strconv.ParseUint(claims.Issuer, 10, 0)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid token issuer", ErrInvalidToken)
+	}
+
+	sessionId, err := strconv.ParseUint(claims.ID, 10, 0)
+
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid token session", ErrInvalidToken)
+	}
+
+	return &AccessToken{UserId: uint(userId), SessionId: uint(sessionId)}, nil
+}
+
+// key returns the key with the id, fetching the keys again when they are stale or the id is not known yet. The last
+// keys are kept when a fetch fails. Tokens without a kid are only accepted while a single key is published.
+func (v *Verifier) key(keyId string) (publicKey, error) {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+
+	_, known := v.keys[keyId]
+
+	if (known == false || time.Since(v.fetchedAt) > keysTtl) && time.Since(v.attemptedAt) > refreshInterval {
+		v.attemptedAt = time.Now()
+
+		if err := v.fetch(); err != nil && v.keys == nil {
+			return publicKey{}, err
+		}
+	}
+
+	if v.keys == nil {
+		return publicKey{}, errors.New("JWKS is not available")
+	}
+
+	if len(v.keys) == 0 {
+		return publicKey{}, ErrNoKeys
+	}
+
+	if keyId == "" && len(v.keys) == 1 {
+		for _, key := range v.keys {
+			return key, nil
+		}
+	}
+
+	key, ok := v.keys[keyId]
+
+	if ok == false {
+		return publicKey{}, fmt.Errorf("%w: unknown signing key '%s'", ErrInvalidToken, keyId)
+	}
+
+	return key, nil
+}
+
+func (v *Verifier) fetch() error {
+	url := v.url()
+
+	if url == "" {
+		return errors.New("JWKS url is not known")
+	}
+
+	res, err := v.client.Get(url)
+
+	if err != nil {
+		return err
+	}
+
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("JWKS request failed with status %d", res.StatusCode)
+	}
+
+	var jwks struct {
+		Keys []jwk `json:"keys"`
+	}
+
+	if err := json.NewDecoder(res.Body).Decode(&jwks); err != nil {
+		return err
+	}
+
+	keys := map[string]publicKey{}
+
+	for _, key := range jwks.Keys {
+		public, err := parseKey(key)
+
+		if err != nil {
+			return fmt.Errorf("cannot parse JWK '%s': %w", key.Kid, err)
+		}
+
+		keys[key.Kid] = publicKey{alg: key.Alg, key: public}
+	}
+
+	v.keys = keys
+	v.fetchedAt = time.Now()
+
+	return nil
+}
+
+func parseKey(key jwk) (interface{}, error) {
+	switch {
+	case key.Kty == "RSA" && key.Alg == jwt.SigningMethodRS256.Alg():
+		n, err := base64.RawURLEncoding.DecodeString(key.N)
+
+		if err != nil {
+			return nil, err
+		}
+
+		e, err := base64.RawURLEncoding.DecodeString(key.E)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case key.Kty == "OKP" && key.Crv == "Ed25519" && key.Alg == jwt.SigningMethodEdDSA.Alg():
+		x, err := base64.RawURLEncoding.DecodeString(key.X)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("unsupported key type '%s' with algorithm '%s'", key.Kty, key.Alg)
+}
@@ -0,0 +1,46 @@
+package lookup
+
+import (
+	"context"
+	"dfs/common/rpc"
+	"dfs/proto"
+
+	"google.golang.org/grpc"
+)
+
+// ShareSpaces looks ShareSpace memberships up at the sharespace service over gRPC.
+type ShareSpaces struct {
+	conn       *grpc.ClientConn
+	shareSpace proto.ShareSpaceClient
+}
+
+func NewShareSpaces(address string, secret string) (*ShareSpaces, error) {
+	conn, err := rpc.DialGrpc(address, rpc.DefaultTimeout, secret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &ShareSpaces{conn: conn, shareSpace: proto.NewShareSpaceClient(conn)}, nil
+}
+
+// GetShareSpaceRole returns the role of the user in the ShareSpace, or an empty string if the user is not a member.
+func (ss *ShareSpaces) GetShareSpaceRole(ctx context.Context, userId uint, shareSpaceId uint) (string, error) {
+	userMemberships, err := ss.shareSpace.GetUserMemberships(ctx, &proto.MembershipsRequest{UserId: uint64(userId)})
+
+	if err != nil {
+		return "", err
+	}
+
+	for _, membership := range userMemberships.Memberships {
+		if membership.ShareSpaceId == uint64(shareSpaceId) {
+			return membership.Role, nil
+		}
+	}
+
+	return "", nil
+}
+
+func (ss *ShareSpaces) Close() {
+	ss.conn.Close()
+}
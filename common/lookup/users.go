@@ -0,0 +1,62 @@
+package lookup
+
+import (
+	"context"
+	"dfs/common/rpc"
+	"dfs/proto"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/connectivity"
+)
+
+// Users looks users up at the auth service over gRPC. Every service converts them to its own user DTO T, keeping only
+// the fields it needs.
+type Users[T any] struct {
+	conn    *grpc.ClientConn
+	auth    proto.AuthClient
+	convert func(userData *proto.UserData) *T
+}
+
+func NewUsers[T any](address string, secret string, convert func(userData *proto.UserData) *T) (*Users[T], error) {
+	conn, err := rpc.DialGrpc(address, rpc.DefaultTimeout, secret)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Users[T]{conn: conn, auth: proto.NewAuthClient(conn), convert: convert}, nil
+}
+
+func (u *Users[T]) GetUserDataByJwt(ctx context.Context, jwt string) (*T, error) {
+	return u.result(u.auth.GetUserDataByJwt(ctx, &proto.JwtRequest{Jwt: jwt}))
+}
+
+func (u *Users[T]) GetUserDataById(ctx context.Context, userId uint) (*T, error) {
+	return u.result(u.auth.GetUserDataById(ctx, &proto.UserIdRequest{UserId: uint64(userId)}))
+}
+
+// GetUserDataByApiToken returns the owner of the personal API token if the token may be used for the request.
+func (u *Users[T]) GetUserDataByApiToken(ctx context.Context, apiToken string, scope string,
+	readOnly bool) (*T, error) {
+	return u.result(u.auth.GetUserDataByApiToken(ctx, &proto.ApiTokenRequest{Token: apiToken, Scope: scope,
+		ReadOnly: readOnly}))
+}
+
+// Ready reports whether the auth service can be reached. A connection that was not used yet counts as ready.
+func (u *Users[T]) Ready() bool {
+	state := u.conn.GetState()
+
+	return state != connectivity.TransientFailure && state != connectivity.Shutdown
+}
+
+func (u *Users[T]) Close() {
+	u.conn.Close()
+}
+
+func (u *Users[T]) result(userData *proto.UserData, err error) (*T, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	return u.convert(userData), nil
+}
@@ -0,0 +1,210 @@
+package masterkey
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+const wrappedKeyPrefix = "wrapped"
+
+type keystoreFile struct {
+	CurrentKeyId string            `json:"currentKeyId"`
+	Keys         map[string]string `json:"keys"`
+}
+
+// Config sets the master keys, either a JSON keystore file or a single base64 encoded key with its id.
+type Config struct {
+	KeystorePath string
+	Key          string
+	KeyId        string
+}
+
+// KeyService wraps the data keys stored in the database with the current master key and unwraps them with the master
+// key they were wrapped with.
+type KeyService struct {
+	currentKeyId string
+	masterKeys   map[string][]byte
+}
+
+func NewKeyService(cfg Config) (*KeyService, error) {
+	ks := &KeyService{masterKeys: map[string][]byte{}}
+
+	if cfg.KeystorePath != "" {
+		if err := ks.loadKeystore(cfg.KeystorePath); err != nil {
+			return nil, err
+		}
+	} else if cfg.Key != "" {
+		if err := ks.addMasterKey(cfg.KeyId, cfg.Key); err != nil {
+			return nil, err
+		}
+
+		ks.currentKeyId = cfg.KeyId
+	} else {
+		return nil, errors.New("neither master key nor master keystore is configured")
+	}
+
+	if _, ok := ks.masterKeys[ks.currentKeyId]; ok == false {
+		return nil, fmt.Errorf("current master key '%s' is not available", ks.currentKeyId)
+	}
+
+	return ks, nil
+}
+
+func (ks *KeyService) WrapKey(key string) (string, error) {
+	block, err := aes.NewCipher(ks.masterKeys[ks.currentKeyId])
+
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", err
+	}
+
+	sealed := gcm.Seal(nonce, nonce, []byte(key), []byte(ks.currentKeyId))
+
+	return fmt.Sprintf("%s:%s:%s", wrappedKeyPrefix, ks.currentKeyId,
+		base64.StdEncoding.EncodeToString(sealed)), nil
+}
+
+// UnwrapKey returns the base64 encoded data key. Keys stored before wrapping was introduced are returned as they are,
+// while a malformed wrapped key is an error.
+func (ks *KeyService) UnwrapKey(wrapped string) (string, error) {
+	keyId, sealed, isWrapped, err := splitWrappedKey(wrapped)
+
+	if err != nil {
+		return "", err
+	}
+
+	if isWrapped == false {
+		return wrapped, nil
+	}
+
+	masterKey, ok := ks.masterKeys[keyId]
+
+	if ok == false {
+		return "", fmt.Errorf("unknown master key '%s'", keyId)
+	}
+
+	block, err := aes.NewCipher(masterKey)
+
+	if err != nil {
+		return "", err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(sealed) < gcm.NonceSize() {
+		return "", errors.New("wrapped key is too short")
+	}
+
+	key, err := gcm.Open(nil, sealed[:gcm.NonceSize()], sealed[gcm.NonceSize():], []byte(keyId))
+
+	if err != nil {
+		return "", err
+	}
+
+	return string(key), nil
+}
+
+// RewrapKey wraps the key again with the current master key. Keys already wrapped with it are left untouched.
+func (ks *KeyService) RewrapKey(wrapped string) (string, error) {
+	if keyId, _, isWrapped, err := splitWrappedKey(wrapped); err != nil {
+		return "", err
+	} else if isWrapped && keyId == ks.currentKeyId {
+		return wrapped, nil
+	}
+
+	key, err := ks.UnwrapKey(wrapped)
+
+	if err != nil {
+		return "", err
+	}
+
+	return ks.WrapKey(key)
+}
+
+// splitWrappedKey returns the master key id and the sealed key, and reports false for keys that are not wrapped.
+func splitWrappedKey(wrapped string) (string, []byte, bool, error) {
+	parts := strings.SplitN(wrapped, ":", 3)
+
+	if parts[0] != wrappedKeyPrefix {
+		return "", nil, false, nil
+	}
+
+	if len(parts) != 3 {
+		return "", nil, true, errors.New("malformed wrapped key")
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(parts[2])
+
+	if err != nil {
+		return "", nil, true, fmt.Errorf("malformed wrapped key '%s': %w", parts[1], err)
+	}
+
+	return parts[1], sealed, true, nil
+}
+
+func (ks *KeyService) loadKeystore(keystorePath string) error {
+	content, err := os.ReadFile(keystorePath)
+
+	if err != nil {
+		return err
+	}
+
+	var keystore keystoreFile
+
+	if err := json.Unmarshal(content, &keystore); err != nil {
+		return err
+	}
+
+	for keyId, key := range keystore.Keys {
+		if err := ks.addMasterKey(keyId, key); err != nil {
+			return err
+		}
+	}
+
+	ks.currentKeyId = keystore.CurrentKeyId
+
+	return nil
+}
+
+func (ks *KeyService) addMasterKey(keyId string, encodedKey string) error {
+	if keyId == "" || strings.Contains(keyId, ":") {
+		return fmt.Errorf("invalid master key id '%s'", keyId)
+	}
+
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+
+	if err != nil {
+		return err
+	}
+
+	if len(key) != 32 {
+		return fmt.Errorf("master key '%s' must be 32 bytes long", keyId)
+	}
+
+	ks.masterKeys[keyId] = key
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+
+	"dfs/common/jwks"
+	"dfs/common/rpc"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"go.uber.org/zap"
+)
+
+// Authentication looks users up with the gRPC client of a service, which returns the user DTO of that service.
+type Authentication[T any] struct {
+	Store  *session.Store
+	Logger *zap.Logger
+	// Scope an API token needs for the service
+	Scope string
+	// Jwks verifies the jwt cookie before it is looked up, optional
+	Jwks       *jwks.Verifier
+	ById       func(ctx context.Context, userId uint) (T, error)
+	ByJwt      func(ctx context.Context, jwt string) (T, error)
+	ByApiToken func(ctx context.Context, apiToken string, scope string, readOnly bool) (T, error)
+}
+
+// Authenticate stores the user of the request as "userData" in the session. The user forwarded by the gateway (see
+// Identity) is trusted, otherwise the request needs an API token with the scope or the jwt cookie. Unknown users get
+// 401, and 503 is returned while the auth service cannot be reached.
+func Authenticate[T any](config Authentication[T]) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		var userData T
+		var err error
+
+		if userId := UserId(c); userId != 0 {
+			userData, err = config.ById(c.UserContext(), userId)
+		} else if apiToken := BearerToken(c); apiToken != "" {
+			userData, err = config.ByApiToken(c.UserContext(), apiToken, config.Scope, ReadOnlyRequest(c))
+		} else if jwt := c.Cookies("jwt"); VerifyJwt(config.Jwks, config.Logger, jwt) == false {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		} else {
+			userData, err = config.ByJwt(c.UserContext(), jwt)
+		}
+
+		if errors.Is(err, rpc.ErrNoResult) {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		} else if err != nil {
+			config.Logger.Error("Cannot authenticate request", zap.Error(err))
+			return c.SendStatus(fiber.StatusServiceUnavailable)
+		}
+
+		sess, err := config.Store.Get(c)
+
+		if err != nil {
+			config.Logger.Panic("Cannot get session", zap.Error(err))
+		}
+
+		sess.Set("userData", userData)
+
+		if err := sess.Save(); err != nil {
+			config.Logger.Panic("Cannot save session", zap.Error(err))
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,23 @@
+package middleware
+
+import (
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BearerToken returns the token from the "Authorization: Bearer <token>" header, or an empty string.
+func BearerToken(c *fiber.Ctx) string {
+	authorization := c.Get(fiber.HeaderAuthorization)
+
+	if len(authorization) < 7 || strings.EqualFold(authorization[:7], "Bearer ") == false {
+		return ""
+	}
+
+	return strings.TrimSpace(authorization[7:])
+}
+
+// ReadOnlyRequest reports whether the request method does not modify anything.
+func ReadOnlyRequest(c *fiber.Ctx) bool {
+	return c.Method() == fiber.MethodGet || c.Method() == fiber.MethodHead
+}
@@ -0,0 +1,121 @@
+package middleware
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// Headers of the identity the edge gateway forwards with every request
+const (
+	HeaderUserId            = "X-Dfs-User-Id"
+	HeaderClientIp          = "X-Dfs-Client-Ip"
+	HeaderIdentityTimestamp = "X-Dfs-Identity-Timestamp"
+	HeaderIdentitySignature = "X-Dfs-Identity-Signature"
+)
+
+// IdentityMaxAge limits how long a signed identity is accepted, so captured headers cannot be replayed later.
+const IdentityMaxAge = time.Minute
+
+const identityKey = "identity"
+
+// RequestIdentity is the user the gateway authenticated, 0 for anonymous requests, and the IP of the client.
+type RequestIdentity struct {
+	UserId   uint
+	ClientIp string
+}
+
+// SignIdentity returns the signature of the identity at the Unix timestamp, sha256=<hex HMAC-SHA256>.
+func SignIdentity(secret string, identity RequestIdentity, timestamp int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%d\n%s\n%d", identity.UserId, identity.ClientIp, timestamp)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// ForwardIdentity replaces the identity headers of the request with the signed identity, so they reach the service
+// the request is proxied to.
+func ForwardIdentity(c *fiber.Ctx, secret string, identity RequestIdentity) {
+	timestamp := time.Now().Unix()
+
+	StripIdentity(c)
+	c.Request().Header.Set(HeaderUserId, strconv.FormatUint(uint64(identity.UserId), 10))
+	c.Request().Header.Set(HeaderClientIp, identity.ClientIp)
+	c.Request().Header.Set(HeaderIdentityTimestamp, strconv.FormatInt(timestamp, 10))
+	c.Request().Header.Set(HeaderIdentitySignature, SignIdentity(secret, identity, timestamp))
+}
+
+// StripIdentity removes the identity headers a client may have sent.
+func StripIdentity(c *fiber.Ctx) {
+	for _, header := range []string{HeaderUserId, HeaderClientIp, HeaderIdentityTimestamp, HeaderIdentitySignature} {
+		c.Request().Header.Del(header)
+	}
+}
+
+// Identity accepts the identity forwarded by the gateway when its signature matches the secret shared by the services.
+// Requests without a valid identity, or all requests when the secret is empty, are handled as if they came directly
+// from the client, so the services still authenticate them on their own.
+func Identity(secret string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if identity, ok := verifyIdentity(c, secret); ok {
+			c.Locals(identityKey, identity)
+		}
+
+		return c.Next()
+	}
+}
+
+func verifyIdentity(c *fiber.Ctx, secret string) (RequestIdentity, bool) {
+	signature := c.Get(HeaderIdentitySignature)
+
+	if secret == "" || signature == "" {
+		return RequestIdentity{}, false
+	}
+
+	userId, err := strconv.ParseUint(c.Get(HeaderUserId), 10, 32)
+
+	if err != nil {
+		return RequestIdentity{}, false
+	}
+
+	timestamp, err := strconv.ParseInt(c.Get(HeaderIdentityTimestamp), 10, 64)
+
+	if err != nil {
+		return RequestIdentity{}, false
+	}
+
+	if age := time.Since(time.Unix(timestamp, 0)); age > IdentityMaxAge || age < -IdentityMaxAge {
+		return RequestIdentity{}, false
+	}
+
+	identity := RequestIdentity{UserId: uint(userId), ClientIp: c.Get(HeaderClientIp)}
+
+	if hmac.Equal([]byte(signature), []byte(SignIdentity(secret, identity, timestamp))) == false {
+		return RequestIdentity{}, false
+	}
+
+	return identity, true
+}
+
+// UserId returns the user authenticated by the gateway, or 0.
+func UserId(c *fiber.Ctx) uint {
+	if identity, ok := c.Locals(identityKey).(RequestIdentity); ok {
+		return identity.UserId
+	}
+
+	return 0
+}
+
+// ClientIp returns the IP of the client the gateway received the request from, or the IP of the direct peer.
+func ClientIp(c *fiber.Ctx) string {
+	if identity, ok := c.Locals(identityKey).(RequestIdentity); ok && identity.ClientIp != "" {
+		return identity.ClientIp
+	}
+
+	return c.IP()
+}
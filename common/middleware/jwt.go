@@ -0,0 +1,33 @@
+package middleware
+
+import (
+	"errors"
+
+	"dfs/common/jwks"
+
+	"go.uber.org/zap"
+)
+
+// VerifyJwt reports whether the jwt cookie should be passed on to the auth service. Tokens that fail verification
+// against the JWKS are rejected without a call to the auth service, which still checks that the session is active.
+// Without a verifier, or while the keys cannot be fetched, the check is left to the auth service.
+func VerifyJwt(verifier *jwks.Verifier, logger *zap.Logger, rawToken string) bool {
+	if verifier == nil {
+		return true
+	}
+
+	if rawToken == "" {
+		return false
+	}
+
+	_, err := verifier.Verify(rawToken)
+
+	if errors.Is(err, jwks.ErrInvalidToken) {
+		logger.Debug("Rejected token", zap.Error(err))
+		return false
+	} else if err != nil && errors.Is(err, jwks.ErrNoKeys) == false {
+		logger.Warn("Cannot verify token with the JWKS", zap.Error(err))
+	}
+
+	return true
+}
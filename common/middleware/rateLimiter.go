@@ -0,0 +1,124 @@
+package middleware
+
+import (
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type RateLimiterConfig struct {
+	// Max is the number of requests allowed within Window for a single key
+	Max    int
+	Window time.Duration
+	// MaxBlock caps the exponential backoff applied to keys that keep exceeding the limit
+	MaxBlock time.Duration
+	// KeyGenerator groups requests, by client IP (see ClientIp) when not set
+	KeyGenerator func(c *fiber.Ctx) string
+}
+
+type rateLimitEntry struct {
+	count        int
+	windowStart  time.Time
+	violations   int
+	blockedUntil time.Time
+}
+
+type rateLimiter struct {
+	config  RateLimiterConfig
+	mutex   sync.Mutex
+	entries map[string]*rateLimitEntry
+}
+
+// RateLimiter allows Max requests per Window for every key. A key exceeding the limit is blocked for Window, and the
+// block doubles with every further violation up to MaxBlock. Counters are kept in memory of the current instance.
+func RateLimiter(config RateLimiterConfig) fiber.Handler {
+	if config.KeyGenerator == nil {
+		config.KeyGenerator = func(c *fiber.Ctx) string {
+			return ClientIp(c)
+		}
+	}
+
+	if config.MaxBlock < config.Window {
+		config.MaxBlock = config.Window
+	}
+
+	rl := &rateLimiter{config: config, entries: map[string]*rateLimitEntry{}}
+
+	go rl.removeStaleEntries()
+
+	return func(c *fiber.Ctx) error {
+		if retryAfter, allowed := rl.allow(config.KeyGenerator(c)); allowed == false {
+			c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"message": "Too many requests, try again later"})
+		}
+
+		return c.Next()
+	}
+}
+
+func (rl *rateLimiter) allow(key string) (time.Duration, bool) {
+	rl.mutex.Lock()
+	defer rl.mutex.Unlock()
+
+	now := time.Now()
+	entry, ok := rl.entries[key]
+
+	if ok == false {
+		entry = &rateLimitEntry{windowStart: now}
+		rl.entries[key] = entry
+	}
+
+	if now.Before(entry.blockedUntil) {
+		return entry.blockedUntil.Sub(now), false
+	}
+
+	if now.Sub(entry.windowStart) >= rl.config.Window {
+		// Forget past violations once the key behaved for a whole backoff period
+		if now.Sub(entry.blockedUntil) >= rl.config.MaxBlock {
+			entry.violations = 0
+		}
+
+		entry.count = 0
+		entry.windowStart = now
+	}
+
+	entry.count++
+
+	if entry.count <= rl.config.Max {
+		return 0, true
+	}
+
+	block := rl.config.Window << entry.violations
+
+	if block > rl.config.MaxBlock || block <= 0 {
+		block = rl.config.MaxBlock
+	}
+
+	entry.violations++
+	entry.blockedUntil = now.Add(block)
+	entry.count = 0
+	entry.windowStart = entry.blockedUntil
+
+	return block, false
+}
+
+func (rl *rateLimiter) removeStaleEntries() {
+	ticker := time.NewTicker(rl.config.Window)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		rl.mutex.Lock()
+
+		for key, entry := range rl.entries {
+			if time.Since(entry.windowStart) > rl.config.Window+rl.config.MaxBlock &&
+				time.Since(entry.blockedUntil) > rl.config.MaxBlock {
+				delete(rl.entries, key)
+			}
+		}
+
+		rl.mutex.Unlock()
+	}
+}
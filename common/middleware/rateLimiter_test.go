@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"testing"
+	"time"
+)
+
+type rateLimitStep struct {
+	key string
+	// elapse moves the entry of the key back in time before the request
+	elapse     time.Duration
+	allowed    bool
+	retryAfter time.Duration
+}
+
+func TestRateLimiterAllow(t *testing.T) {
+	allowed := func(key string) rateLimitStep {
+		return rateLimitStep{key: key, allowed: true}
+	}
+
+	blocked := func(key string, retryAfter time.Duration) rateLimitStep {
+		return rateLimitStep{key: key, retryAfter: retryAfter}
+	}
+
+	after := func(elapse time.Duration, step rateLimitStep) rateLimitStep {
+		step.elapse = elapse
+		return step
+	}
+
+	tests := []struct {
+		name  string
+		steps []rateLimitStep
+	}{
+		{"within the limit", []rateLimitStep{allowed("a"), allowed("a")}},
+		{"over the limit", []rateLimitStep{allowed("a"), allowed("a"), blocked("a", time.Minute),
+			blocked("a", time.Minute)}},
+		{"new window", []rateLimitStep{allowed("a"), allowed("a"), after(time.Minute, allowed("a")),
+			allowed("a"), blocked("a", time.Minute)}},
+		{"block doubles up to the maximum", []rateLimitStep{allowed("a"), allowed("a"), blocked("a", time.Minute),
+			after(time.Minute, allowed("a")), allowed("a"), blocked("a", 2*time.Minute),
+			after(2*time.Minute, allowed("a")), allowed("a"), blocked("a", 4*time.Minute),
+			after(4*time.Minute, allowed("a")), allowed("a"), blocked("a", 4*time.Minute)}},
+		{"violations are forgotten", []rateLimitStep{allowed("a"), allowed("a"), blocked("a", time.Minute),
+			after(5*time.Minute, allowed("a")), allowed("a"), blocked("a", time.Minute)}},
+		{"keys are counted apart", []rateLimitStep{allowed("a"), allowed("a"), blocked("a", time.Minute),
+			allowed("b"), allowed("b"), blocked("b", time.Minute)}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rl := &rateLimiter{config: RateLimiterConfig{Max: 2, Window: time.Minute, MaxBlock: 4 * time.Minute},
+				entries: map[string]*rateLimitEntry{}}
+
+			for i, step := range test.steps {
+				if entry, ok := rl.entries[step.key]; ok {
+					entry.windowStart = entry.windowStart.Add(-step.elapse)
+					entry.blockedUntil = entry.blockedUntil.Add(-step.elapse)
+				}
+
+				retryAfter, isAllowed := rl.allow(step.key)
+
+				if isAllowed != step.allowed {
+					t.Fatalf("step %d: expected allowed %t, got %t", i, step.allowed, isAllowed)
+				}
+
+				// A block that is already running has a little less time left
+				if retryAfter > step.retryAfter || retryAfter < step.retryAfter-time.Second {
+					t.Fatalf("step %d: expected retry after %s, got %s", i, step.retryAfter, retryAfter)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"github.com/gofiber/fiber/v2"
+)
+
+// Readiness answers 200 when every check passes and 503 otherwise, listing the result of each check, so load balancers
+// and orchestrators stop sending requests to an instance that lost one of its dependencies.
+func Readiness(checks map[string]func() bool) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		results := fiber.Map{}
+		ready := true
+
+		for name, check := range checks {
+			passed := check()
+			results[name] = passed
+			ready = ready && passed
+		}
+
+		if ready == false {
+			return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"ready": false, "checks": results})
+		}
+
+		return c.JSON(fiber.Map{"ready": true, "checks": results})
+	}
+}
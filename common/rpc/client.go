@@ -0,0 +1,345 @@
+package rpc
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+const DefaultTimeout = 10 * time.Second
+
+var (
+	// ErrTimeout is returned when no response arrives before the deadline of the call
+	ErrTimeout = errors.New("rpc: no response before the deadline")
+	// ErrClosed is returned for calls made or still waiting when the client or its connection is closed
+	ErrClosed = errors.New("rpc: client is closed")
+	// ErrNoResult is returned when the responder answers with null or an empty body, which is how the services report
+	// that the requested item does not exist or the operation failed
+	ErrNoResult = errors.New("rpc: responder returned no result")
+)
+
+// Client calls RPC queues of other services. All responses arrive on one exclusive reply queue and are routed to
+// the waiting call by correlation id. The channel and the reply queue are declared again after the connection to the
+// broker is restored.
+type Client struct {
+	connection *Connection
+	logger     *zap.Logger
+	timeout    time.Duration
+	mutex      sync.Mutex
+	channel    *amqp.Channel
+	replyTo    string
+	pending    map[string]chan amqp.Delivery
+	closed     bool
+}
+
+// NewClient starts consuming the reply queue on the connection. Calls whose context has no deadline wait at most
+// timeout, DefaultTimeout when it is not positive.
+func NewClient(connection *Connection, logger *zap.Logger, timeout time.Duration) *Client {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	client := &Client{connection: connection, logger: logger, timeout: timeout,
+		pending: map[string]chan amqp.Delivery{}}
+
+	var deliveries <-chan amqp.Delivery
+
+	// Declare the reply queue right away, so the first calls do not fail with ErrNotConnected
+	if conn := connection.Wait(); conn != nil {
+		var err error
+
+		if deliveries, err = client.declare(conn); err != nil {
+			logger.Error("Cannot declare RPC reply queue", zap.Error(err))
+		}
+	}
+
+	go client.run(deliveries)
+
+	return client
+}
+
+// Call publishes the body to the queue and waits for the response or for the context to end.
+func (client *Client) Call(ctx context.Context, queueName string, contentType string, body []byte) ([]byte, error) {
+	if _, ok := ctx.Deadline(); ok == false {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, client.timeout)
+		defer cancel()
+	}
+
+	corrId := uuid.New().String()
+	reply := make(chan amqp.Delivery, 1)
+
+	client.mutex.Lock()
+
+	if client.closed {
+		client.mutex.Unlock()
+		return nil, ErrClosed
+	}
+
+	if client.channel == nil {
+		client.mutex.Unlock()
+		return nil, ErrNotConnected
+	}
+
+	replyTo := client.replyTo
+	client.pending[corrId] = reply
+	client.mutex.Unlock()
+
+	defer client.forget(corrId)
+
+	client.logger.Debug("[-->]", zap.String("Queue", queueName))
+
+	// Requests nobody picked up before the deadline are dropped by the broker instead of being handled late
+	deadline, _ := ctx.Deadline()
+	expiration := time.Until(deadline).Milliseconds()
+
+	if expiration < 1 {
+		expiration = 1
+	}
+
+	// Persistent and confirmed, so requests waiting in the queue survive a broker restart
+	err := client.connection.Publish(ctx, "", queueName, amqp.Publishing{
+		ContentType:   contentType,
+		CorrelationId: corrId,
+		ReplyTo:       replyTo,
+		Expiration:    strconv.FormatInt(expiration, 10),
+		DeliveryMode:  amqp.Persistent,
+		Body:          body,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case msg, ok := <-reply:
+		if ok == false {
+			return nil, client.closeError()
+		}
+
+		client.logger.Debug("[<--]", zap.String("Queue", queueName))
+
+		return msg.Body, nil
+	case <-ctx.Done():
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return nil, fmt.Errorf("%w: %s", ErrTimeout, queueName)
+		}
+
+		return nil, ctx.Err()
+	}
+}
+
+// CallJson sends the request and deserializes the JSON response into response. Strings and byte slices are sent as
+// they are, anything else as JSON. A null or empty response is reported as ErrNoResult.
+func (client *Client) CallJson(ctx context.Context, queueName string, request interface{}, response interface{}) error {
+	body, err := client.CallBytes(ctx, queueName, request)
+
+	if err != nil {
+		return err
+	}
+
+	if string(body) == "null" {
+		return fmt.Errorf("%w: %s", ErrNoResult, queueName)
+	}
+
+	if err := json.Unmarshal(body, response); err != nil {
+		return fmt.Errorf("rpc: cannot deserialize the response from %s: %w", queueName, err)
+	}
+
+	return nil
+}
+
+// CallBool sends the request and parses a "true" or "false" response.
+func (client *Client) CallBool(ctx context.Context, queueName string, request interface{}) (bool, error) {
+	body, err := client.CallBytes(ctx, queueName, request)
+
+	if err != nil {
+		return false, err
+	}
+
+	result, err := strconv.ParseBool(string(body))
+
+	if err != nil {
+		return false, fmt.Errorf("rpc: invalid bool response from %s: %w", queueName, err)
+	}
+
+	return result, nil
+}
+
+// CallBytes sends the request and returns the raw response, which must not be empty.
+func (client *Client) CallBytes(ctx context.Context, queueName string, request interface{}) ([]byte, error) {
+	contentType, body, err := encode(request)
+
+	if err != nil {
+		return nil, fmt.Errorf("rpc: cannot serialize the request to %s: %w", queueName, err)
+	}
+
+	response, err := client.Call(ctx, queueName, contentType, body)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if len(response) == 0 {
+		return nil, fmt.Errorf("%w: %s", ErrNoResult, queueName)
+	}
+
+	return response, nil
+}
+
+// Close stops the client. Calls still waiting fail with ErrClosed.
+func (client *Client) Close() error {
+	client.mutex.Lock()
+	client.closed = true
+	channel := client.channel
+	client.mutex.Unlock()
+
+	if channel == nil {
+		return nil
+	}
+
+	return channel.Close()
+}
+
+// run dispatches responses and declares the reply queue again whenever the channel is lost, until the client or the
+// connection is closed.
+func (client *Client) run(deliveries <-chan amqp.Delivery) {
+	backoff := minBackoff
+
+	for {
+		if deliveries != nil {
+			backoff = minBackoff
+			client.dispatch(deliveries)
+		}
+
+		client.mutex.Lock()
+		closed := client.closed
+		client.mutex.Unlock()
+
+		if closed {
+			return
+		}
+
+		conn := client.connection.Wait()
+
+		if conn == nil {
+			client.Close()
+			return
+		}
+
+		var err error
+
+		if deliveries, err = client.declare(conn); err != nil {
+			client.logger.Error("Cannot declare RPC reply queue", zap.Error(err))
+
+			if client.connection.sleep(backoff) == false {
+				client.Close()
+				return
+			}
+
+			backoff = nextBackoff(backoff)
+		}
+	}
+}
+
+// declare opens a channel with an anonymous exclusive reply queue, which the broker removes with the connection.
+func (client *Client) declare(conn *amqp.Connection) (<-chan amqp.Delivery, error) {
+	channel, err := conn.Channel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	replyQueue, err := channel.QueueDeclare("", false, true, true, false, nil)
+
+	if err != nil {
+		channel.Close()
+		return nil, err
+	}
+
+	deliveries, err := channel.Consume(replyQueue.Name, "", true, true, false, false, nil)
+
+	if err != nil {
+		channel.Close()
+		return nil, err
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.closed {
+		channel.Close()
+		return nil, ErrClosed
+	}
+
+	client.channel = channel
+	client.replyTo = replyQueue.Name
+
+	return deliveries, nil
+}
+
+// dispatch routes responses to the waiting calls until the channel is closed. Calls still waiting then fail, because
+// their responses were sent to a reply queue that no longer exists.
+func (client *Client) dispatch(deliveries <-chan amqp.Delivery) {
+	for msg := range deliveries {
+		client.mutex.Lock()
+		reply, ok := client.pending[msg.CorrelationId]
+		delete(client.pending, msg.CorrelationId)
+		client.mutex.Unlock()
+
+		if ok == false {
+			// The call already timed out
+			client.logger.Debug("Dropping unexpected RPC response", zap.String("CorrelationId", msg.CorrelationId))
+			continue
+		}
+
+		reply <- msg
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.channel = nil
+
+	for corrId, reply := range client.pending {
+		close(reply)
+		delete(client.pending, corrId)
+	}
+}
+
+func (client *Client) closeError() error {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.closed {
+		return ErrClosed
+	}
+
+	return ErrNotConnected
+}
+
+func (client *Client) forget(corrId string) {
+	client.mutex.Lock()
+	delete(client.pending, corrId)
+	client.mutex.Unlock()
+}
+
+func encode(request interface{}) (string, []byte, error) {
+	switch value := request.(type) {
+	case string:
+		return "text/plain", []byte(value), nil
+	case []byte:
+		return "application/octet-stream", value, nil
+	default:
+		body, err := json.Marshal(value)
+		return "application/json", body, err
+	}
+}
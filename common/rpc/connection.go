@@ -0,0 +1,640 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+const (
+	minBackoff = 500 * time.Millisecond
+	maxBackoff = 30 * time.Second
+)
+
+// ErrNotConnected is returned while the broker connection is down
+var ErrNotConnected = errors.New("rpc: not connected to the broker")
+
+// Handler handles a delivery and publishes the response, if any, on the channel. The delivery is acknowledged when
+// the handler returns nil, and retried or dead-lettered otherwise.
+type Handler func(ch *amqp.Channel, msg amqp.Delivery) error
+
+// Connection keeps a single broker connection for the whole service. A lost connection is dialed again with
+// exponential backoff, and Consume and Client declare their channels and queues again once it is back.
+type Connection struct {
+	url       string
+	logger    *zap.Logger
+	mutex     sync.Mutex
+	conn      *amqp.Connection
+	connected chan struct{}
+	done      chan struct{}
+	closed    bool
+	publisher publisher
+	workers   Workers
+	consumers map[*amqp.Channel]string
+	running   sync.WaitGroup
+	draining  bool
+	drain     chan struct{}
+}
+
+// publisher is the channel in confirm mode that all messages of the service are published on. The mutex is held only
+// while publishing, publishes wait for their confirmation concurrently.
+type publisher struct {
+	mutex   sync.Mutex
+	channel *confirmChannel
+}
+
+// confirmChannel matches the confirmations of the broker with the publishes waiting for them by delivery tag. Its
+// mutex guards only pending, so confirmations are dispatched while a publish holds the publisher.
+type confirmChannel struct {
+	channel  *amqp.Channel
+	closes   chan *amqp.Error
+	nextTag  uint64
+	declared map[string]bool
+	mutex    sync.Mutex
+	pending  map[uint64]chan bool
+}
+
+// Dial connects to the broker, retrying with exponential backoff for at most timeout.
+func Dial(url string, logger *zap.Logger, timeout time.Duration) (*Connection, error) {
+	connection := &Connection{url: url, logger: logger, connected: make(chan struct{}), done: make(chan struct{}),
+		consumers: map[*amqp.Channel]string{}, drain: make(chan struct{})}
+
+	conn, err := connection.dial(time.Now().Add(timeout))
+
+	if err != nil {
+		return nil, err
+	}
+
+	go connection.watch(conn)
+
+	return connection, nil
+}
+
+// SetWorkers sets the number of concurrent handlers of the queues consumed afterwards. Without it every queue is
+// handled by a single worker.
+func (connection *Connection) SetWorkers(workers Workers) {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	connection.workers = workers
+}
+
+// Ready reports whether the broker is connected.
+func (connection *Connection) Ready() bool {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	return connection.conn != nil && connection.conn.IsClosed() == false
+}
+
+// Wait blocks until the broker is connected and returns the connection, or nil once the connection is closed.
+func (connection *Connection) Wait() *amqp.Connection {
+	return connection.wait(nil)
+}
+
+// wait is Wait that also returns nil once stop is closed.
+func (connection *Connection) wait(stop <-chan struct{}) *amqp.Connection {
+	for {
+		connection.mutex.Lock()
+		conn, connected, closed := connection.conn, connection.connected, connection.closed
+		connection.mutex.Unlock()
+
+		if closed {
+			return nil
+		}
+
+		if conn != nil {
+			return conn
+		}
+
+		select {
+		case <-connected:
+		case <-connection.done:
+			return nil
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// Channel opens a channel on the current connection. It fails with ErrNotConnected while reconnecting.
+func (connection *Connection) Channel() (*amqp.Channel, error) {
+	connection.mutex.Lock()
+	conn := connection.conn
+	connection.mutex.Unlock()
+
+	if conn == nil {
+		return nil, ErrNotConnected
+	}
+
+	return conn.Channel()
+}
+
+// Consume declares the durable queue and passes every delivery to handler together with the channel to reply on.
+// Deliveries are handled by as many concurrent workers as set for the queue with SetWorkers, and the broker sends at
+// most that many unacknowledged messages to the consumer. Failed deliveries are published to the queue again up to
+// maxRetries times and then to the dead-letter exchange. When the channel or the connection is lost, the queue is
+// declared and consumed again. Consume returns once the connection is closed or drained by Shutdown.
+func (connection *Connection) Consume(queueName string, handler Handler) {
+	connection.Subscribe(queueName, "", nil, handler)
+}
+
+// Subscribe consumes the durable queue like Consume after binding it to the durable topic exchange with every routing
+// key. The bindings are declared again together with the queue.
+func (connection *Connection) Subscribe(queueName string, exchange string, keys []string, handler Handler) {
+	connection.mutex.Lock()
+
+	if connection.draining {
+		connection.mutex.Unlock()
+		return
+	}
+
+	workers := connection.workers.For(queueName)
+	connection.running.Add(1)
+	connection.mutex.Unlock()
+
+	defer connection.running.Done()
+
+	backoff := minBackoff
+
+	for {
+		conn := connection.wait(connection.drain)
+
+		if conn == nil {
+			return
+		}
+
+		consumerTag := uuid.New().String()
+		ch, messages, err := consume(conn, queueName, exchange, keys, workers, consumerTag)
+
+		if err != nil {
+			connection.logger.Error("Cannot consume queue", zap.String("Queue", queueName), zap.Error(err))
+
+			if connection.sleep(backoff) == false {
+				return
+			}
+
+			backoff = nextBackoff(backoff)
+			continue
+		}
+
+		backoff = minBackoff
+
+		if connection.addConsumer(ch, consumerTag) == false {
+			ch.Close()
+			return
+		}
+
+		var wg sync.WaitGroup
+
+		for i := 0; i < workers; i++ {
+			wg.Add(1)
+
+			go func() {
+				defer wg.Done()
+
+				for msg := range messages {
+					connection.handle(ch, queueName, msg, handler)
+				}
+			}()
+		}
+
+		// Messages stops when the consumer is cancelled by Shutdown or the channel is lost
+		wg.Wait()
+
+		if connection.removeConsumer(ch) {
+			ch.Close()
+			connection.logger.Info("Consumer drained", zap.String("Queue", queueName))
+			return
+		}
+
+		ch.Close()
+
+		connection.logger.Warn("Consumer stopped", zap.String("Queue", queueName))
+	}
+}
+
+// Publish publishes the message and waits until the broker confirms it, so the message is not lost if the broker fails
+// right after Publish returns.
+func (connection *Connection) Publish(ctx context.Context, exchange string, key string, msg amqp.Publishing) error {
+	return connection.publish(ctx, exchange, key, msg, false)
+}
+
+// Send declares the durable queue and publishes a persistent message to it like Publish. It is meant for messages that
+// nobody waits a response for, which have to be delivered even if the consumer is not running yet.
+func (connection *Connection) Send(ctx context.Context, queueName string, contentType string, body []byte) error {
+	return connection.publish(ctx, "", queueName, amqp.Publishing{ContentType: contentType,
+		DeliveryMode: amqp.Persistent, Body: body}, true)
+}
+
+// Shutdown cancels all consumers, so no new messages are delivered, and waits until the messages already delivered
+// are handled or ctx ends before closing the connection. Messages that were not handled stay in their queues.
+func (connection *Connection) Shutdown(ctx context.Context) error {
+	connection.mutex.Lock()
+
+	if connection.draining == false {
+		connection.draining = true
+		close(connection.drain)
+	}
+
+	consumers := map[*amqp.Channel]string{}
+
+	for ch, consumerTag := range connection.consumers {
+		consumers[ch] = consumerTag
+	}
+
+	connection.mutex.Unlock()
+
+	for ch, consumerTag := range consumers {
+		if err := ch.Cancel(consumerTag, false); err != nil {
+			connection.logger.Warn("Cannot cancel consumer", zap.Error(err))
+		}
+	}
+
+	drained := make(chan struct{})
+
+	go func() {
+		connection.running.Wait()
+		close(drained)
+	}()
+
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		connection.logger.Warn("Consumers not drained before the shutdown deadline")
+	}
+
+	return connection.Close()
+}
+
+func (connection *Connection) Close() error {
+	connection.mutex.Lock()
+
+	if connection.closed {
+		connection.mutex.Unlock()
+		return nil
+	}
+
+	connection.closed = true
+	close(connection.done)
+	conn := connection.conn
+	connection.mutex.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	return conn.Close()
+}
+
+// dial connects to the broker, retrying until the deadline. A zero deadline retries until the connection is closed.
+func (connection *Connection) dial(deadline time.Time) (*amqp.Connection, error) {
+	backoff := minBackoff
+
+	for attempt := 1; ; attempt++ {
+		conn, err := amqp.Dial(connection.url)
+
+		if err == nil {
+			connection.mutex.Lock()
+
+			if connection.closed {
+				connection.mutex.Unlock()
+				conn.Close()
+				return nil, ErrClosed
+			}
+
+			connection.conn = conn
+			close(connection.connected)
+			connection.mutex.Unlock()
+
+			return conn, nil
+		}
+
+		if deadline.IsZero() == false && time.Now().Add(backoff).After(deadline) {
+			return nil, fmt.Errorf("rpc: cannot connect to the broker after %d attempts: %w", attempt, err)
+		}
+
+		connection.logger.Warn("Cannot connect to RabbitMQ, retrying", zap.Int("Attempt", attempt),
+			zap.Duration("Backoff", backoff), zap.Error(err))
+
+		if connection.sleep(backoff) == false {
+			return nil, ErrClosed
+		}
+
+		backoff = nextBackoff(backoff)
+	}
+}
+
+// watch dials the broker again whenever the connection is lost, until it is closed by Close.
+func (connection *Connection) watch(conn *amqp.Connection) {
+	for {
+		reason := <-conn.NotifyClose(make(chan *amqp.Error, 1))
+
+		connection.mutex.Lock()
+		connection.conn = nil
+		connection.connected = make(chan struct{})
+		closed := connection.closed
+		connection.mutex.Unlock()
+
+		if closed {
+			return
+		}
+
+		connection.logger.Warn("Lost connection to RabbitMQ, reconnecting", zap.Error(reason))
+
+		var err error
+
+		if conn, err = connection.dial(time.Time{}); err != nil {
+			return
+		}
+
+		connection.logger.Info("Reconnected to RabbitMQ")
+	}
+}
+
+func (connection *Connection) publish(ctx context.Context, exchange string, key string, msg amqp.Publishing,
+	declare bool) error {
+	cc, tag, acked, err := connection.publishOnce(exchange, key, msg, declare)
+
+	if err != nil {
+		return err
+	}
+
+	select {
+	case ack, ok := <-acked:
+		if ok == false {
+			return fmt.Errorf("%w: %s", ErrNotConnected, key)
+		}
+
+		if ack == false {
+			return fmt.Errorf("rpc: broker rejected the message to %s", key)
+		}
+
+		return nil
+	case <-ctx.Done():
+		cc.forget(tag)
+
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return fmt.Errorf("%w: %s", ErrTimeout, key)
+		}
+
+		return ctx.Err()
+	}
+}
+
+// publishOnce publishes the message and returns the channel its confirmation is sent to. Queues are declared once per
+// channel.
+func (connection *Connection) publishOnce(exchange string, key string, msg amqp.Publishing,
+	declare bool) (*confirmChannel, uint64, chan bool, error) {
+	publisher := &connection.publisher
+
+	publisher.mutex.Lock()
+	defer publisher.mutex.Unlock()
+
+	cc, err := connection.openPublisher()
+
+	if err != nil {
+		return nil, 0, nil, err
+	}
+
+	if declare && cc.declared[key] == false {
+		if err := declareQueue(cc.channel, key); err != nil {
+			publisher.reset()
+			return nil, 0, nil, fmt.Errorf("rpc: cannot declare %s: %w", key, err)
+		}
+
+		cc.declared[key] = true
+	}
+
+	// Delivery tags count the publishes of the channel from 1, in the order of the publishes
+	cc.nextTag++
+	tag := cc.nextTag
+	acked := cc.await(tag)
+
+	if err := cc.channel.Publish(exchange, key, false, false, msg); err != nil {
+		cc.forget(tag)
+		publisher.reset()
+		return nil, 0, nil, fmt.Errorf("rpc: cannot publish to %s: %w", key, err)
+	}
+
+	return cc, tag, acked, nil
+}
+
+// openPublisher opens the confirm channel, or a new one if the previous channel was closed by the broker or by a lost
+// connection.
+func (connection *Connection) openPublisher() (*confirmChannel, error) {
+	publisher := &connection.publisher
+
+	if publisher.channel != nil {
+		select {
+		case <-publisher.channel.closes:
+			publisher.channel = nil
+		default:
+			return publisher.channel, nil
+		}
+	}
+
+	ch, err := connection.Channel()
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ch.Confirm(false); err != nil {
+		ch.Close()
+		return nil, err
+	}
+
+	cc := &confirmChannel{channel: ch, closes: ch.NotifyClose(make(chan *amqp.Error, 1)), declared: map[string]bool{},
+		pending: map[uint64]chan bool{}}
+
+	go cc.dispatch(ch.NotifyPublish(make(chan amqp.Confirmation, 64)))
+
+	publisher.channel = cc
+
+	return cc, nil
+}
+
+func (publisher *publisher) reset() {
+	if publisher.channel != nil {
+		publisher.channel.channel.Close()
+		publisher.channel = nil
+	}
+}
+
+func (cc *confirmChannel) await(tag uint64) chan bool {
+	acked := make(chan bool, 1)
+
+	cc.mutex.Lock()
+	cc.pending[tag] = acked
+	cc.mutex.Unlock()
+
+	return acked
+}
+
+func (cc *confirmChannel) forget(tag uint64) {
+	cc.mutex.Lock()
+	delete(cc.pending, tag)
+	cc.mutex.Unlock()
+}
+
+// dispatch sends every confirmation to the publish waiting for it until the channel is closed, then it fails the
+// publishes still waiting.
+func (cc *confirmChannel) dispatch(confirms chan amqp.Confirmation) {
+	for confirmation := range confirms {
+		cc.mutex.Lock()
+
+		if acked, ok := cc.pending[confirmation.DeliveryTag]; ok {
+			delete(cc.pending, confirmation.DeliveryTag)
+			acked <- confirmation.Ack
+		}
+
+		cc.mutex.Unlock()
+	}
+
+	cc.mutex.Lock()
+
+	for tag, acked := range cc.pending {
+		delete(cc.pending, tag)
+		close(acked)
+	}
+
+	cc.mutex.Unlock()
+}
+
+// addConsumer registers the consumer for Shutdown and reports false if the connection is draining already.
+func (connection *Connection) addConsumer(ch *amqp.Channel, consumerTag string) bool {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	if connection.draining {
+		return false
+	}
+
+	connection.consumers[ch] = consumerTag
+
+	return true
+}
+
+// removeConsumer unregisters the consumer and reports whether it stopped because the connection is draining.
+func (connection *Connection) removeConsumer(ch *amqp.Channel) bool {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	delete(connection.consumers, ch)
+
+	return connection.draining
+}
+
+// sleep waits for the duration and reports false if the connection was closed or started draining meanwhile.
+func (connection *Connection) sleep(duration time.Duration) bool {
+	select {
+	case <-time.After(duration):
+		return true
+	case <-connection.done:
+		return false
+	case <-connection.drain:
+		return false
+	}
+}
+
+func consume(conn *amqp.Connection, queueName string, exchange string, keys []string, prefetch int,
+	consumerTag string) (*amqp.Channel, <-chan amqp.Delivery, error) {
+	ch, err := conn.Channel()
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	if err := declareQueue(ch, queueName); err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	if err := declareDeadLetter(ch); err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	if exchange != "" {
+		if err := DeclareTopic(ch, exchange); err != nil {
+			ch.Close()
+			return nil, nil, err
+		}
+
+		for _, key := range keys {
+			if err := ch.QueueBind(queueName, key, exchange, false, nil); err != nil {
+				ch.Close()
+				return nil, nil, err
+			}
+		}
+	}
+
+	// Don't dispatch more messages to this consumer than its workers are handling
+	if err := ch.Qos(prefetch, 0, false); err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	messages, err := ch.Consume(
+		queueName,   // queue
+		consumerTag, // consumer
+		false,       // auto-ack
+		false,       // exclusive
+		false,       // no-local
+		false,       // no-wait
+		nil,         // args
+	)
+
+	if err != nil {
+		ch.Close()
+		return nil, nil, err
+	}
+
+	return ch, messages, nil
+}
+
+func declareQueue(ch *amqp.Channel, queueName string) error {
+	_, err := ch.QueueDeclare(
+		queueName, // name
+		true,      // durable
+		false,     // delete when unused
+		false,     // exclusive
+		false,     // no-wait
+		nil,       // arguments
+	)
+
+	if amqpErr, ok := err.(*amqp.Error); ok && amqpErr.Code == amqp.PreconditionFailed {
+		return fmt.Errorf("rpc: queue %s exists with other settings, delete it once so it is declared durable: %w",
+			queueName, err)
+	}
+
+	return err
+}
+
+// DeclareTopic declares a durable topic exchange.
+func DeclareTopic(ch *amqp.Channel, exchange string) error {
+	return ch.ExchangeDeclare(
+		exchange, // name
+		"topic",  // type
+		true,     // durable
+		false,    // auto-deleted
+		false,    // internal
+		false,    // no-wait
+		nil,      // arguments
+	)
+}
+
+func nextBackoff(backoff time.Duration) time.Duration {
+	if backoff *= 2; backoff > maxBackoff {
+		return maxBackoff
+	}
+
+	return backoff
+}
@@ -0,0 +1,164 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/streadway/amqp"
+	"go.uber.org/zap"
+)
+
+const (
+	// DeadLetterExchange receives the messages consumers failed to handle maxRetries times
+	DeadLetterExchange = "dfs.dead_letter"
+	// DeadLetterQueue collects all messages published to DeadLetterExchange
+	DeadLetterQueue = "dfs.dead_letter"
+
+	maxRetries = 3
+
+	retriesHeader       = "x-retries"
+	originalQueueHeader = "x-original-queue"
+	errorHeader         = "x-error"
+)
+
+var (
+	// ErrMalformed is returned by handlers for messages that cannot be parsed. Such messages are dead-lettered
+	// without retrying.
+	ErrMalformed = errors.New("rpc: malformed message")
+
+	errRedelivered = errors.New("rpc: message was delivered before without being acknowledged")
+)
+
+// DeadLetter is a message from DeadLetterQueue together with the reason it was dead-lettered.
+type DeadLetter struct {
+	Queue          string
+	ContentType    string
+	Body           []byte
+	Error          string
+	Retries        int
+	DeadLetteredAt time.Time
+}
+
+func ParseDeadLetter(msg amqp.Delivery) DeadLetter {
+	queueName, _ := msg.Headers[originalQueueHeader].(string)
+	reason, _ := msg.Headers[errorHeader].(string)
+
+	return DeadLetter{Queue: queueName, ContentType: msg.ContentType, Body: msg.Body, Error: reason,
+		Retries: retryCount(msg), DeadLetteredAt: msg.Timestamp}
+}
+
+// handle runs the handler and acknowledges the delivery once it is handled, retried or dead-lettered. A redelivered
+// message counts as a failed attempt, because the consumer may have crashed while handling it, so a message that
+// crashes the consumer ends up in the dead-letter queue as well.
+func (connection *Connection) handle(ch *amqp.Channel, queueName string, msg amqp.Delivery, handler Handler) {
+	err := errRedelivered
+
+	// Dead letters are never dropped, so they are handled again however often they are redelivered
+	if msg.Redelivered == false || queueName == DeadLetterQueue {
+		err = runHandler(handler, ch, msg)
+	}
+
+	if err == nil {
+		msg.Ack(false)
+		return
+	}
+
+	if queueName == DeadLetterQueue {
+		connection.logger.Error("Cannot handle dead letter", zap.Error(err))
+		connection.sleep(minBackoff)
+		msg.Nack(false, true)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultTimeout)
+	defer cancel()
+
+	retries := retryCount(msg)
+
+	if retries < maxRetries && errors.Is(err, ErrMalformed) == false {
+		connection.logger.Warn("Cannot handle message, retrying", zap.String("Queue", queueName),
+			zap.Int("Retry", retries+1), zap.Error(err))
+
+		err = connection.Publish(ctx, "", queueName, amqp.Publishing{
+			Headers:       withHeader(msg.Headers, retriesHeader, int32(retries+1)),
+			ContentType:   msg.ContentType,
+			CorrelationId: msg.CorrelationId,
+			ReplyTo:       msg.ReplyTo,
+			Expiration:    msg.Expiration,
+			DeliveryMode:  amqp.Persistent,
+			Body:          msg.Body,
+		})
+	} else {
+		connection.logger.Error("Cannot handle message, dead-lettering it", zap.String("Queue", queueName),
+			zap.Int("Retries", retries), zap.Error(err))
+
+		headers := withHeader(msg.Headers, originalQueueHeader, queueName)
+		headers[errorHeader] = err.Error()
+
+		// Without the expiration, because a dead letter is kept until it is replayed or removed
+		err = connection.Publish(ctx, DeadLetterExchange, queueName, amqp.Publishing{
+			Headers:       headers,
+			ContentType:   msg.ContentType,
+			CorrelationId: msg.CorrelationId,
+			DeliveryMode:  amqp.Persistent,
+			Timestamp:     time.Now(),
+			Body:          msg.Body,
+		})
+	}
+
+	if err != nil {
+		connection.logger.Error("Cannot republish message, requeueing it", zap.String("Queue", queueName),
+			zap.Error(err))
+		msg.Nack(false, true)
+		return
+	}
+
+	msg.Ack(false)
+}
+
+func runHandler(handler Handler, ch *amqp.Channel, msg amqp.Delivery) (err error) {
+	defer func() {
+		if reason := recover(); reason != nil {
+			err = fmt.Errorf("rpc: handler panicked: %v", reason)
+		}
+	}()
+
+	return handler(ch, msg)
+}
+
+func declareDeadLetter(ch *amqp.Channel) error {
+	if err := ch.ExchangeDeclare(DeadLetterExchange, "fanout", true, false, false, false, nil); err != nil {
+		return err
+	}
+
+	if err := declareQueue(ch, DeadLetterQueue); err != nil {
+		return err
+	}
+
+	return ch.QueueBind(DeadLetterQueue, "", DeadLetterExchange, false, nil)
+}
+
+func retryCount(msg amqp.Delivery) int {
+	switch retries := msg.Headers[retriesHeader].(type) {
+	case int32:
+		return int(retries)
+	case int64:
+		return int(retries)
+	default:
+		return 0
+	}
+}
+
+func withHeader(headers amqp.Table, key string, value interface{}) amqp.Table {
+	copied := amqp.Table{}
+
+	for name, headerValue := range headers {
+		copied[name] = headerValue
+	}
+
+	copied[key] = value
+
+	return copied
+}
@@ -0,0 +1,145 @@
+package rpc
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Metadata of the signature every gRPC call between the services carries
+const (
+	callTimestampKey = "x-dfs-call-timestamp"
+	callSignatureKey = "x-dfs-call-signature"
+)
+
+// CallMaxAge limits how long a signed call is accepted, so captured calls cannot be replayed later.
+const CallMaxAge = time.Minute
+
+// DialGrpc connects to the gRPC server of another service. The connection is established on the first call and again
+// after it is lost, so it fails only for an invalid address. Calls whose context has no deadline wait at most timeout,
+// DefaultTimeout when it is not positive. Calls are signed with the secret shared by the services (see NewGrpcServer).
+// The NOT_FOUND and UNAUTHENTICATED status codes are reported as ErrNoResult and DEADLINE_EXCEEDED as ErrTimeout, like
+// the responses of Client.
+func DialGrpc(address string, timeout time.Duration, secret string) (*grpc.ClientConn, error) {
+	if timeout <= 0 {
+		timeout = DefaultTimeout
+	}
+
+	return grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithUnaryInterceptor(unaryClientInterceptor(timeout)), SignCalls(secret))
+}
+
+// SignCalls signs the calls of a connection with the secret shared by the services, it does nothing without a secret.
+func SignCalls(secret string) grpc.DialOption {
+	return grpc.WithChainUnaryInterceptor(func(ctx context.Context, method string, req, reply interface{},
+		cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if secret != "" {
+			timestamp := time.Now().Unix()
+			ctx = metadata.AppendToOutgoingContext(ctx, callTimestampKey, strconv.FormatInt(timestamp, 10),
+				callSignatureKey, SignCall(secret, method, timestamp))
+		}
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	})
+}
+
+// NewGrpcServer creates a gRPC server accepting only calls signed with the secret. Without a secret it accepts only
+// calls from the same machine, since the calls return keys and delete user data.
+func NewGrpcServer(secret string) *grpc.Server {
+	return grpc.NewServer(grpc.UnaryInterceptor(unaryServerInterceptor(secret)))
+}
+
+// SignCall returns the signature of the call of the gRPC method at the Unix timestamp, sha256=<hex HMAC-SHA256>.
+func SignCall(secret string, method string, timestamp int64) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	_, _ = fmt.Fprintf(mac, "%s\n%d", method, timestamp)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func unaryClientInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if _, ok := ctx.Deadline(); ok == false {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+
+		err := invoker(ctx, method, req, reply, cc, opts...)
+
+		if err == nil {
+			return nil
+		}
+
+		switch status.Code(err) {
+		case codes.NotFound, codes.Unauthenticated:
+			return fmt.Errorf("%w: %s", ErrNoResult, method)
+		case codes.DeadlineExceeded:
+			return fmt.Errorf("%w: %s", ErrTimeout, method)
+		default:
+			return fmt.Errorf("rpc: %s failed: %w", method, err)
+		}
+	}
+}
+
+func unaryServerInterceptor(secret string) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+		// PERMISSION_DENIED and not UNAUTHENTICATED, which clients report as a missing user
+		if verifyCall(ctx, secret, info.FullMethod) == false {
+			return nil, status.Error(codes.PermissionDenied, "call not signed by a service")
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func verifyCall(ctx context.Context, secret string, method string) bool {
+	if secret == "" {
+		return isLocalPeer(ctx)
+	}
+
+	md, _ := metadata.FromIncomingContext(ctx)
+	timestamps, signatures := md.Get(callTimestampKey), md.Get(callSignatureKey)
+
+	if len(timestamps) != 1 || len(signatures) != 1 {
+		return false
+	}
+
+	timestamp, err := strconv.ParseInt(timestamps[0], 10, 64)
+
+	if err != nil {
+		return false
+	}
+
+	if age := time.Since(time.Unix(timestamp, 0)); age > CallMaxAge || age < -CallMaxAge {
+		return false
+	}
+
+	return hmac.Equal([]byte(signatures[0]), []byte(SignCall(secret, method, timestamp)))
+}
+
+func isLocalPeer(ctx context.Context) bool {
+	p, ok := peer.FromContext(ctx)
+
+	if ok == false {
+		return false
+	}
+
+	address, ok := p.Addr.(*net.TCPAddr)
+
+	return ok && address.IP.IsLoopback()
+}
@@ -0,0 +1,48 @@
+package rpc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Workers sets how many messages of a queue are handled concurrently. Queues not listed in Queues use Default.
+type Workers struct {
+	Default int
+	Queues  map[string]int
+}
+
+// ParseWorkers reads comma separated queue=workers pairs, e.g. "rpc_storage_save_file_on_disk_queue=8".
+func ParseWorkers(defaultWorkers int, queues string) (Workers, error) {
+	workers := Workers{Default: defaultWorkers, Queues: map[string]int{}}
+
+	for _, pair := range strings.Split(queues, ",") {
+		if pair = strings.TrimSpace(pair); pair == "" {
+			continue
+		}
+
+		queueName, value, found := strings.Cut(pair, "=")
+		count, err := strconv.Atoi(strings.TrimSpace(value))
+
+		if found == false || err != nil || count < 1 {
+			return Workers{}, fmt.Errorf("rpc: invalid workers setting %q", pair)
+		}
+
+		workers.Queues[strings.TrimSpace(queueName)] = count
+	}
+
+	return workers, nil
+}
+
+// For returns the number of workers for the queue, at least one.
+func (workers Workers) For(queueName string) int {
+	if count, ok := workers.Queues[queueName]; ok {
+		return count
+	}
+
+	if workers.Default > 0 {
+		return workers.Default
+	}
+
+	return 1
+}
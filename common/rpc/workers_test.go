@@ -0,0 +1,71 @@
+package rpc
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseWorkers(t *testing.T) {
+	tests := []struct {
+		name    string
+		queues  string
+		workers map[string]int
+		valid   bool
+	}{
+		{"empty", "", map[string]int{}, true},
+		{"single queue", "rpc_storage_save_file_on_disk_queue=8",
+			map[string]int{"rpc_storage_save_file_on_disk_queue": 8}, true},
+		{"several queues", "a=2,b=3", map[string]int{"a": 2, "b": 3}, true},
+		{"spaces and empty pairs", " a = 2 , ,b=3,", map[string]int{"a": 2, "b": 3}, true},
+		{"last setting wins", "a=2,a=5", map[string]int{"a": 5}, true},
+		{"without count", "a", nil, false},
+		{"empty count", "a=", nil, false},
+		{"not a number", "a=many", nil, false},
+		{"zero", "a=0", nil, false},
+		{"negative", "a=-1", nil, false},
+		{"one invalid pair", "a=2,b", nil, false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			workers, err := ParseWorkers(4, test.queues)
+
+			if test.valid == false {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", workers)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err)
+			}
+
+			if workers.Default != 4 || reflect.DeepEqual(workers.Queues, test.workers) == false {
+				t.Fatalf("unexpected workers %+v", workers)
+			}
+		})
+	}
+}
+
+func TestWorkersFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		workers Workers
+		queue   string
+		count   int
+	}{
+		{"listed queue", Workers{Default: 4, Queues: map[string]int{"a": 8}}, "a", 8},
+		{"other queue", Workers{Default: 4, Queues: map[string]int{"a": 8}}, "b", 4},
+		{"without default", Workers{}, "a", 1},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if count := test.workers.For(test.queue); count != test.count {
+				t.Fatalf("expected %d, got %d", test.count, count)
+			}
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package config
+
+import (
+	"dfs/common/discovery"
+	"github.com/joho/godotenv"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type Config struct {
+	Address         string
+	AuthGrpcAddress string
+	IdentitySecret  string
+	AllowedOrigins  string
+	RateLimit       int
+	RateLimitWindow time.Duration
+	Discovery       *discovery.Discovery
+	// Base URLs of the HTTP APIs of the services, found through discovery when empty
+	AuthUrl       string
+	StorageUrl    string
+	ShareUrl      string
+	ShareSpaceUrl string
+	WebhookUrl    string
+	AuditUrl      string
+}
+
+func Create() *Config {
+	err := godotenv.Load(".env")
+
+	if err != nil {
+		log.Printf("Cannot load .env file")
+	}
+
+	cfg := &Config{
+		Address:         getEnv("EDGE_ADDRESS", ":8000"),
+		AuthGrpcAddress: os.Getenv("AUTH_GRPC_ADDRESS"),
+		IdentitySecret:  os.Getenv("IDENTITY_SECRET"),
+		AuthUrl:         os.Getenv("AUTH_URL"),
+		StorageUrl:      os.Getenv("STORAGE_URL"),
+		ShareUrl:        os.Getenv("SHARE_URL"),
+		ShareSpaceUrl:   os.Getenv("SHARESPACE_URL"),
+		WebhookUrl:      os.Getenv("WEBHOOK_URL"),
+		AuditUrl:        os.Getenv("AUDIT_URL"),
+	}
+
+	// Without the secret the services could not tell the identity of the gateway from one sent by a client
+	if cfg.IdentitySecret == "" {
+		log.Fatal("IDENTITY_SECRET is not set")
+	}
+
+	cfg.AllowedOrigins = parseOrigins("CORS_ALLOWED_ORIGINS")
+
+	if cfg.Discovery, err = discovery.NewFromEnv(); err != nil {
+		log.Fatalf("Cannot initialize service discovery. Reason: %s", err)
+	}
+
+	if cfg.AuthGrpcAddress == "" {
+		cfg.AuthGrpcAddress = discovery.Target("auth")
+	}
+
+	cfg.RateLimit = parseInt("EDGE_RATE_LIMIT", 600)
+	cfg.RateLimitWindow = parseDuration("EDGE_RATE_LIMIT_WINDOW", time.Minute)
+
+	return cfg
+}
+
+func getEnv(name string, defaultValue string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+
+	return defaultValue
+}
+
+// parseOrigins requires a list of explicit origins, since CORS allows credentials and must not allow every origin
+func parseOrigins(name string) string {
+	var origins []string
+
+	for _, origin := range strings.Split(os.Getenv(name), ",") {
+		if origin = strings.TrimSpace(origin); origin == "" {
+			continue
+		}
+
+		if origin == "*" {
+			log.Fatalf("Invalid %s value. Reason: credentials cannot be allowed for every origin", name)
+		}
+
+		origins = append(origins, origin)
+	}
+
+	if len(origins) == 0 {
+		log.Fatalf("%s is not set", name)
+	}
+
+	return strings.Join(origins, ",")
+}
+
+func parseDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return duration
+}
+
+func parseInt(name string, defaultValue int) int {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return number
+}
@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"dfs/common/discovery"
+	"dfs/common/jwks"
+	"dfs/common/middleware"
+	"dfs/common/rpc"
+	"dfs/edge/config"
+	"dfs/edge/dtos"
+	"dfs/edge/services"
+	"errors"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/proxy"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.uber.org/zap"
+)
+
+// route sends the requests under prefix to the service, at url or at an instance found through discovery. Requests of
+// services with a scope need a user, whose API token must have the scope.
+type route struct {
+	prefix  string
+	service string
+	url     string
+	scope   string
+}
+
+type ProxyController struct {
+	logger    *zap.Logger
+	discovery *discovery.Discovery
+	rpc       *services.RpcClient
+	jwks      *jwks.Verifier
+	secret    string
+	routes    []route
+}
+
+func NewProxyController(cfg *config.Config, logger *zap.Logger, rpcClient *services.RpcClient) *ProxyController {
+	// The auth service checks the requests it gets on its own, it issues the tokens after all
+	routes := []route{
+		{prefix: "/api/file", service: "storage-gateway", url: cfg.StorageUrl, scope: "storage"},
+		{prefix: "/api/share", service: "share", url: cfg.ShareUrl, scope: "share"},
+		{prefix: "/api/sharespace", service: "sharespace", url: cfg.ShareSpaceUrl, scope: "sharespace"},
+		{prefix: "/api/webhooks", service: "webhook", url: cfg.WebhookUrl, scope: "webhook"},
+		{prefix: "/api/audit", service: "audit", url: cfg.AuditUrl, scope: "audit"},
+		{prefix: "/api", service: "auth", url: cfg.AuthUrl},
+		{prefix: "/.well-known", service: "auth", url: cfg.AuthUrl},
+	}
+
+	return &ProxyController{logger: logger, discovery: cfg.Discovery, rpc: rpcClient,
+		jwks: jwks.NewFromEnv(cfg.Discovery), secret: cfg.IdentitySecret, routes: routes}
+}
+
+func (pc *ProxyController) RegisterRoutes(app *fiber.App) {
+	app.All("/api/*", pc.forward)
+	app.All("/.well-known/*", pc.forward)
+}
+
+func (pc *ProxyController) forward(c *fiber.Ctx) error {
+	r, ok := pc.match(c.Path())
+
+	if ok == false {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "Not found"})
+	}
+
+	url := r.url
+
+	if url == "" {
+		address := pc.discovery.Address(r.service, "http")
+
+		if address == "" {
+			pc.logger.Error("No instance of the service found", zap.String("Service", r.service))
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Service unavailable"})
+		}
+
+		url = "http://" + address
+	}
+
+	identity := middleware.RequestIdentity{ClientIp: c.IP()}
+
+	if r.scope != "" {
+		user, status := pc.authenticate(c, r.scope)
+
+		if status != fiber.StatusOK {
+			return c.SendStatus(status)
+		}
+
+		identity.UserId = user.Id
+	}
+
+	middleware.ForwardIdentity(c, pc.secret, identity)
+
+	// Copied, the response of the service overwrites the memory of the header
+	requestId := utils.CopyString(c.GetRespHeader(fiber.HeaderXRequestID))
+	c.Request().Header.Set(fiber.HeaderXRequestID, requestId)
+
+	// The response of the service replaces the headers set by the CORS middleware of the gateway
+	corsHeaders := map[string]string{}
+
+	c.Response().Header.VisitAll(func(key, value []byte) {
+		if strings.HasPrefix(string(key), "Access-Control-") {
+			corsHeaders[string(key)] = string(value)
+		}
+	})
+
+	if err := proxy.Do(c, url+c.OriginalURL()); err != nil {
+		pc.logger.Error("Cannot proxy request", zap.String("Url", url), zap.String("RequestId", requestId),
+			zap.Error(err))
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{"message": "Service unavailable"})
+	}
+
+	var serviceCorsHeaders []string
+
+	c.Response().Header.VisitAll(func(key, _ []byte) {
+		if strings.HasPrefix(string(key), "Access-Control-") {
+			serviceCorsHeaders = append(serviceCorsHeaders, string(key))
+		}
+	})
+
+	for _, key := range serviceCorsHeaders {
+		c.Response().Header.Del(key)
+	}
+
+	for key, value := range corsHeaders {
+		c.Set(key, value)
+	}
+
+	c.Set(fiber.HeaderXRequestID, requestId)
+	c.Response().Header.Del(fiber.HeaderServer)
+
+	return nil
+}
+
+// match returns the first route whose prefix starts the path with whole segments, so the more specific routes come
+// first.
+func (pc *ProxyController) match(path string) (route, bool) {
+	for _, r := range pc.routes {
+		if path == r.prefix || strings.HasPrefix(path, r.prefix+"/") {
+			return r, true
+		}
+	}
+
+	return route{}, false
+}
+
+// authenticate validates the API token or the jwt cookie of the request once for all services. Forged and expired
+// tokens are rejected with the JWKS of the auth service before the user is looked up.
+func (pc *ProxyController) authenticate(c *fiber.Ctx, scope string) (*dtos.UserDto, int) {
+	var user *dtos.UserDto
+	var err error
+
+	if apiToken := middleware.BearerToken(c); apiToken != "" {
+		user, err = pc.rpc.GetUserDataByApiToken(c.UserContext(), apiToken, scope, middleware.ReadOnlyRequest(c))
+	} else if jwt := c.Cookies("jwt"); middleware.VerifyJwt(pc.jwks, pc.logger, jwt) == false {
+		return nil, fiber.StatusUnauthorized
+	} else {
+		user, err = pc.rpc.GetUserDataByJwt(c.UserContext(), jwt)
+	}
+
+	if errors.Is(err, rpc.ErrNoResult) {
+		return nil, fiber.StatusUnauthorized
+	} else if err != nil {
+		pc.logger.Error("Cannot authenticate request", zap.Error(err))
+		return nil, fiber.StatusServiceUnavailable
+	}
+
+	return user, fiber.StatusOK
+}
@@ -0,0 +1,8 @@
+package dtos
+
+type UserDto struct {
+	Id    uint   `json:"id"`
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Role  string `json:"role"`
+}
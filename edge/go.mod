@@ -0,0 +1,3 @@
+module dfs/edge
+
+go 1.18
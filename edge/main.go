@@ -0,0 +1,15 @@
+package main
+
+import (
+	"dfs/edge/config"
+	"dfs/edge/microservice"
+)
+
+func main() {
+	cfg := config.Create()
+
+	edgeMicroservice := microservice.NewEdgeMicroservice(cfg)
+	edgeMicroservice.Setup()
+	defer edgeMicroservice.Cleanup()
+	edgeMicroservice.Run()
+}
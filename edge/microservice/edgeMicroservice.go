@@ -0,0 +1,94 @@
+package microservice
+
+import (
+	"log"
+	"os"
+	"os/signal"
+
+	"dfs/common/middleware"
+	"dfs/edge/config"
+	"dfs/edge/controllers"
+	"dfs/edge/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/requestid"
+	"go.uber.org/zap"
+)
+
+type EdgeMicroservice struct {
+	config          *config.Config
+	logger          *zap.Logger
+	app             *fiber.App
+	rpcClient       *services.RpcClient
+	proxyController *controllers.ProxyController
+}
+
+func NewEdgeMicroservice(cfg *config.Config) *EdgeMicroservice {
+	loggerCfg := zap.NewDevelopmentConfig()
+	loggerCfg.EncoderConfig.FunctionKey = "func"
+	logger, err := loggerCfg.Build()
+
+	if err != nil {
+		log.Fatalf("Cannot initialize zap logger. Reason: %s", err)
+	}
+
+	rpcClient, err := services.NewRpcClient(logger, cfg)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize RPC client. Reason: %s", err)
+	}
+
+	app := fiber.New()
+	proxyController := controllers.NewProxyController(cfg, logger, rpcClient)
+
+	return &EdgeMicroservice{config: cfg, logger: logger, app: app, rpcClient: rpcClient,
+		proxyController: proxyController}
+}
+
+func (ems *EdgeMicroservice) Setup() {
+	ems.app.Use(requestid.New())
+
+	ems.app.Use(cors.New(cors.Config{
+		AllowOrigins:     ems.config.AllowedOrigins,
+		AllowCredentials: true,
+		ExposeHeaders:    fiber.HeaderXRequestID,
+	}))
+
+	ems.app.Get("/ready", middleware.Readiness(map[string]func() bool{"auth": ems.rpcClient.Ready}))
+
+	ems.app.Use(middleware.RateLimiter(middleware.RateLimiterConfig{
+		Max:      ems.config.RateLimit,
+		Window:   ems.config.RateLimitWindow,
+		MaxBlock: 15 * ems.config.RateLimitWindow,
+	}))
+
+	ems.proxyController.RegisterRoutes(ems.app)
+}
+
+func (ems *EdgeMicroservice) Run() {
+	ems.HandleInterrupt()
+
+	if err := ems.app.Listen(ems.config.Address); err != nil {
+		ems.Cleanup()
+		ems.logger.Panic("Cannot setup fiber listener", zap.Error(err))
+	}
+}
+
+func (ems *EdgeMicroservice) HandleInterrupt() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		_ = <-c
+		ems.logger.Debug("Gracefully shutting down...")
+		_ = ems.app.Shutdown()
+	}()
+}
+
+func (ems *EdgeMicroservice) Cleanup() {
+	ems.rpcClient.Close()
+
+	if err := ems.logger.Sync(); err != nil {
+		log.Printf("Cannot sync logger. Error: %s", err)
+	}
+}
@@ -0,0 +1,34 @@
+package services
+
+import (
+	"dfs/common/lookup"
+	"dfs/edge/config"
+	"dfs/edge/dtos"
+	"dfs/proto"
+
+	"go.uber.org/zap"
+)
+
+// RpcClient calls the auth service over gRPC.
+type RpcClient struct {
+	*lookup.Users[dtos.UserDto]
+	logger *zap.Logger
+}
+
+func NewRpcClient(logger *zap.Logger, cfg *config.Config) (*RpcClient, error) {
+	users, err := lookup.NewUsers(cfg.AuthGrpcAddress, cfg.IdentitySecret, createUserDto)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &RpcClient{Users: users, logger: logger}, nil
+}
+
+func (rpc *RpcClient) Close() {
+	rpc.Users.Close()
+}
+
+func createUserDto(userData *proto.UserData) *dtos.UserDto {
+	return &dtos.UserDto{Id: uint(userData.Id), Name: userData.Name, Email: userData.Email, Role: userData.Role}
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"github.com/joho/godotenv"
+	"log"
+	"net"
+	"os"
+	"time"
+)
+
+type Config struct {
+	Address string
+	// Token the services send as "Authorization: Bearer <token>", only optional on a loopback address
+	Token  string
+	MaxTtl time.Duration
+}
+
+func Create() *Config {
+	err := godotenv.Load(".env")
+
+	if err != nil {
+		log.Printf("Cannot load .env file")
+	}
+
+	cfg := &Config{
+		Address: os.Getenv("REGISTRY_ADDRESS"),
+		Token:   os.Getenv("REGISTRY_TOKEN"),
+	}
+
+	if cfg.Address == "" {
+		cfg.Address = "127.0.0.1:8070"
+	}
+
+	// Anyone reaching the registry could otherwise point the services, and the edge gateway, to their own instances
+	if cfg.Token == "" && isLoopbackAddress(cfg.Address) == false {
+		log.Fatal("REGISTRY_TOKEN is not set, which is only allowed for a loopback REGISTRY_ADDRESS")
+	}
+
+	cfg.MaxTtl = parseDuration("REGISTRY_MAX_TTL", 5*time.Minute)
+
+	return cfg
+}
+
+func isLoopbackAddress(address string) bool {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return false
+	}
+
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+
+	return ip != nil && ip.IsLoopback()
+}
+
+func parseDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return duration
+}
@@ -0,0 +1,67 @@
+package controllers
+
+import (
+	"dfs/common/discovery"
+	"dfs/registry/config"
+	"dfs/registry/services"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"go.uber.org/zap"
+)
+
+type RegistryController struct {
+	logger   *zap.Logger
+	maxTtl   time.Duration
+	registry *services.RegistryService
+}
+
+func NewRegistryController(cfg *config.Config, logger *zap.Logger,
+	registry *services.RegistryService) *RegistryController {
+	return &RegistryController{logger: logger, maxTtl: cfg.MaxTtl, registry: registry}
+}
+
+func (rc *RegistryController) RegisterRoutes(app *fiber.App) {
+	app.Get("/api/instances", rc.getServices)
+	app.Get("/api/instances/:service", rc.getInstances)
+	app.Put("/api/instances/:service/:id", rc.register)
+	app.Delete("/api/instances/:service/:id", rc.deregister)
+}
+
+func (rc *RegistryController) getServices(c *fiber.Ctx) error {
+	return c.JSON(rc.registry.Services())
+}
+
+func (rc *RegistryController) getInstances(c *fiber.Ctx) error {
+	return c.JSON(rc.registry.Lookup(c.Params("service")))
+}
+
+// register adds the instance or renews it for the TTL of the registration.
+func (rc *RegistryController) register(c *fiber.Ctx) error {
+	var registration discovery.Registration
+
+	if err := c.BodyParser(&registration); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid registration"})
+	}
+
+	ttl := time.Duration(registration.Ttl) * time.Second
+
+	if len(registration.Endpoints) == 0 || ttl <= 0 || ttl > rc.maxTtl {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid registration"})
+	}
+
+	// Copied, the parameters point into the request buffer which is reused
+	rc.registry.Register(discovery.Instance{Service: utils.CopyString(c.Params("service")),
+		Id: utils.CopyString(c.Params("id")), Endpoints: registration.Endpoints}, ttl)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (rc *RegistryController) deregister(c *fiber.Ctx) error {
+	if rc.registry.Deregister(c.Params("service"), c.Params("id")) == false {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
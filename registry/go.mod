@@ -0,0 +1,3 @@
+module dfs/registry
+
+go 1.18
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"dfs/registry/config"
+	"dfs/registry/microservice"
+)
+
+func main() {
+	cfg := config.Create()
+
+	registryMicroservice := microservice.NewRegistryMicroservice(cfg)
+	registryMicroservice.Setup()
+	defer registryMicroservice.Cleanup()
+	registryMicroservice.Run()
+}
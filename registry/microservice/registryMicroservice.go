@@ -0,0 +1,85 @@
+package microservice
+
+import (
+	"crypto/subtle"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"dfs/common/middleware"
+	"dfs/registry/config"
+	"dfs/registry/controllers"
+	"dfs/registry/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+type RegistryMicroservice struct {
+	config             *config.Config
+	logger             *zap.Logger
+	app                *fiber.App
+	registry           *services.RegistryService
+	registryController *controllers.RegistryController
+}
+
+func NewRegistryMicroservice(cfg *config.Config) *RegistryMicroservice {
+	loggerCfg := zap.NewDevelopmentConfig()
+	loggerCfg.EncoderConfig.FunctionKey = "func"
+	logger, err := loggerCfg.Build()
+
+	if err != nil {
+		log.Fatalf("Cannot initialize zap logger. Reason: %s", err)
+	}
+
+	app := fiber.New()
+	registry := services.NewRegistryService(logger)
+	registryController := controllers.NewRegistryController(cfg, logger, registry)
+
+	return &RegistryMicroservice{config: cfg, logger: logger, app: app, registry: registry,
+		registryController: registryController}
+}
+
+func (rms *RegistryMicroservice) Setup() {
+	rms.app.Get("/ready", middleware.Readiness(map[string]func() bool{}))
+
+	rms.app.Use(func(c *fiber.Ctx) error {
+		if rms.config.Token != "" &&
+			subtle.ConstantTimeCompare([]byte(middleware.BearerToken(c)), []byte(rms.config.Token)) != 1 {
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		return c.Next()
+	})
+
+	rms.registryController.RegisterRoutes(rms.app)
+}
+
+func (rms *RegistryMicroservice) Run() {
+	rms.registry.Start(time.Minute)
+	rms.HandleInterrupt()
+
+	if err := rms.app.Listen(rms.config.Address); err != nil {
+		rms.Cleanup()
+		rms.logger.Panic("Cannot setup fiber listener", zap.Error(err))
+	}
+}
+
+func (rms *RegistryMicroservice) HandleInterrupt() {
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, os.Interrupt)
+	go func() {
+		_ = <-c
+		rms.logger.Debug("Gracefully shutting down...")
+		_ = rms.app.Shutdown()
+	}()
+}
+
+func (rms *RegistryMicroservice) Cleanup() {
+	rms.registry.Stop()
+
+	if err := rms.logger.Sync(); err != nil {
+		log.Printf("Cannot sync logger. Error: %s", err)
+	}
+}
@@ -0,0 +1,145 @@
+package services
+
+import (
+	"dfs/common/discovery"
+	"sort"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+type entry struct {
+	instance discovery.Instance
+	expires  time.Time
+}
+
+// RegistryService keeps the registered instances in memory. An instance that is not renewed within its TTL is
+// dropped, so crashed instances disappear without deregistering.
+type RegistryService struct {
+	logger  *zap.Logger
+	mutex   sync.Mutex
+	entries map[string]map[string]*entry
+	stop    chan struct{}
+}
+
+func NewRegistryService(logger *zap.Logger) *RegistryService {
+	return &RegistryService{logger: logger, entries: map[string]map[string]*entry{}, stop: make(chan struct{})}
+}
+
+func (rs *RegistryService) Register(instance discovery.Instance, ttl time.Duration) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	instances, ok := rs.entries[instance.Service]
+
+	if ok == false {
+		instances = map[string]*entry{}
+		rs.entries[instance.Service] = instances
+	}
+
+	if _, ok := instances[instance.Id]; ok == false {
+		rs.logger.Info("Instance registered", zap.String("Service", instance.Service), zap.String("Id", instance.Id),
+			zap.Any("Endpoints", instance.Endpoints))
+	}
+
+	instances[instance.Id] = &entry{instance: instance, expires: time.Now().Add(ttl)}
+}
+
+func (rs *RegistryService) Deregister(service string, id string) bool {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	if _, ok := rs.entries[service][id]; ok == false {
+		return false
+	}
+
+	delete(rs.entries[service], id)
+	rs.logger.Info("Instance deregistered", zap.String("Service", service), zap.String("Id", id))
+
+	return true
+}
+
+// Lookup returns the live instances of the service, ordered by id.
+func (rs *RegistryService) Lookup(service string) []discovery.Instance {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	now := time.Now()
+	instances := []discovery.Instance{}
+
+	for _, e := range rs.entries[service] {
+		if now.Before(e.expires) {
+			instances = append(instances, e.instance)
+		}
+	}
+
+	sort.Slice(instances, func(i, j int) bool {
+		return instances[i].Id < instances[j].Id
+	})
+
+	return instances
+}
+
+// Services returns the live instances of all services.
+func (rs *RegistryService) Services() map[string][]discovery.Instance {
+	rs.mutex.Lock()
+	services := make([]string, 0, len(rs.entries))
+
+	for service := range rs.entries {
+		services = append(services, service)
+	}
+
+	rs.mutex.Unlock()
+
+	result := map[string][]discovery.Instance{}
+
+	for _, service := range services {
+		if instances := rs.Lookup(service); len(instances) > 0 {
+			result[service] = instances
+		}
+	}
+
+	return result
+}
+
+// Start removes the expired instances every interval until Stop.
+func (rs *RegistryService) Start(interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-rs.stop:
+				return
+			case <-ticker.C:
+				rs.removeExpired()
+			}
+		}
+	}()
+}
+
+func (rs *RegistryService) Stop() {
+	close(rs.stop)
+}
+
+func (rs *RegistryService) removeExpired() {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	now := time.Now()
+
+	for service, instances := range rs.entries {
+		for id, e := range instances {
+			if now.After(e.expires) {
+				delete(instances, id)
+				rs.logger.Info("Instance expired", zap.String("Service", service), zap.String("Id", id))
+			}
+		}
+
+		if len(instances) == 0 {
+			delete(rs.entries, service)
+		}
+	}
+}
@@ -1,13 +1,22 @@
 package config
 
 import (
+	"dfs/common/discovery"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"time"
 )
 
 type Config struct {
 	DbConnectionString string
+	AmqpUrl            string
+	HttpAddress        string
+	Discovery          *discovery.Discovery
+	AmqpConnectTimeout time.Duration
+	GrpcAddress        string
+	AuthGrpcAddress    string
+	IdentitySecret     string
 }
 
 func Create() *Config {
@@ -18,7 +27,51 @@ func Create() *Config {
 	}
 	cfg := &Config{
 		DbConnectionString: os.Getenv("DB_CONNECTION_STRING"),
+		AmqpUrl:            os.Getenv("AMQP_URL"),
+		GrpcAddress:        os.Getenv("GRPC_ADDRESS"),
+		AuthGrpcAddress:    os.Getenv("AUTH_GRPC_ADDRESS"),
+		IdentitySecret:     os.Getenv("IDENTITY_SECRET"),
 	}
 
+	if cfg.Discovery, err = discovery.NewFromEnv(); err != nil {
+		log.Fatalf("Cannot initialize service discovery. Reason: %s", err)
+	}
+
+	if cfg.AmqpUrl == "" {
+		cfg.AmqpUrl = cfg.Discovery.Address("rabbitmq", "amqp")
+	}
+
+	cfg.HttpAddress = os.Getenv("HTTP_ADDRESS")
+
+	if cfg.HttpAddress == "" {
+		cfg.HttpAddress = ":8082"
+	}
+
+	if cfg.GrpcAddress == "" {
+		cfg.GrpcAddress = "localhost:9082"
+	}
+
+	if cfg.AuthGrpcAddress == "" {
+		cfg.AuthGrpcAddress = discovery.Target("auth")
+	}
+
+	cfg.AmqpConnectTimeout = parseDuration("AMQP_CONNECT_TIMEOUT", time.Minute)
+
 	return cfg
 }
+
+func parseDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return duration
+}
@@ -1,10 +1,14 @@
 package controllers
 
 import (
+	"dfs/common/audit"
+	"dfs/common/events"
+	"dfs/common/rpc"
 	"dfs/share/database"
 	"dfs/share/dtos"
 	"dfs/share/services"
 	"encoding/base64"
+	"errors"
 	"fmt"
 	"path"
 
@@ -18,10 +22,12 @@ type ShareController struct {
 	rpc    *services.RpcClient
 	store  *session.Store
 	shRepo *database.ShareRepository
+	events *events.Bus
 }
 
-func NewShareController(logger *zap.Logger, rpcClient *services.RpcClient, store *session.Store, shRepo *database.ShareRepository) *ShareController {
-	return &ShareController{log: logger, rpc: rpcClient, store: store, shRepo: shRepo}
+func NewShareController(logger *zap.Logger, rpcClient *services.RpcClient, store *session.Store,
+	shRepo *database.ShareRepository, bus *events.Bus) *ShareController {
+	return &ShareController{log: logger, rpc: rpcClient, store: store, shRepo: shRepo, events: bus}
 }
 
 func (sc *ShareController) RegisterRoutes(app *fiber.App) {
@@ -53,26 +59,43 @@ func (sc *ShareController) shareFile(c *fiber.Ctx) error {
 
 	sharedBy := sess.Get("userData").(dtos.UserDto)
 
+	defer audit.Record(c, sc.events, sc.log, events.AuditRecordedV1{ActorId: sharedBy.Id, Action: audit.ShareCreate,
+		Resource: fmt.Sprintf("share:%d:%d", shareDto.FileId, shareDto.SharedToId)})
+
 	if shareDto.SharedById != sharedBy.Id {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot share as other user"})
 	}
 
-	sharedFor := sc.rpc.GetUserDataById(shareDto.SharedToId)
+	sharedFor, err := sc.rpc.GetUserDataById(c.UserContext(), shareDto.SharedToId)
 
-	if sharedFor == nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot share file"})
+	if err != nil {
+		return sc.rpcError(c, err, "cannot share file")
 	}
 
-	sharedFile := sc.rpc.GetOwnedFile(&dtos.OwnedFileDto{OwnerId: shareDto.SharedById, FileId: shareDto.FileId})
+	sharedFile, err := sc.rpc.GetOwnedFile(c.UserContext(),
+		&dtos.OwnedFileDto{OwnerId: shareDto.SharedById, FileId: shareDto.FileId})
 
-	if sharedFile == nil {
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot share nonexistent file"})
+	if err != nil {
+		return sc.rpcError(c, err, "cannot share nonexistent file")
 	}
 
-	if sc.shRepo.CreateShareFileEntry(sharedFile.Id, sharedFor.Id, sharedBy.Id, shareDto.ExpirationTime) == false {
+	if sharedFile.ClientEncrypted && shareDto.WrappedKey == "" {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "client encrypted file requires wrapped key"})
+	}
+
+	if sc.shRepo.CreateShareFileEntry(sharedFile.Id, sharedFor.Id, sharedBy.Id, shareDto.ExpirationTime,
+		shareDto.WrappedKey) == false {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot share file"})
 	}
 
+	// The share is stored, so a failed event is only logged
+	err = sc.events.Publish(c.UserContext(), events.ShareCreated, 1, events.ShareCreatedV1{FileId: sharedFile.Id,
+		SharedForId: sharedFor.Id, SharedById: sharedBy.Id, ExpirationTime: shareDto.ExpirationTime})
+
+	if err != nil {
+		sc.log.Error("Cannot publish event", zap.String("Event", events.ShareCreated), zap.Error(err))
+	}
+
 	return c.SendStatus(fiber.StatusOK)
 }
 
@@ -91,9 +114,29 @@ func (sc *ShareController) getFilesSharedForUser(c *fiber.Ctx) error {
 	var files []dtos.SharedFileDto
 
 	for _, share := range shares {
-		file := sc.rpc.GetFileById(share.FileId)
-		fileOwner := sc.rpc.GetUserDataById(file.OwnerId)
-		sharedBy := sc.rpc.GetUserDataById(share.SharedById)
+		file, err := sc.rpc.GetFileById(c.UserContext(), share.FileId)
+
+		if errors.Is(err, rpc.ErrNoResult) {
+			continue
+		} else if err != nil {
+			return sc.rpcError(c, err, "")
+		}
+
+		fileOwner, err := sc.rpc.GetUserDataById(c.UserContext(), file.OwnerId)
+
+		if errors.Is(err, rpc.ErrNoResult) {
+			continue
+		} else if err != nil {
+			return sc.rpcError(c, err, "")
+		}
+
+		sharedBy, err := sc.rpc.GetUserDataById(c.UserContext(), share.SharedById)
+
+		if errors.Is(err, rpc.ErrNoResult) {
+			continue
+		} else if err != nil {
+			return sc.rpcError(c, err, "")
+		}
 
 		sharedFile := dtos.SharedFileDto{
 			Name:        file.Name,
@@ -103,6 +146,11 @@ func (sc *ShareController) getFilesSharedForUser(c *fiber.Ctx) error {
 			AvailableTo: share.ExpirationTime,
 		}
 
+		if file.ClientEncrypted {
+			sharedFile.ClientEncrypted = true
+			sharedFile.WrappedKey = share.WrappedKey
+		}
+
 		files = append(files, sharedFile)
 	}
 
@@ -124,13 +172,27 @@ func (sc *ShareController) getFilesSharedByUser(c *fiber.Ctx) error {
 	var files []dtos.SharedForDto
 
 	for _, share := range shares {
-		file := sc.rpc.GetOwnedFile(&dtos.OwnedFileDto{FileId: share.FileId, OwnerId: user.Id})
+		file, err := sc.rpc.GetOwnedFile(c.UserContext(), &dtos.OwnedFileDto{FileId: share.FileId, OwnerId: user.Id})
+
+		if errors.Is(err, rpc.ErrNoResult) {
+			continue
+		} else if err != nil {
+			return sc.rpcError(c, err, "")
+		}
+
 		sharedForEntries := sc.shRepo.GetSharedEntriesByFileId(file.Id)
 
 		var sharedForUsers []string
 
 		for _, sharedFor := range sharedForEntries {
-			user := sc.rpc.GetUserDataById(sharedFor.SharedForId)
+			user, err := sc.rpc.GetUserDataById(c.UserContext(), sharedFor.SharedForId)
+
+			if errors.Is(err, rpc.ErrNoResult) {
+				continue
+			} else if err != nil {
+				return sc.rpcError(c, err, "")
+			}
+
 			userName := fmt.Sprintf("%s (%s)", user.Name, user.Email)
 
 			sharedForUsers = append(sharedForUsers, userName)
@@ -166,6 +228,9 @@ func (sc *ShareController) unshareFile(c *fiber.Ctx) error {
 
 	user := sess.Get("userData").(dtos.UserDto)
 
+	defer audit.Record(c, sc.events, sc.log, events.AuditRecordedV1{ActorId: user.Id, Action: audit.ShareDelete,
+		Resource: fmt.Sprintf("share:%d:%d", unshareDto.FileId, unshareDto.SharedForId)})
+
 	if sc.shRepo.DeleteShareFileEntry(unshareDto.FileId, unshareDto.SharedForId, user.Id) == false {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot unshare file"})
 	}
@@ -185,10 +250,13 @@ func (sc *ShareController) downloadSharedFile(ctx *fiber.Ctx) error {
 
 	userData := sess.Get("userData").(dtos.UserDto)
 
-	file := sc.rpc.GetFileByUniqueName(fileUniqueName)
+	defer audit.Record(ctx, sc.events, sc.log, events.AuditRecordedV1{ActorId: userData.Id,
+		Action: audit.ShareDownload, Resource: "file:" + fileUniqueName})
 
-	if file == nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot download non-shared file"})
+	file, err := sc.rpc.GetFileByUniqueName(ctx.UserContext(), fileUniqueName)
+
+	if err != nil {
+		return sc.rpcError(ctx, err, "cannot download non-shared file")
 	}
 
 	sharedFileEntry := sc.shRepo.GetSharedForFileEntry(file.Id, userData.Id)
@@ -197,13 +265,29 @@ func (sc *ShareController) downloadSharedFile(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot download non-shared file"})
 	}
 
-	fileOwner := sc.rpc.GetUserDataById(file.OwnerId)
+	fileOwner, err := sc.rpc.GetUserDataById(ctx.UserContext(), file.OwnerId)
 
-	if fileOwner == nil {
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot download non-shared file"})
+	if err != nil {
+		return sc.rpcError(ctx, err, "cannot download non-shared file")
 	}
 
 	readPath := path.Join(fileOwner.HomeDirectory, file.UniqueName)
+
+	if file.ClientEncrypted {
+		fileContent, err := sc.rpc.ReadFileFromDisk(ctx.UserContext(),
+			dtos.ReadFileDto{ReadPath: readPath, ClientEncrypted: true})
+
+		if err != nil {
+			sc.log.Error("Cannot read client encrypted shared file from disk", zap.Error(err))
+			return sc.rpcError(ctx, err, "cannot download shared file")
+		}
+
+		ctx.Set("X-Client-Encrypted", "true")
+		ctx.Set("X-Key-Metadata", base64.StdEncoding.EncodeToString([]byte(sharedFileEntry.WrappedKey)))
+
+		return ctx.Send(fileContent)
+	}
+
 	decryptionKey, err := base64.StdEncoding.DecodeString(fileOwner.CryptKey)
 
 	if err != nil {
@@ -211,14 +295,34 @@ func (sc *ShareController) downloadSharedFile(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot download shared file"})
 	}
 
-	readFileDto := dtos.ReadFileDto{ReadPath: readPath, DecryptionKey: decryptionKey}
+	fallbackDecryptionKey, err := base64.StdEncoding.DecodeString(fileOwner.PreviousCryptKey)
 
-	fileContent := sc.rpc.ReadFileFromDisk(readFileDto)
+	if err != nil {
+		sc.log.Error("Cannot decode previous decryption key", zap.Error(err))
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot download shared file"})
+	}
 
-	if fileContent == nil {
+	readFileDto := dtos.ReadFileDto{ReadPath: readPath, DecryptionKey: decryptionKey,
+		FallbackDecryptionKey: fallbackDecryptionKey}
+
+	fileContent, err := sc.rpc.ReadFileFromDisk(ctx.UserContext(), readFileDto)
+
+	if err != nil {
 		sc.log.Error("Cannot read shared file from disk", zap.Error(err))
-		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot download shared file"})
+		return sc.rpcError(ctx, err, "cannot download shared file")
 	}
 
 	return ctx.Send(fileContent)
 }
+
+// rpcError answers 400 with the message when the requested item does not exist, and 503 when the other service did
+// not respond.
+func (sc *ShareController) rpcError(c *fiber.Ctx, err error, message string) error {
+	if errors.Is(err, rpc.ErrNoResult) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": message})
+	}
+
+	sc.log.Error("RPC call failed", zap.Error(err))
+
+	return c.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"message": "service unavailable, try again later"})
+}
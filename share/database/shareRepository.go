@@ -16,12 +16,14 @@ func NewShareRepository(log *zap.Logger, db *gorm.DB) *ShareRepository {
 	return &ShareRepository{logger: log, database: db}
 }
 
-func (sr *ShareRepository) CreateShareFileEntry(fileId uint, sharedForId uint, sharedById uint, expirationTime time.Time) bool {
+func (sr *ShareRepository) CreateShareFileEntry(fileId uint, sharedForId uint, sharedById uint, expirationTime time.Time,
+	wrappedKey string) bool {
 	share := models.Share{
 		FileId:         fileId,
 		SharedForId:    sharedForId,
 		SharedById:     sharedById,
 		ExpirationTime: expirationTime,
+		WrappedKey:     wrappedKey,
 	}
 
 	if err := sr.database.Create(&share).Error; err != nil {
@@ -86,3 +88,37 @@ func (sr *ShareRepository) GetSharedByUserFilesEntries(sharedById uint) []models
 
 	return sharedFiles
 }
+
+// GetUserShares returns shares created by or for the user. A failed query returns nil, unlike a user without shares.
+func (sr *ShareRepository) GetUserShares(userId uint) []models.Share {
+	shares := []models.Share{}
+
+	err := sr.database.Where("shared_for_id = ? OR shared_by_id = ?", userId, userId).Find(&shares).Error
+
+	if err != nil {
+		sr.logger.Error("Cannot find user shares", zap.Uint("UserId", userId), zap.Error(err))
+		return nil
+	}
+
+	return shares
+}
+
+func (sr *ShareRepository) DeleteFileShares(fileId uint) bool {
+	if err := sr.database.Where("file_id = ?", fileId).Delete(&models.Share{}).Error; err != nil {
+		sr.logger.Error("Cannot delete file shares", zap.Uint("FileId", fileId), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (sr *ShareRepository) DeleteUserShares(userId uint) bool {
+	err := sr.database.Where("shared_for_id = ? OR shared_by_id = ?", userId, userId).Delete(&models.Share{}).Error
+
+	if err != nil {
+		sr.logger.Error("Cannot delete user shares", zap.Uint("UserId", userId), zap.Error(err))
+		return false
+	}
+
+	return true
+}
@@ -5,5 +5,7 @@ type FileDto struct {
 	UniqueName string `json:"uniqueName" gorm:"unique"`
 	Name       string `json:"name"`
 	//CreationDate time.Time `json:"creationDate"`
-	OwnerId uint `json:"ownerId"`
+	OwnerId         uint   `json:"ownerId"`
+	ClientEncrypted bool   `json:"clientEncrypted"`
+	KeyMetadata     string `json:"keyMetadata"`
 }
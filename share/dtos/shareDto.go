@@ -7,4 +7,5 @@ type ShareDto struct {
 	SharedToId     uint      `json:"sharedToId"`
 	SharedById     uint      `json:"sharedById"`
 	ExpirationTime time.Time `json:"expirationTime"`
+	WrappedKey     string    `json:"wrappedKey"`
 }
@@ -3,9 +3,11 @@ package dtos
 import "time"
 
 type SharedFileDto struct {
-	UniqueName  string    `json:"uniqueName"`
-	Name        string    `json:"name"`
-	Owner       string    `json:"owner"`
-	SharedBy    string    `json:"sharedBy"`
-	AvailableTo time.Time `json:"availableTo"`
+	UniqueName      string    `json:"uniqueName"`
+	Name            string    `json:"name"`
+	Owner           string    `json:"owner"`
+	SharedBy        string    `json:"sharedBy"`
+	AvailableTo     time.Time `json:"availableTo"`
+	ClientEncrypted bool      `json:"clientEncrypted"`
+	WrappedKey      string    `json:"wrappedKey,omitempty"`
 }
@@ -1,10 +1,11 @@
 package dtos
 
 type UserDto struct {
-	Id            uint   `json:"id"`
-	Name          string `json:"name"`
-	Email         string `json:"email" gorm:"unique"`
-	Verified      bool   `json:"verified"`
-	HomeDirectory string `json:"directory"`
-	CryptKey      string `json:"cryptKey"`
+	Id               uint   `json:"id"`
+	Name             string `json:"name"`
+	Email            string `json:"email" gorm:"unique"`
+	Verified         bool   `json:"verified"`
+	HomeDirectory    string `json:"directory"`
+	CryptKey         string `json:"cryptKey"`
+	PreviousCryptKey string `json:"previousCryptKey"`
 }
@@ -1,9 +1,16 @@
 package microservice
 
 import (
+	"dfs/common/discovery"
+	"dfs/common/jwks"
 	"dfs/share/config"
 	"log"
+	"net"
 
+	"dfs/common/events"
+	"dfs/common/middleware"
+	"dfs/common/rpc"
+	"dfs/proto"
 	"dfs/share/controllers"
 	"dfs/share/database"
 	"dfs/share/dtos"
@@ -12,6 +19,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -22,10 +30,12 @@ type ShareMicroservice struct {
 	app             *fiber.App
 	store           *session.Store
 	database        *gorm.DB
+	broker          *rpc.Connection
 	shareRepository *database.ShareRepository
 	rpcClient       *services.RpcClient
-	rpcServer       *services.RpcServer
+	grpcServer      *services.GRpcShareServer
 	fileController  *controllers.ShareController
+	subscriber      *services.EventSubscriber
 }
 
 func NewShareMicroservice() *ShareMicroservice {
@@ -44,16 +54,35 @@ func NewShareMicroservice() *ShareMicroservice {
 		log.Fatalf("Cannot initialize database service. Reason: %s", err)
 	}
 
+	broker, err := rpc.Dial(cfg.AmqpUrl, logger, cfg.AmqpConnectTimeout)
+
+	if err != nil {
+		log.Fatalf("Cannot connect to RabbitMQ. Reason: %s", err)
+	}
+
+	rpcClient, err := services.NewRpcClient(logger, broker, cfg)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize RPC client. Reason: %s", err)
+	}
+
+	bus, err := events.NewBus(broker, logger, "share")
+
+	if err != nil {
+		log.Fatalf("Cannot initialize event bus. Reason: %s", err)
+	}
+
 	app := fiber.New()
-	rpcClient := services.NewRpcClient(logger)
-	rpcServer := services.NewRpcServer(logger)
 	shareRepo := database.NewShareRepository(logger, databaseService)
+	grpcServer := services.NewGrpcShareServer(logger, shareRepo)
 	store := session.New()
-	fileController := controllers.NewShareController(logger, rpcClient, store, shareRepo)
+	fileController := controllers.NewShareController(logger, rpcClient, store, shareRepo, bus)
+	subscriber := services.NewEventSubscriber(logger, bus, shareRepo)
 	store.RegisterType(dtos.UserDto{})
 
 	return &ShareMicroservice{config: cfg, logger: logger, app: app, store: store, database: databaseService,
-		rpcClient: rpcClient, rpcServer: rpcServer, shareRepository: shareRepo, fileController: fileController}
+		broker: broker, rpcClient: rpcClient, grpcServer: grpcServer, shareRepository: shareRepo,
+		fileController: fileController, subscriber: subscriber}
 }
 
 func (sms *ShareMicroservice) Setup() {
@@ -61,39 +90,43 @@ func (sms *ShareMicroservice) Setup() {
 		AllowCredentials: true,
 	}))
 
-	sms.app.Use(func(c *fiber.Ctx) error {
-		cookie := c.Cookies("jwt")
+	sms.app.Get("/ready", middleware.Readiness(map[string]func() bool{"broker": sms.broker.Ready}))
 
-		userData := sms.rpcClient.GetUserDataByJwt(cookie)
+	sms.app.Use(middleware.Identity(sms.config.IdentitySecret))
+	sms.app.Use(middleware.Authenticate(middleware.Authentication[*dtos.UserDto]{Store: sms.store,
+		Logger: sms.logger, Scope: "share", Jwks: jwks.NewFromEnv(sms.config.Discovery),
+		ById: sms.rpcClient.GetUserDataById, ByJwt: sms.rpcClient.GetUserDataByJwt,
+		ByApiToken: sms.rpcClient.GetUserDataByApiToken}))
 
-		if userData == nil {
-			return c.SendStatus(fiber.StatusUnauthorized)
-		}
+	sms.fileController.RegisterRoutes(sms.app)
+}
 
-		sess, err := sms.store.Get(c)
+func (sms *ShareMicroservice) Run() {
+	lis, err := net.Listen("tcp", sms.config.GrpcAddress)
 
-		if err != nil {
-			sms.logger.Panic("Cannot get session", zap.Error(err))
-		}
+	if err != nil {
+		sms.Cleanup()
+		sms.logger.Panic("Cannot create listener for GRPC server", zap.Error(err))
+	}
 
-		sess.Set("userData", userData)
+	grpcServer := rpc.NewGrpcServer(sms.config.IdentitySecret)
+	proto.RegisterShareServer(grpcServer, sms.grpcServer)
 
-		if err := sess.Save(); err != nil {
-			sms.logger.Panic("Cannot save session", zap.Error(err))
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			sms.logger.Panic("Cannot serve GRPC server", zap.Error(err))
 		}
+	}()
 
-		return c.Next()
-	})
-
-	sms.fileController.RegisterRoutes(sms.app)
-}
-
-func (sms *ShareMicroservice) Run() {
-	sms.app.Listen(":8082")
+	sms.subscriber.Start()
+	sms.config.Discovery.Register(sms.logger, discovery.Instance{Service: "share", Id: uuid.NewString(),
+		Endpoints: map[string]string{"http": sms.config.HttpAddress, "grpc": sms.config.GrpcAddress}})
+	sms.app.Listen(sms.config.HttpAddress)
 }
 
 func (sms *ShareMicroservice) Cleanup() {
+	sms.config.Discovery.Close()
 	sms.logger.Sync()
-	sms.rpcServer.Close()
 	sms.rpcClient.Close()
+	sms.broker.Close()
 }
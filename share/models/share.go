@@ -7,4 +7,5 @@ type Share struct {
 	SharedForId    uint      `json:"sharedForId" gorm:"primaryKey;autoIncrement:false"`
 	SharedById     uint      `json:"sharedById"`
 	ExpirationTime time.Time `json:"expirationTime"`
+	WrappedKey     string    `json:"wrappedKey"`
 }
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"context"
+	"dfs/common/events"
+	"dfs/share/database"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// EventSubscriber removes shares whose file or user no longer exists.
+type EventSubscriber struct {
+	logger    *zap.Logger
+	bus       *events.Bus
+	shareRepo *database.ShareRepository
+}
+
+func NewEventSubscriber(logger *zap.Logger, bus *events.Bus, shareRepo *database.ShareRepository) *EventSubscriber {
+	return &EventSubscriber{logger: logger, bus: bus, shareRepo: shareRepo}
+}
+
+func (es *EventSubscriber) Start() {
+	go es.bus.Subscribe("events_share", map[string]events.Handler{
+		events.FileDeleted: es.fileDeleted,
+		events.UserDeleted: es.userDeleted,
+	})
+}
+
+func (es *EventSubscriber) fileDeleted(_ context.Context, event events.Event) error {
+	var fileDeleted events.FileDeletedV1
+
+	if err := event.Decode(1, &fileDeleted); err != nil {
+		return err
+	}
+
+	if es.shareRepo.DeleteFileShares(fileDeleted.FileId) == false {
+		return errors.New("cannot delete file shares")
+	}
+
+	return nil
+}
+
+func (es *EventSubscriber) userDeleted(_ context.Context, event events.Event) error {
+	var userDeleted events.UserDeletedV1
+
+	if err := event.Decode(1, &userDeleted); err != nil {
+		return err
+	}
+
+	if es.shareRepo.DeleteUserShares(userDeleted.UserId) == false {
+		return errors.New("cannot delete user shares")
+	}
+
+	return nil
+}
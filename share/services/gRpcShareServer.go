@@ -0,0 +1,53 @@
+package services
+
+import (
+	"context"
+	"dfs/proto"
+	"dfs/share/database"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type GRpcShareServer struct {
+	proto.UnimplementedShareServer
+	logger    *zap.Logger
+	shareRepo *database.ShareRepository
+}
+
+func NewGrpcShareServer(logger *zap.Logger, shareRepo *database.ShareRepository) *GRpcShareServer {
+	return &GRpcShareServer{logger: logger, shareRepo: shareRepo}
+}
+
+// DeleteUserShares removes all shares created by or for a deleted user.
+func (gss *GRpcShareServer) DeleteUserShares(_ context.Context, req *proto.UserSharesRequest) (*proto.ShareResult,
+	error) {
+	isDeleted := gss.shareRepo.DeleteUserShares(uint(req.UserId))
+
+	gss.logger.Debug("[-->]", zap.Uint64("UserId", req.UserId), zap.Bool("AreSharesDeleted", isDeleted))
+
+	return &proto.ShareResult{Success: isDeleted}, nil
+}
+
+// GetUserShares returns all shares created by or for a user, which are included in the user's data export.
+func (gss *GRpcShareServer) GetUserShares(_ context.Context, req *proto.UserSharesRequest) (*proto.UserShares, error) {
+	shares := gss.shareRepo.GetUserShares(uint(req.UserId))
+
+	if shares == nil {
+		return nil, status.Error(codes.Internal, "cannot get user shares")
+	}
+
+	userShares := &proto.UserShares{Shares: []*proto.UserShare{}}
+
+	for _, share := range shares {
+		userShares.Shares = append(userShares.Shares, &proto.UserShare{FileId: uint64(share.FileId),
+			SharedForId: uint64(share.SharedForId), SharedById: uint64(share.SharedById),
+			ExpirationTime: timestamppb.New(share.ExpirationTime)})
+	}
+
+	gss.logger.Debug("[-->]", zap.Uint64("UserId", req.UserId), zap.Int("Shares", len(userShares.Shares)))
+
+	return userShares, nil
+}
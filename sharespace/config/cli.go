@@ -0,0 +1,5 @@
+package config
+
+type CliArgs struct {
+	RewrapKeys bool `help:"Re-wrap all stored encryption keys with the current master key and exit"`
+}
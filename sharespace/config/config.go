@@ -1,17 +1,35 @@
 package config
 
 import (
+	"dfs/common/discovery"
+	"dfs/common/masterkey"
+	"github.com/alecthomas/kong"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
+	"time"
 )
 
 type Config struct {
 	DbConnectionString string
+	AmqpUrl            string
+	HttpAddress        string
+	Discovery          *discovery.Discovery
+	AmqpConnectTimeout time.Duration
+	GrpcAddress        string
+	AuthGrpcAddress    string
+	IdentitySecret     string
 	FileStoragePath    string
+	MasterKey          string
+	MasterKeyId        string
+	MasterKeystorePath string
+	RewrapKeys         bool
 }
 
 func Create() *Config {
+	var cliArgs CliArgs
+	kong.Parse(&cliArgs)
+
 	err := godotenv.Load(".env")
 
 	if err != nil {
@@ -20,8 +38,65 @@ func Create() *Config {
 
 	cfg := &Config{
 		DbConnectionString: os.Getenv("DB_CONNECTION_STRING"),
+		AmqpUrl:            os.Getenv("AMQP_URL"),
+		GrpcAddress:        os.Getenv("GRPC_ADDRESS"),
+		AuthGrpcAddress:    os.Getenv("AUTH_GRPC_ADDRESS"),
+		IdentitySecret:     os.Getenv("IDENTITY_SECRET"),
 		FileStoragePath:    os.Getenv("STORAGE_PATH"),
+		MasterKey:          os.Getenv("MASTER_KEY"),
+		MasterKeyId:        os.Getenv("MASTER_KEY_ID"),
+		MasterKeystorePath: os.Getenv("MASTER_KEYSTORE_PATH"),
+		RewrapKeys:         cliArgs.RewrapKeys,
+	}
+
+	if cfg.MasterKeyId == "" {
+		cfg.MasterKeyId = "default"
+	}
+
+	if cfg.Discovery, err = discovery.NewFromEnv(); err != nil {
+		log.Fatalf("Cannot initialize service discovery. Reason: %s", err)
+	}
+
+	if cfg.AmqpUrl == "" {
+		cfg.AmqpUrl = cfg.Discovery.Address("rabbitmq", "amqp")
+	}
+
+	cfg.HttpAddress = os.Getenv("HTTP_ADDRESS")
+
+	if cfg.HttpAddress == "" {
+		cfg.HttpAddress = ":8083"
+	}
+
+	if cfg.GrpcAddress == "" {
+		cfg.GrpcAddress = "localhost:9083"
+	}
+
+	if cfg.AuthGrpcAddress == "" {
+		cfg.AuthGrpcAddress = discovery.Target("auth")
 	}
 
+	cfg.AmqpConnectTimeout = parseDuration("AMQP_CONNECT_TIMEOUT", time.Minute)
+
 	return cfg
 }
+
+func parseDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return duration
+}
+
+// MasterKeys returns the master keys the data keys are wrapped with.
+func (cfg *Config) MasterKeys() masterkey.Config {
+	return masterkey.Config{KeystorePath: cfg.MasterKeystorePath, Key: cfg.MasterKey, KeyId: cfg.MasterKeyId}
+}
@@ -2,6 +2,9 @@ package controllers
 
 import (
 	"crypto/rand"
+	"dfs/common/audit"
+	"dfs/common/events"
+	"dfs/common/masterkey"
 	"dfs/sharespace/database"
 	"dfs/sharespace/dtos"
 	"dfs/sharespace/models"
@@ -23,12 +26,16 @@ type ShareSpaceController struct {
 	rpcClient            *services.RpcClient
 	shareSpaceRepository *database.ShareSpaceRepository
 	store                *session.Store
+	keySrv               *masterkey.KeyService
+	events               *events.Bus
 }
 
 func NewShareSpaceController(logger *zap.Logger, rpcClient *services.RpcClient,
-	shareSpaceRepository *database.ShareSpaceRepository, store *session.Store) *ShareSpaceController {
+	shareSpaceRepository *database.ShareSpaceRepository, store *session.Store,
+	keySrv *masterkey.KeyService, bus *events.Bus) *ShareSpaceController {
 
-	return &ShareSpaceController{logger: logger, rpcClient: rpcClient, shareSpaceRepository: shareSpaceRepository, store: store}
+	return &ShareSpaceController{logger: logger, rpcClient: rpcClient, shareSpaceRepository: shareSpaceRepository,
+		store: store, keySrv: keySrv, events: bus}
 }
 
 func (ssc *ShareSpaceController) RegisterRoutes(app *fiber.App) {
@@ -61,10 +68,19 @@ func (ssc *ShareSpaceController) createShareSpace(ctx *fiber.Ctx) error {
 
 	createdBy := sess.Get("userData").(dtos.UserDto)
 
+	var ssId uint
+
+	// The id is known only once the ShareSpace is stored
+	defer func() {
+		audit.Record(ctx, ssc.events, ssc.logger, events.AuditRecordedV1{ActorId: createdBy.Id,
+			Action: audit.ShareSpaceCreate, Resource: fmt.Sprintf("sharespace:%d", ssId), ShareSpaceId: ssId,
+			Details: createSsDto.ShareSpaceName})
+	}()
+
 	homeDirPath := fmt.Sprintf("%s_%s", createdBy.Email, createSsDto.ShareSpaceName)
 
-	if ssc.rpcClient.CreateHomeDirectory(homeDirPath) == false {
-		ssc.logger.Warn("Cannot create home directory for ShareSpace")
+	if isCreated, err := ssc.rpcClient.CreateHomeDirectory(ctx.UserContext(), homeDirPath); isCreated == false {
+		ssc.logger.Warn("Cannot create home directory for ShareSpace", zap.Error(err))
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot create ShareSpace"})
 	}
 
@@ -77,9 +93,14 @@ func (ssc *ShareSpaceController) createShareSpace(ctx *fiber.Ctx) error {
 		})
 	}
 
-	encodedKey := base64.StdEncoding.EncodeToString(key)
+	wrappedKey, err := ssc.keySrv.WrapKey(base64.StdEncoding.EncodeToString(key))
+
+	if err != nil {
+		ssc.logger.Error("Cannot wrap encryption key", zap.Error(err))
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot create ShareSpace"})
+	}
 
-	ssId := ssc.shareSpaceRepository.CreateShareSpace(createSsDto.ShareSpaceName, createdBy.Id, homeDirPath, encodedKey)
+	ssId = ssc.shareSpaceRepository.CreateShareSpace(createSsDto.ShareSpaceName, createdBy.Id, homeDirPath, wrappedKey)
 
 	if ssId == 0 {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot create ShareSpace"})
@@ -109,6 +130,10 @@ func (ssc *ShareSpaceController) deleteShareSpace(ctx *fiber.Ctx) error {
 
 	deleteBy := sess.Get("userData").(dtos.UserDto)
 
+	defer audit.Record(ctx, ssc.events, ssc.logger, events.AuditRecordedV1{ActorId: deleteBy.Id,
+		Action: audit.ShareSpaceDelete, Resource: fmt.Sprintf("sharespace:%d", shareSpaceId),
+		ShareSpaceId: uint(shareSpaceId)})
+
 	shareSpace := ssc.shareSpaceRepository.GetOwnedShareSpaceById(uint(shareSpaceId), deleteBy.Id)
 
 	if shareSpace == nil {
@@ -119,7 +144,10 @@ func (ssc *ShareSpaceController) deleteShareSpace(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"message": "cannot delete ShareSpace"})
 	}
 
-	ssc.rpcClient.DeleteFileFromDisk(dtos.DeleteFileDto{FilePath: shareSpace.HomeDirectory})
+	if isDeleted, err := ssc.rpcClient.DeleteFileFromDisk(ctx.UserContext(),
+		dtos.DeleteFileDto{FilePath: shareSpace.HomeDirectory}); isDeleted == false {
+		ssc.logger.Warn("Cannot delete ShareSpace directory", zap.Uint("ShareSpaceId", shareSpace.Id), zap.Error(err))
+	}
 
 	return ctx.SendStatus(fiber.StatusOK)
 }
@@ -147,6 +175,19 @@ func (ssc *ShareSpaceController) addToShareSpace(ctx *fiber.Ctx) error {
 		return ctx.SendStatus(fiber.StatusBadRequest)
 	}
 
+	sess, err := ssc.store.Get(ctx)
+	defer sess.Destroy()
+
+	if err != nil {
+		ssc.logger.Panic("Cannot get session", zap.Error(err))
+	}
+
+	addedBy := sess.Get("userData").(dtos.UserDto)
+
+	defer audit.Record(ctx, ssc.events, ssc.logger, events.AuditRecordedV1{ActorId: addedBy.Id,
+		Action: audit.ShareSpaceMemberAdd, Resource: fmt.Sprintf("user:%d", newMember.UserId),
+		ShareSpaceId: newMember.ShareSpaceId})
+
 	if ssc.shareSpaceRepository.AddUserToShareSpace(newMember.UserId, newMember.ShareSpaceId, models.Member) {
 		return ctx.SendStatus(fiber.StatusOK)
 	} else {
@@ -171,8 +212,15 @@ func (ssc *ShareSpaceController) deleteFromShareSpace(ctx *fiber.Ctx) error {
 
 	deleteBy := sess.Get("userData").(dtos.UserDto)
 
+	defer audit.Record(ctx, ssc.events, ssc.logger, events.AuditRecordedV1{ActorId: deleteBy.Id,
+		Action: audit.ShareSpaceMemberRemove, Resource: fmt.Sprintf("user:%d", memberDto.UserId),
+		ShareSpaceId: memberDto.ShareSpaceId})
+
 	if ssc.shareSpaceRepository.CanUserDeleteMembers(deleteBy.Id, memberDto.ShareSpaceId) {
 		if ssc.shareSpaceRepository.DeleteUserFromShareSpace(memberDto.UserId, memberDto.ShareSpaceId) {
+			ssc.publishEvent(ctx, events.ShareSpaceMemberRemoved, events.ShareSpaceMemberRemovedV1{
+				ShareSpaceId: memberDto.ShareSpaceId, UserId: memberDto.UserId})
+
 			return ctx.SendStatus(fiber.StatusOK)
 		}
 	} else {
@@ -217,6 +265,12 @@ func (ssc *ShareSpaceController) uploadFileToShareSpace(ctx *fiber.Ctx) error {
 		ssc.logger.Panic("Cannot get session", zap.Error(err))
 	}
 
+	fileSendBy := sess.Get("userData").(dtos.UserDto)
+
+	defer audit.Record(ctx, ssc.events, ssc.logger, events.AuditRecordedV1{ActorId: fileSendBy.Id,
+		Action: audit.ShareSpaceFileUpload, Resource: fmt.Sprintf("sharespace:%d", shareSpaceId),
+		ShareSpaceId: uint(shareSpaceId), Details: fileHeader.Filename})
+
 	ssc.logger.Debug("Uploading file to the ShareSpace", zap.Uint64("ShareSpaceId", shareSpaceId),
 		zap.String("FileName", fileHeader.Filename))
 
@@ -247,7 +301,7 @@ func (ssc *ShareSpaceController) uploadFileToShareSpace(ctx *fiber.Ctx) error {
 
 	ssc.logger.Debug("File will be saved into", zap.String("ReadPath", savePath))
 
-	encryptionKey, err := base64.StdEncoding.DecodeString(shareSpace.CryptKey)
+	encryptionKey, err := ssc.decodeShareSpaceKey(shareSpace)
 
 	if err != nil {
 		ssc.logger.Error("Cannot decode encryption key", zap.Error(err))
@@ -256,17 +310,21 @@ func (ssc *ShareSpaceController) uploadFileToShareSpace(ctx *fiber.Ctx) error {
 
 	saveFileDto := dtos.SaveFileDto{SavePath: savePath, Content: fileContent, EncryptionKey: encryptionKey}
 
-	if ssc.rpcClient.SaveFileOnDisk(saveFileDto) == false {
-		ssc.logger.Error("Cannot save file on the disk")
+	if isSaved, err := ssc.rpcClient.SaveFileOnDisk(ctx.UserContext(), saveFileDto); isSaved == false {
+		ssc.logger.Error("Cannot save file on the disk", zap.Error(err))
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot upload file to the server"})
 	}
 
-	fileSendBy := sess.Get("userData").(dtos.UserDto)
+	fileId := ssc.shareSpaceRepository.AddFileToShareSpace(uint(shareSpaceId), fileHeader.Filename, savePath,
+		fileSendBy.Id)
 
-	if ssc.shareSpaceRepository.AddFileToShareSpace(uint(shareSpaceId), fileHeader.Filename, savePath, fileSendBy.Id) == 0 {
+	if fileId == 0 {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot upload file to the server"})
 	}
 
+	ssc.publishEvent(ctx, events.ShareSpaceFileCreated, events.ShareSpaceFileCreatedV1{
+		ShareSpaceId: uint(shareSpaceId), FileId: fileId, Name: fileHeader.Filename, OwnerId: fileSendBy.Id})
+
 	return ctx.SendStatus(fiber.StatusCreated)
 }
 
@@ -289,6 +347,9 @@ func (ssc *ShareSpaceController) deleteFileFromShareSpace(ctx *fiber.Ctx) error
 
 	fileDeletedBy := sess.Get("userData").(dtos.UserDto)
 
+	defer audit.Record(ctx, ssc.events, ssc.logger, events.AuditRecordedV1{ActorId: fileDeletedBy.Id,
+		Action: audit.ShareSpaceFileDelete, Resource: "file:" + uniqueFileName, ShareSpaceId: uint(shareSpaceId)})
+
 	fileToDelete := ssc.shareSpaceRepository.GetFileFromShareSpace(uint(shareSpaceId), uniqueFileName)
 
 	if fileToDelete == nil {
@@ -313,8 +374,8 @@ func (ssc *ShareSpaceController) deleteFileFromShareSpace(ctx *fiber.Ctx) error
 
 	deleteFileDto := dtos.DeleteFileDto{FilePath: fileToDelete.Path}
 
-	if ssc.rpcClient.DeleteFileFromDisk(deleteFileDto) == false {
-		ssc.logger.Error("Cannot delete file from disk")
+	if isDeleted, err := ssc.rpcClient.DeleteFileFromDisk(ctx.UserContext(), deleteFileDto); isDeleted == false {
+		ssc.logger.Error("Cannot delete file from disk", zap.Error(err))
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot delete file"})
 	}
 
@@ -322,6 +383,10 @@ func (ssc *ShareSpaceController) deleteFileFromShareSpace(ctx *fiber.Ctx) error
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot delete unowned file"})
 	}
 
+	ssc.publishEvent(ctx, events.ShareSpaceFileDeleted, events.ShareSpaceFileDeletedV1{
+		ShareSpaceId: uint(shareSpaceId), FileId: fileToDelete.Id, UniqueName: fileToDelete.UniqueName,
+		Name: fileToDelete.Name, DeletedById: fileDeletedBy.Id})
+
 	return ctx.SendStatus(fiber.StatusOK)
 }
 
@@ -355,6 +420,10 @@ func (ssc *ShareSpaceController) downloadFileFromShareSpace(ctx *fiber.Ctx) erro
 
 	fileDownloadedBy := sess.Get("userData").(dtos.UserDto)
 
+	defer audit.Record(ctx, ssc.events, ssc.logger, events.AuditRecordedV1{ActorId: fileDownloadedBy.Id,
+		Action: audit.ShareSpaceFileDownload, Resource: "file:" + ctx.Params("uniqueFileName"),
+		ShareSpaceId: uint(shareSpaceId)})
+
 	if ssc.shareSpaceRepository.IsUserMemberOfShareSpace(fileDownloadedBy.Id, uint(shareSpaceId)) == false {
 		ssc.logger.Error("User isn't member of ShareSpace",
 			zap.Uint64("ShareSpaceId", shareSpaceId), zap.Uint("UserId", fileDownloadedBy.Id))
@@ -375,7 +444,7 @@ func (ssc *ShareSpaceController) downloadFileFromShareSpace(ctx *fiber.Ctx) erro
 		return ctx.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "file doesn't exist in the ShareSpace"})
 	}
 
-	decryptionKey, err := base64.StdEncoding.DecodeString(shareSpace.CryptKey)
+	decryptionKey, err := ssc.decodeShareSpaceKey(shareSpace)
 
 	if err != nil {
 		ssc.logger.Error("Cannot decode encryption key", zap.Error(err))
@@ -384,7 +453,29 @@ func (ssc *ShareSpaceController) downloadFileFromShareSpace(ctx *fiber.Ctx) erro
 
 	readFileDto := dtos.ReadFileDto{ReadPath: shareSpaceFile.Path, DecryptionKey: decryptionKey}
 
-	fileContent := ssc.rpcClient.ReadFileFromDisk(readFileDto)
+	fileContent, err := ssc.rpcClient.ReadFileFromDisk(ctx.UserContext(), readFileDto)
+
+	if err != nil {
+		ssc.logger.Error("Cannot read file from disk", zap.Error(err))
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot download file from the server"})
+	}
 
 	return ctx.Status(fiber.StatusOK).Send(fileContent)
 }
+
+// publishEvent only logs failures, because the change it announces is already stored.
+func (ssc *ShareSpaceController) publishEvent(ctx *fiber.Ctx, eventType string, data interface{}) {
+	if err := ssc.events.Publish(ctx.UserContext(), eventType, 1, data); err != nil {
+		ssc.logger.Error("Cannot publish event", zap.String("Event", eventType), zap.Error(err))
+	}
+}
+
+func (ssc *ShareSpaceController) decodeShareSpaceKey(shareSpace *models.ShareSpace) ([]byte, error) {
+	key, err := ssc.keySrv.UnwrapKey(shareSpace.CryptKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return base64.StdEncoding.DecodeString(key)
+}
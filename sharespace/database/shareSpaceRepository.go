@@ -1,6 +1,7 @@
 package database
 
 import (
+	"context"
 	"dfs/sharespace/dtos"
 	"dfs/sharespace/models"
 	"dfs/sharespace/services"
@@ -132,7 +133,13 @@ func (ssr *ShareSpaceRepository) GetShareSpaceMembers(ssId uint) []dtos.UserDto
 	ssr.database.Where("share_space_id = ?", ssId).Find(&ssMembers)
 
 	for _, member := range ssMembers {
-		user := ssr.rpcClient.GetUserDataById(member.UserId)
+		user, err := ssr.rpcClient.GetUserDataById(context.Background(), member.UserId)
+
+		if err != nil {
+			ssr.logger.Warn("Cannot get ShareSpace member data", zap.Uint("UserId", member.UserId), zap.Error(err))
+			continue
+		}
+
 		users = append(users, *user)
 	}
 
@@ -233,3 +240,42 @@ func (ssr *ShareSpaceRepository) DeleteEntireShareSpace(ssId uint) bool {
 
 	return true
 }
+
+func (ssr *ShareSpaceRepository) RewrapCryptKeys(rewrap func(key string) (string, error)) bool {
+	var shareSpaces []models.ShareSpace
+
+	if err := ssr.database.Find(&shareSpaces).Error; err != nil {
+		ssr.logger.Error("Cannot get ShareSpaces", zap.Error(err))
+		return false
+	}
+
+	err := ssr.database.Transaction(func(tx *gorm.DB) error {
+		for _, shareSpace := range shareSpaces {
+			rewrapped, err := rewrap(shareSpace.CryptKey)
+
+			if err != nil {
+				ssr.logger.Error("Cannot rewrap ShareSpace key", zap.Uint("ShareSpaceId", shareSpace.Id), zap.Error(err))
+				return err
+			}
+
+			if rewrapped == shareSpace.CryptKey {
+				continue
+			}
+
+			if err := tx.Model(&shareSpace).Update("crypt_key", rewrapped).Error; err != nil {
+				ssr.logger.Error("Cannot update ShareSpace key", zap.Uint("ShareSpaceId", shareSpace.Id), zap.Error(err))
+				return err
+			}
+		}
+
+		return nil
+	})
+
+	if err != nil {
+		return false
+	}
+
+	ssr.logger.Info("Rewrapped ShareSpaces keys", zap.Int("ShareSpaces", len(shareSpaces)))
+
+	return true
+}
@@ -0,0 +1,7 @@
+package dtos
+
+type MembershipDto struct {
+	ShareSpaceId uint   `json:"shareSpaceId"`
+	Name         string `json:"name"`
+	Role         string `json:"role"`
+}
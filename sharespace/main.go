@@ -1,9 +1,19 @@
 package main
 
-import "dfs/sharespace/microservice"
+import (
+	"dfs/sharespace/config"
+	"dfs/sharespace/microservice"
+)
 
 func main() {
-	shareMicroservice := microservice.NewShareSpaceMicroservice()
+	cfg := config.Create()
+
+	if cfg.RewrapKeys {
+		microservice.RewrapKeys(cfg)
+		return
+	}
+
+	shareMicroservice := microservice.NewShareSpaceMicroservice(cfg)
 	shareMicroservice.Setup()
 	shareMicroservice.Run()
 	defer shareMicroservice.Cleanup()
@@ -1,16 +1,25 @@
 package microservice
 
 import (
+	"dfs/common/discovery"
+	"dfs/common/events"
+	"dfs/common/jwks"
+	"dfs/common/masterkey"
+	"dfs/common/middleware"
+	"dfs/common/rpc"
+	"dfs/proto"
 	"dfs/sharespace/config"
 	"dfs/sharespace/controllers"
 	"dfs/sharespace/database"
 	"dfs/sharespace/dtos"
 	"dfs/sharespace/services"
 	"log"
+	"net"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"gorm.io/gorm"
 )
@@ -21,79 +30,138 @@ type ShareSpaceMicroservice struct {
 	app                  *fiber.App
 	store                *session.Store
 	database             *gorm.DB
+	broker               *rpc.Connection
 	ssRepository         *database.ShareSpaceRepository
 	rpcClient            *services.RpcClient
-	rpcServer            *services.RpcServer
+	grpcServer           *services.GRpcShareSpaceServer
+	keys                 *masterkey.KeyService
 	shareSpaceController *controllers.ShareSpaceController
+	subscriber           *services.EventSubscriber
 }
 
-func NewShareSpaceMicroservice() *ShareSpaceMicroservice {
-	cfg := config.Create()
-	loggerConfig := zap.NewDevelopmentConfig()
-	loggerConfig.EncoderConfig.FunctionKey = "func"
-	logger, err := loggerConfig.Build()
+func NewShareSpaceMicroservice(cfg *config.Config) *ShareSpaceMicroservice {
+	logger := createLogger()
+
+	databaseService, err := database.Connect(cfg.DbConnectionString)
 
 	if err != nil {
-		log.Fatalf("Cannot initialize zap logger. Reason: %s", err)
+		log.Fatalf("Cannot initialize database service. Reason: %s", err)
 	}
 
-	databaseService, err := database.Connect(cfg.DbConnectionString)
+	keys, err := masterkey.NewKeyService(cfg.MasterKeys())
 
 	if err != nil {
-		log.Fatalf("Cannot initialize database service. Reason: %s", err)
+		log.Fatalf("Cannot initialize key service. Reason: %s", err)
+	}
+
+	broker, err := rpc.Dial(cfg.AmqpUrl, logger, cfg.AmqpConnectTimeout)
+
+	if err != nil {
+		log.Fatalf("Cannot connect to RabbitMQ. Reason: %s", err)
+	}
+
+	rpcClient, err := services.NewRpcClient(logger, broker, cfg)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize RPC client. Reason: %s", err)
+	}
+
+	bus, err := events.NewBus(broker, logger, "sharespace")
+
+	if err != nil {
+		log.Fatalf("Cannot initialize event bus. Reason: %s", err)
 	}
 
 	app := fiber.New()
-	rpcClient := services.NewRpcClient(logger)
-	rpcServer := services.NewRpcServer(logger)
+	grpcServer := services.NewGrpcShareSpaceServer(logger, databaseService, rpcClient, bus)
 	ssRepository := database.NewShareSpaceRepository(logger, databaseService, rpcClient)
 	store := session.New()
-	shareSpaceController := controllers.NewShareSpaceController(logger, rpcClient, ssRepository, store)
+	shareSpaceController := controllers.NewShareSpaceController(logger, rpcClient, ssRepository, store, keys, bus)
+	subscriber := services.NewEventSubscriber(logger, bus, grpcServer)
 	store.RegisterType(dtos.UserDto{})
 
 	return &ShareSpaceMicroservice{config: cfg, logger: logger, app: app, store: store, database: databaseService,
-		ssRepository: ssRepository, rpcClient: rpcClient, rpcServer: rpcServer, shareSpaceController: shareSpaceController}
+		broker: broker, ssRepository: ssRepository, rpcClient: rpcClient, grpcServer: grpcServer, keys: keys,
+		shareSpaceController: shareSpaceController, subscriber: subscriber}
 }
 
-func (sms *ShareSpaceMicroservice) Setup() {
-	sms.app.Use(cors.New(cors.Config{
-		AllowCredentials: true,
-	}))
+func RewrapKeys(cfg *config.Config) {
+	logger := createLogger()
+	defer logger.Sync()
+
+	databaseService, err := database.Connect(cfg.DbConnectionString)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize database service. Reason: %s", err)
+	}
 
-	sms.app.Use(func(c *fiber.Ctx) error {
-		cookie := c.Cookies("jwt")
+	keys, err := masterkey.NewKeyService(cfg.MasterKeys())
 
-		userData := sms.rpcClient.GetUserDataByJwt(cookie)
+	if err != nil {
+		log.Fatalf("Cannot initialize key service. Reason: %s", err)
+	}
 
-		if userData == nil {
-			return c.SendStatus(fiber.StatusUnauthorized)
-		}
+	ssRepository := database.NewShareSpaceRepository(logger, databaseService, nil)
 
-		sess, err := sms.store.Get(c)
+	if ssRepository.RewrapCryptKeys(keys.RewrapKey) == false {
+		log.Fatal("Cannot rewrap ShareSpaces keys")
+	}
+}
 
-		if err != nil {
-			sms.logger.Panic("Cannot get session", zap.Error(err))
-		}
+func createLogger() *zap.Logger {
+	loggerConfig := zap.NewDevelopmentConfig()
+	loggerConfig.EncoderConfig.FunctionKey = "func"
+	logger, err := loggerConfig.Build()
 
-		sess.Set("userData", userData)
+	if err != nil {
+		log.Fatalf("Cannot initialize zap logger. Reason: %s", err)
+	}
 
-		if err := sess.Save(); err != nil {
-			sms.logger.Panic("Cannot save session", zap.Error(err))
-		}
+	return logger
+}
+
+func (sms *ShareSpaceMicroservice) Setup() {
+	sms.app.Use(cors.New(cors.Config{
+		AllowCredentials: true,
+	}))
+
+	sms.app.Get("/ready", middleware.Readiness(map[string]func() bool{"broker": sms.broker.Ready}))
 
-		return c.Next()
-	})
+	sms.app.Use(middleware.Identity(sms.config.IdentitySecret))
+	sms.app.Use(middleware.Authenticate(middleware.Authentication[*dtos.UserDto]{Store: sms.store,
+		Logger: sms.logger, Scope: "sharespace", Jwks: jwks.NewFromEnv(sms.config.Discovery),
+		ById: sms.rpcClient.GetUserDataById, ByJwt: sms.rpcClient.GetUserDataByJwt,
+		ByApiToken: sms.rpcClient.GetUserDataByApiToken}))
 
 	sms.shareSpaceController.RegisterRoutes(sms.app)
 }
 
 func (sms *ShareSpaceMicroservice) Run() {
-	// go sms.rpcServer.RegisterCreateHomeDirectory()
-	sms.app.Listen(":8083")
+	lis, err := net.Listen("tcp", sms.config.GrpcAddress)
+
+	if err != nil {
+		sms.Cleanup()
+		sms.logger.Panic("Cannot create listener for GRPC server", zap.Error(err))
+	}
+
+	grpcServer := rpc.NewGrpcServer(sms.config.IdentitySecret)
+	proto.RegisterShareSpaceServer(grpcServer, sms.grpcServer)
+
+	go func() {
+		if err := grpcServer.Serve(lis); err != nil {
+			sms.logger.Panic("Cannot serve GRPC server", zap.Error(err))
+		}
+	}()
+
+	sms.subscriber.Start()
+	sms.config.Discovery.Register(sms.logger, discovery.Instance{Service: "sharespace", Id: uuid.NewString(),
+		Endpoints: map[string]string{"http": sms.config.HttpAddress, "grpc": sms.config.GrpcAddress}})
+	sms.app.Listen(sms.config.HttpAddress)
 }
 
 func (sms *ShareSpaceMicroservice) Cleanup() {
+	sms.config.Discovery.Close()
 	sms.logger.Sync()
-	sms.rpcServer.Close()
 	sms.rpcClient.Close()
+	sms.broker.Close()
 }
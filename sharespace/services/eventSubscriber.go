@@ -0,0 +1,40 @@
+package services
+
+import (
+	"context"
+	"dfs/common/events"
+	"errors"
+
+	"go.uber.org/zap"
+)
+
+// EventSubscriber removes deleted users from their ShareSpaces the same way the RemoveUser gRPC call does.
+type EventSubscriber struct {
+	logger      *zap.Logger
+	bus         *events.Bus
+	memberships *GRpcShareSpaceServer
+}
+
+func NewEventSubscriber(logger *zap.Logger, bus *events.Bus, memberships *GRpcShareSpaceServer) *EventSubscriber {
+	return &EventSubscriber{logger: logger, bus: bus, memberships: memberships}
+}
+
+func (es *EventSubscriber) Start() {
+	go es.bus.Subscribe("events_sharespace", map[string]events.Handler{
+		events.UserDeleted: es.userDeleted,
+	})
+}
+
+func (es *EventSubscriber) userDeleted(_ context.Context, event events.Event) error {
+	var userDeleted events.UserDeletedV1
+
+	if err := event.Decode(1, &userDeleted); err != nil {
+		return err
+	}
+
+	if es.memberships.removeUser(userDeleted.UserId) == false {
+		return errors.New("cannot remove user from ShareSpaces")
+	}
+
+	return nil
+}
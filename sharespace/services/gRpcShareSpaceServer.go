@@ -0,0 +1,139 @@
+package services
+
+import (
+	"context"
+	"dfs/common/events"
+	"dfs/proto"
+	"dfs/sharespace/models"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+type GRpcShareSpaceServer struct {
+	proto.UnimplementedShareSpaceServer
+	logger    *zap.Logger
+	db        *gorm.DB
+	rpcClient *RpcClient
+	events    *events.Bus
+}
+
+func NewGrpcShareSpaceServer(logger *zap.Logger, db *gorm.DB, rpcClient *RpcClient,
+	bus *events.Bus) *GRpcShareSpaceServer {
+	return &GRpcShareSpaceServer{logger: logger, db: db, rpcClient: rpcClient, events: bus}
+}
+
+// RemoveUser removes a deleted user from all ShareSpaces. ShareSpaces owned by the user are deleted with their files,
+// because nobody else can manage them.
+func (gss *GRpcShareSpaceServer) RemoveUser(_ context.Context, req *proto.MembershipsRequest) (*proto.ShareSpaceResult,
+	error) {
+	isRemoved := gss.removeUser(uint(req.UserId))
+
+	gss.logger.Debug("[-->]", zap.Uint64("UserId", req.UserId), zap.Bool("IsUserRemoved", isRemoved))
+
+	return &proto.ShareSpaceResult{Success: isRemoved}, nil
+}
+
+// GetUserMemberships returns the ShareSpaces the user belongs to, which are included in the user's data export.
+func (gss *GRpcShareSpaceServer) GetUserMemberships(_ context.Context,
+	req *proto.MembershipsRequest) (*proto.UserMemberships, error) {
+	var members []models.ShareSpaceMember
+
+	if err := gss.db.Where("user_id = ?", req.UserId).Find(&members).Error; err != nil {
+		gss.logger.Error("Cannot get user memberships", zap.Uint64("UserId", req.UserId), zap.Error(err))
+		return nil, status.Error(codes.Internal, "cannot get user memberships")
+	}
+
+	memberships := &proto.UserMemberships{Memberships: []*proto.Membership{}}
+
+	for _, member := range members {
+		var shareSpace models.ShareSpace
+
+		if err := gss.db.Where("id = ?", member.ShareSpaceId).First(&shareSpace).Error; err != nil {
+			gss.logger.Error("Cannot get ShareSpace", zap.Uint("ShareSpaceId", member.ShareSpaceId), zap.Error(err))
+			return nil, status.Error(codes.Internal, "cannot get ShareSpace")
+		}
+
+		memberships.Memberships = append(memberships.Memberships, &proto.Membership{
+			ShareSpaceId: uint64(shareSpace.Id), Name: shareSpace.Name, Role: roleName(member.Role)})
+	}
+
+	gss.logger.Debug("[-->]", zap.Uint64("UserId", req.UserId), zap.Int("Memberships", len(members)))
+
+	return memberships, nil
+}
+
+func roleName(role models.Role) string {
+	switch role {
+	case models.Owner:
+		return "owner"
+	case models.Moderator:
+		return "moderator"
+	default:
+		return "member"
+	}
+}
+
+// removeUser can be called again for a user that was already removed, which then changes nothing.
+func (gss *GRpcShareSpaceServer) removeUser(userId uint) bool {
+	var ownedShareSpaces []models.ShareSpace
+	var memberships []models.ShareSpaceMember
+
+	if err := gss.db.Where("owner = ?", userId).Find(&ownedShareSpaces).Error; err != nil {
+		gss.logger.Error("Cannot get owned ShareSpaces", zap.Uint("UserId", userId), zap.Error(err))
+		return false
+	}
+
+	if err := gss.db.Where("user_id = ?", userId).Find(&memberships).Error; err != nil {
+		gss.logger.Error("Cannot get user memberships", zap.Uint("UserId", userId), zap.Error(err))
+		return false
+	}
+
+	// The directories go first, a failure leaves the rows in place so the account deletion finds them again on retry
+	for _, shareSpace := range ownedShareSpaces {
+		isDeleted, err := gss.rpcClient.DeleteHomeDirectory(context.Background(), shareSpace.HomeDirectory)
+
+		if isDeleted == false {
+			gss.logger.Error("Cannot delete ShareSpace directory", zap.Uint("ShareSpaceId", shareSpace.Id),
+				zap.Error(err))
+			return false
+		}
+	}
+
+	err := gss.db.Transaction(func(tx *gorm.DB) error {
+		for _, shareSpace := range ownedShareSpaces {
+			if err := tx.Where("share_space_id = ?", shareSpace.Id).Delete(&models.ShareSpaceMember{}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Where("share_space_id = ?", shareSpace.Id).Delete(&models.ShareSpaceFile{}).Error; err != nil {
+				return err
+			}
+
+			if err := tx.Delete(&models.ShareSpace{}, shareSpace.Id).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Where("user_id = ?", userId).Delete(&models.ShareSpaceMember{}).Error
+	})
+
+	if err != nil {
+		gss.logger.Error("Cannot remove user from ShareSpaces", zap.Uint("UserId", userId), zap.Error(err))
+		return false
+	}
+
+	for _, membership := range memberships {
+		err := gss.events.Publish(context.Background(), events.ShareSpaceMemberRemoved, 1,
+			events.ShareSpaceMemberRemovedV1{ShareSpaceId: membership.ShareSpaceId, UserId: userId})
+
+		if err != nil {
+			gss.logger.Error("Cannot publish event", zap.String("Event", events.ShareSpaceMemberRemoved),
+				zap.Error(err))
+		}
+	}
+
+	return true
+}
@@ -1,12 +1,14 @@
 package config
 
 import (
+	"dfs/common/discovery"
 	"fmt"
 	"github.com/alecthomas/kong"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -16,6 +18,11 @@ type Config struct {
 	FullAddress        string
 	DbConnectionString string
 	FileStoragePath    string
+	AmqpUrl            string
+	Discovery          *discovery.Discovery
+	AmqpConnectTimeout time.Duration
+	AuthGrpcAddress    string
+	IdentitySecret     string
 }
 
 func Create() *Config {
@@ -70,6 +77,40 @@ func Create() *Config {
 	cfg.FullAddress = fmt.Sprintf("%s:%d", cfg.IpAddress, cfg.Port)
 
 	cfg.DbConnectionString = os.Getenv("DB_CONNECTION_STRING")
+	cfg.AmqpUrl = os.Getenv("AMQP_URL")
+
+	if cfg.Discovery, err = discovery.NewFromEnv(); err != nil {
+		log.Fatalf("Cannot initialize service discovery. Reason: %s", err)
+	}
+
+	if cfg.AmqpUrl == "" {
+		cfg.AmqpUrl = cfg.Discovery.Address("rabbitmq", "amqp")
+	}
+
+	cfg.AuthGrpcAddress = os.Getenv("AUTH_GRPC_ADDRESS")
+	cfg.IdentitySecret = os.Getenv("IDENTITY_SECRET")
+
+	if cfg.AuthGrpcAddress == "" {
+		cfg.AuthGrpcAddress = discovery.Target("auth")
+	}
+
+	cfg.AmqpConnectTimeout = parseDuration("AMQP_CONNECT_TIMEOUT", time.Minute)
 
 	return cfg
 }
+
+func parseDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return duration
+}
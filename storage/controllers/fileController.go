@@ -1,6 +1,8 @@
 package controllers
 
 import (
+	"dfs/common/audit"
+	"dfs/common/events"
 	"dfs/storage/config"
 	"dfs/storage/database"
 	"dfs/storage/dtos"
@@ -21,11 +23,13 @@ type FileController struct {
 	store      *session.Store
 	storageRpo *database.StorageRepository
 	fileSrv    *services.FileService
+	events     *events.Bus
 }
 
 func NewFileController(cfg *config.Config, log *zap.Logger, rpc *services.RpcClient, store *session.Store,
-	storageRpo *database.StorageRepository, fileSrv *services.FileService) *FileController {
-	return &FileController{cfg: cfg, log: log, rpc: rpc, store: store, storageRpo: storageRpo, fileSrv: fileSrv}
+	storageRpo *database.StorageRepository, fileSrv *services.FileService, bus *events.Bus) *FileController {
+	return &FileController{cfg: cfg, log: log, rpc: rpc, store: store, storageRpo: storageRpo, fileSrv: fileSrv,
+		events: bus}
 }
 
 func (fc *FileController) RegisterRoutes(app *fiber.Router) {
@@ -54,6 +58,9 @@ func (fc *FileController) uploadFile(ctx *fiber.Ctx) error {
 	fileUniqueName := uuid.New().String()
 	fileSavePath := path.Join(userData.HomeDirectory, fileUniqueName)
 
+	defer audit.Record(ctx, fc.events, fc.log, events.AuditRecordedV1{ActorId: userData.Id, Action: audit.FileUpload,
+		Resource: "file:" + fileUniqueName, Details: fileHeader.Filename})
+
 	file, err := fileHeader.Open()
 
 	if err != nil {
@@ -70,6 +77,11 @@ func (fc *FileController) uploadFile(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot upload file to the server"})
 	}
 
+	if ctx.FormValue("clientEncrypted") == "true" {
+		return fc.uploadClientEncryptedFile(ctx, &userData, fileHeader.Filename, fileUniqueName, fileSavePath,
+			fileContent)
+	}
+
 	encryptionKey, err := base64.StdEncoding.DecodeString(userData.CryptKey)
 
 	if err != nil {
@@ -86,7 +98,36 @@ func (fc *FileController) uploadFile(ctx *fiber.Ctx) error {
 		return ctx.SendStatus(fiber.StatusCreated)
 	}
 
-	if fc.storageRpo.CreateFile(fileUniqueName, fileHeader.Filename, userData.Id) != 0 {
+	if fileId := fc.storageRpo.CreateFile(fileUniqueName, fileHeader.Filename, userData.Id); fileId != 0 {
+		fc.publishEvent(ctx, events.FileCreated, events.FileCreatedV1{FileId: fileId, UniqueName: fileUniqueName,
+			Name: fileHeader.Filename, OwnerId: userData.Id})
+		return ctx.SendStatus(fiber.StatusCreated)
+	} else {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot upload file to the server"})
+	}
+}
+
+func (fc *FileController) uploadClientEncryptedFile(ctx *fiber.Ctx, userData *dtos.User, fileName string,
+	fileUniqueName string, fileSavePath string, fileContent []byte) error {
+	keyMetadata := ctx.FormValue("keyMetadata")
+
+	if keyMetadata == "" {
+		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "client encrypted file requires key metadata"})
+	}
+
+	if fc.fileSrv.SaveClientEncryptedFile(fileSavePath, fileContent) == false {
+		fc.log.Error("Cannot save client encrypted file on the disk")
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot upload file to the server"})
+	}
+
+	if fc.storageRpo.CheckIfOwnedFileExistByName(fileName, userData.Id) {
+		return ctx.SendStatus(fiber.StatusCreated)
+	}
+
+	if fileId := fc.storageRpo.CreateClientEncryptedFile(fileUniqueName, fileName, userData.Id,
+		keyMetadata); fileId != 0 {
+		fc.publishEvent(ctx, events.FileCreated, events.FileCreatedV1{FileId: fileId, UniqueName: fileUniqueName,
+			Name: fileName, OwnerId: userData.Id})
 		return ctx.SendStatus(fiber.StatusCreated)
 	} else {
 		return ctx.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "cannot upload file to the server"})
@@ -104,6 +145,10 @@ func (fc *FileController) downloadFile(ctx *fiber.Ctx) error {
 	}
 
 	userData := sess.Get("userData").(dtos.User)
+
+	defer audit.Record(ctx, fc.events, fc.log, events.AuditRecordedV1{ActorId: userData.Id, Action: audit.FileDownload,
+		Resource: "file:" + fileUniqueName})
+
 	file := fc.storageRpo.GetOwnedFileByUniqueName(fileUniqueName, userData.Id)
 
 	if file == nil {
@@ -112,6 +157,19 @@ func (fc *FileController) downloadFile(ctx *fiber.Ctx) error {
 
 	readFilePath := path.Join(userData.HomeDirectory, file.UniqueName)
 
+	if file.ClientEncrypted {
+		fileContent := fc.fileSrv.ReadClientEncryptedFile(readFilePath)
+
+		if fileContent == nil {
+			return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot download file from the server"})
+		}
+
+		ctx.Set("X-Client-Encrypted", "true")
+		ctx.Set("X-Key-Metadata", base64.StdEncoding.EncodeToString([]byte(file.KeyMetadata)))
+
+		return ctx.Send(fileContent)
+	}
+
 	decryptionKey, err := base64.StdEncoding.DecodeString(userData.CryptKey)
 
 	if err != nil {
@@ -119,7 +177,14 @@ func (fc *FileController) downloadFile(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot download file from the server"})
 	}
 
-	fileContent := fc.fileSrv.DecryptAndReadFileContent(readFilePath, decryptionKey)
+	previousDecryptionKey, err := base64.StdEncoding.DecodeString(userData.PreviousCryptKey)
+
+	if err != nil {
+		fc.log.Error("Cannot decode previous decryption key", zap.Error(err))
+		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot download file from the server"})
+	}
+
+	fileContent := fc.fileSrv.DecryptAndReadFileContent(readFilePath, decryptionKey, previousDecryptionKey)
 
 	return ctx.Send(fileContent)
 }
@@ -150,6 +215,10 @@ func (fc *FileController) deleteFile(ctx *fiber.Ctx) error {
 	}
 
 	userData := sess.Get("userData").(dtos.User)
+
+	defer audit.Record(ctx, fc.events, fc.log, events.AuditRecordedV1{ActorId: userData.Id, Action: audit.FileDelete,
+		Resource: "file:" + fileUniqueName})
+
 	file := fc.storageRpo.GetOwnedFileByUniqueName(fileUniqueName, userData.Id)
 
 	if file == nil {
@@ -168,5 +237,16 @@ func (fc *FileController) deleteFile(ctx *fiber.Ctx) error {
 		return ctx.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot delete file from the server"})
 	}
 
+	// Shares of the file are removed by the share service
+	fc.publishEvent(ctx, events.FileDeleted, events.FileDeletedV1{FileId: file.Id, UniqueName: file.UniqueName,
+		OwnerId: file.OwnerId})
+
 	return ctx.SendStatus(fiber.StatusOK)
 }
+
+// publishEvent only logs failures, because the change it announces is already stored.
+func (fc *FileController) publishEvent(ctx *fiber.Ctx, eventType string, data interface{}) {
+	if err := fc.events.Publish(ctx.UserContext(), eventType, 1, data); err != nil {
+		fc.log.Error("Cannot publish event", zap.String("Event", eventType), zap.Error(err))
+	}
+}
@@ -32,10 +32,28 @@ func (sr *StorageRepository) CreateFile(uniqueFileName string, fileName string,
 	return fileEntry.Id
 }
 
-func (sr *StorageRepository) DeleteFile(uniqueFileName string) bool {
-	fileEntry := models.File{UniqueName: uniqueFileName}
+func (sr *StorageRepository) CreateClientEncryptedFile(uniqueFileName string, fileName string, ownerId uint,
+	keyMetadata string) uint {
+	fileEntry := &models.File{
+		UniqueName:      uniqueFileName,
+		Name:            fileName,
+		CreationDate:    time.Now(),
+		OwnerId:         ownerId,
+		ClientEncrypted: true,
+		KeyMetadata:     keyMetadata,
+	}
 
-	if err := sr.database.Delete(&fileEntry).Error; err != nil {
+	if err := sr.database.Create(&fileEntry).Error; err != nil {
+		sr.logger.Error("Cannot create new client encrypted file entry", zap.Error(err))
+		return 0
+	}
+
+	return fileEntry.Id
+}
+
+func (sr *StorageRepository) DeleteFile(uniqueFileName string) bool {
+	if err := sr.database.Where("unique_name = ?", uniqueFileName).Delete(&models.File{}).Error; err != nil {
+		sr.logger.Error("Cannot delete file entry", zap.String("UniqueFileName", uniqueFileName), zap.Error(err))
 		return false
 	}
 
@@ -100,6 +118,15 @@ func (sr *StorageRepository) CheckIfOwnedFileExistByName(fileName string, ownerI
 	return true
 }
 
+func (sr *StorageRepository) DeleteOwnedFiles(ownerId uint) bool {
+	if err := sr.database.Where("owner_id = ?", ownerId).Delete(&models.File{}).Error; err != nil {
+		sr.logger.Error("Cannot delete owned file entries", zap.Uint("OwnerId", ownerId), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
 func (sr *StorageRepository) GetOwnedFiles(ownerId uint) []models.File {
 	var files []models.File
 
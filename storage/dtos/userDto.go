@@ -3,11 +3,12 @@ package dtos
 import "dfs/storage/models"
 
 type User struct {
-	Id            uint          `json:"id"`
-	Name          string        `json:"name"`
-	Email         string        `json:"email" gorm:"unique"`
-	Verified      bool          `json:"verified"`
-	HomeDirectory string        `json:"directory"`
-	CryptKey      string        `json:"cryptKey"`
-	OwnedFiles    []models.File `json:"ownedFiles"`
+	Id               uint          `json:"id"`
+	Name             string        `json:"name"`
+	Email            string        `json:"email" gorm:"unique"`
+	Verified         bool          `json:"verified"`
+	HomeDirectory    string        `json:"directory"`
+	CryptKey         string        `json:"cryptKey"`
+	PreviousCryptKey string        `json:"previousCryptKey"`
+	OwnedFiles       []models.File `json:"ownedFiles"`
 }
@@ -1,6 +1,12 @@
 package microservice
 
 import (
+	"context"
+	"dfs/common/discovery"
+	"dfs/common/events"
+	"dfs/common/jwks"
+	"dfs/common/middleware"
+	"dfs/common/rpc"
 	"dfs/proto"
 	"dfs/storage/config"
 	"dfs/storage/controllers"
@@ -14,7 +20,6 @@ import (
 	"github.com/gofiber/fiber/v2/middleware/session"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
-	"google.golang.org/grpc"
 	"gorm.io/gorm"
 	"log"
 	"net"
@@ -29,11 +34,13 @@ type StorageMicroservice struct {
 	app            *fiber.App
 	store          *session.Store
 	database       *gorm.DB
+	broker         *rpc.Connection
 	rpcClient      *services.RpcClient
 	grpcServer     *services.GRpcStorageServer
 	fileService    *services.FileService
 	storageRpo     *database.StorageRepository
 	fileController *controllers.FileController
+	subscriber     *services.EventSubscriber
 }
 
 func NewStorageMicroservice() *StorageMicroservice {
@@ -53,19 +60,37 @@ func NewStorageMicroservice() *StorageMicroservice {
 		log.Fatalf("Cannot initialize database service. Reason: %s", err)
 	}
 
+	broker, err := rpc.Dial(cfg.AmqpUrl, logger, cfg.AmqpConnectTimeout)
+
+	if err != nil {
+		log.Fatalf("Cannot connect to RabbitMQ. Reason: %s", err)
+	}
+
+	rpcClient, err := services.NewRpcClient(logger, broker, cfg, uid)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize RPC client. Reason: %s", err)
+	}
+
+	bus, err := events.NewBus(broker, logger, "storage")
+
+	if err != nil {
+		log.Fatalf("Cannot initialize event bus. Reason: %s", err)
+	}
+
 	app := fiber.New()
 	fileService := services.NewFileService(cfg, logger)
-	rpcClient := services.NewRpcClient(logger, uid)
 	store := session.New()
 	storageRepository := database.NewStorageRepository(logger, databaseService)
 	grpcServer := services.NewGrpcStorageServer(logger, fileService, storageRepository)
-	fileController := controllers.NewFileController(cfg, logger, rpcClient, store, storageRepository, fileService)
+	fileController := controllers.NewFileController(cfg, logger, rpcClient, store, storageRepository, fileService, bus)
+	subscriber := services.NewEventSubscriber(logger, bus, storageRepository)
 
 	store.RegisterType(dtos.User{})
 
 	return &StorageMicroservice{uuid: uid, config: cfg, logger: logger, app: app, store: store,
-		database: databaseService, rpcClient: rpcClient, fileService: fileService, storageRpo: storageRepository,
-		grpcServer: grpcServer, fileController: fileController}
+		database: databaseService, broker: broker, rpcClient: rpcClient, fileService: fileService,
+		storageRpo: storageRepository, grpcServer: grpcServer, fileController: fileController, subscriber: subscriber}
 }
 
 func (sms *StorageMicroservice) Setup() {
@@ -73,40 +98,31 @@ func (sms *StorageMicroservice) Setup() {
 		AllowCredentials: true,
 	}))
 
-	fileApi := sms.app.Group("/api/file", func(c *fiber.Ctx) error {
-		cookie := c.Cookies("jwt")
-
-		userData := sms.rpcClient.GetUserDataByJwt(cookie)
+	sms.app.Get("/ready", middleware.Readiness(map[string]func() bool{"broker": sms.broker.Ready}))
 
-		if userData == nil {
-			return c.SendStatus(fiber.StatusUnauthorized)
-		}
+	sms.app.Use(middleware.Identity(sms.config.IdentitySecret))
 
-		sess, err := sms.store.Get(c)
-
-		if err != nil {
-			sms.logger.Panic("Cannot get session", zap.Error(err))
-		}
-
-		sess.Set("userData", userData)
-
-		if err := sess.Save(); err != nil {
-			sms.logger.Panic("Cannot save session", zap.Error(err))
-		}
-
-		return c.Next()
-	})
+	fileApi := sms.app.Group("/api/file", middleware.Authenticate(middleware.Authentication[*dtos.User]{
+		Store: sms.store, Logger: sms.logger, Scope: "storage", Jwks: jwks.NewFromEnv(sms.config.Discovery),
+		ById: sms.rpcClient.GetUserDataById, ByJwt: sms.rpcClient.GetUserDataByJwt,
+		ByApiToken: sms.rpcClient.GetUserDataByApiToken}))
 
 	sms.fileController.RegisterRoutes(&fileApi)
 }
 
 func (sms *StorageMicroservice) Run() {
-	sms.rpcClient.SendNodeMessage(node.CreateRegisterNodeMessage(&node.Node{
+	if err := sms.rpcClient.SendNodeMessage(context.Background(), node.CreateRegisterNodeMessage(&node.Node{
 		Uuid:      sms.uuid,
 		IpAddress: sms.config.IpAddress,
 		Port:      sms.config.Port,
 		GrpcPort:  sms.config.GRpcPort,
-	}))
+	})); err != nil {
+		sms.logger.Error("Cannot register the node at the gateway", zap.Error(err))
+	}
+
+	sms.config.Discovery.Register(sms.logger, discovery.Instance{Service: "storage", Id: sms.uuid.String(),
+		Endpoints: map[string]string{"http": sms.config.FullAddress,
+			"grpc": fmt.Sprintf("%s:%d", sms.config.IpAddress, sms.config.GRpcPort)}})
 
 	lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", sms.config.IpAddress, sms.config.GRpcPort))
 
@@ -115,7 +131,7 @@ func (sms *StorageMicroservice) Run() {
 		sms.logger.Panic("Cannot create listener for GRPC server", zap.Error(err))
 	}
 
-	grpcServer := grpc.NewServer()
+	grpcServer := rpc.NewGrpcServer(sms.config.IdentitySecret)
 	proto.RegisterStorageServer(grpcServer, sms.grpcServer)
 
 	go func() {
@@ -132,6 +148,8 @@ func (sms *StorageMicroservice) Run() {
 	//go sms.rpcServer.RegisterDeleteFileFromDisk()
 	//go sms.rpcServer.RegisterGetFileContentFromDisk()
 
+	sms.subscriber.Start()
+
 	sms.HandleInterrupt()
 
 	if err := sms.app.Listen(sms.config.FullAddress); err != nil {
@@ -151,15 +169,20 @@ func (sms *StorageMicroservice) HandleInterrupt() {
 }
 
 func (sms *StorageMicroservice) Cleanup() {
-	sms.rpcClient.SendNodeMessage(node.CreateDeregisterNodeMessage(&node.Node{
+	sms.config.Discovery.Close()
+
+	if err := sms.rpcClient.SendNodeMessage(context.Background(), node.CreateDeregisterNodeMessage(&node.Node{
 		Uuid:      sms.uuid,
 		IpAddress: sms.config.IpAddress,
 		Port:      sms.config.Port,
 		GrpcPort:  sms.config.GRpcPort,
-	}))
+	})); err != nil {
+		sms.logger.Error("Cannot deregister the node at the gateway", zap.Error(err))
+	}
 
 	//sms.rpcServer.Close()
 	sms.rpcClient.Close()
+	sms.broker.Close()
 
 	if err := sms.logger.Sync(); err != nil {
 		log.Printf("Cannot sync logger. Error: %s", err)
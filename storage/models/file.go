@@ -3,9 +3,11 @@ package models
 import "time"
 
 type File struct {
-	Id           uint      `json:"id"`
-	UniqueName   string    `json:"uniqueName" gorm:"unique"`
-	Name         string    `json:"name"`
-	CreationDate time.Time `json:"creationDate"`
-	OwnerId      uint      `json:"ownerId"`
+	Id              uint      `json:"id"`
+	UniqueName      string    `json:"uniqueName" gorm:"unique"`
+	Name            string    `json:"name"`
+	CreationDate    time.Time `json:"creationDate"`
+	OwnerId         uint      `json:"ownerId"`
+	ClientEncrypted bool      `json:"clientEncrypted"`
+	KeyMetadata     string    `json:"keyMetadata"`
 }
@@ -0,0 +1,41 @@
+package services
+
+import (
+	"context"
+	"dfs/common/events"
+	"dfs/storage/database"
+	"errors"
+	"go.uber.org/zap"
+)
+
+// EventSubscriber removes the file entries of deleted users, so no entries outlive their owner if the deletion
+// did not reach the storage.
+type EventSubscriber struct {
+	logger      *zap.Logger
+	bus         *events.Bus
+	storageRepo *database.StorageRepository
+}
+
+func NewEventSubscriber(logger *zap.Logger, bus *events.Bus, storageRepo *database.StorageRepository) *EventSubscriber {
+	return &EventSubscriber{logger: logger, bus: bus, storageRepo: storageRepo}
+}
+
+func (es *EventSubscriber) Start() {
+	go es.bus.Subscribe("events_storage", map[string]events.Handler{
+		events.UserDeleted: es.userDeleted,
+	})
+}
+
+func (es *EventSubscriber) userDeleted(_ context.Context, event events.Event) error {
+	var userDeleted events.UserDeletedV1
+
+	if err := event.Decode(1, &userDeleted); err != nil {
+		return err
+	}
+
+	if es.storageRepo.DeleteOwnedFiles(userDeleted.UserId) == false {
+		return errors.New("cannot delete owned files")
+	}
+
+	return nil
+}
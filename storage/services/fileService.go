@@ -1,11 +1,16 @@
 package services
 
 import (
+	"bytes"
 	"crypto/aes"
 	"crypto/cipher"
 	"crypto/rand"
+	"crypto/sha256"
 	"dfs/storage/config"
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"go.uber.org/zap"
 	"io"
 	fsl "io/fs"
@@ -13,8 +18,11 @@ import (
 	"os"
 	"path"
 	"path/filepath"
+	"strings"
 )
 
+const clientEncryptedFingerprint = "client"
+
 type FileService struct {
 	config *config.Config
 	logger *zap.Logger
@@ -25,20 +33,98 @@ func NewFileService(cfg *config.Config, logger *zap.Logger) *FileService {
 }
 
 func (fs *FileService) EncryptAndSaveFile(filePath string, fileContent []byte, key []byte) bool {
-	encrypted := fs.Encrypt(fileContent, key)
-	encoded := fs.Encode(encrypted)
-	return fs.SaveFileOnDisk(filePath, encoded)
+	return fs.SaveFileOnDisk(filePath, fs.encryptContent(fileContent, key))
 }
 
-func (fs *FileService) DecryptAndReadFileContent(filePath string, key []byte) []byte {
-	encoded := fs.ReadFileFromDisk(filePath)
+// DecryptAndReadFileContent accepts the candidate keys ordered from the newest one. The key is picked by the
+// fingerprint stored with the file, files saved without a fingerprint are decrypted with the oldest key.
+func (fs *FileService) DecryptAndReadFileContent(filePath string, keys ...[]byte) []byte {
+	stored := fs.ReadFileFromDisk(filePath)
 
-	if encoded == nil {
+	if stored == nil {
 		return nil
 	}
 
-	encrypted := fs.Decode(encoded)
-	return fs.Decrypt(encrypted, key)
+	return fs.decryptContent(stored, keys...)
+}
+
+// SaveClientEncryptedFile stores content encrypted by the client as it is. The marker keeps the server from ever
+// trying to decrypt or re-encrypt it with a key it holds.
+func (fs *FileService) SaveClientEncryptedFile(filePath string, fileContent []byte) bool {
+	marker := []byte(fmt.Sprintf("$%s$", clientEncryptedFingerprint))
+	return fs.SaveFileOnDisk(filePath, append(marker, fileContent...))
+}
+
+func (fs *FileService) ReadClientEncryptedFile(filePath string) []byte {
+	stored := fs.ReadFileFromDisk(filePath)
+
+	if stored == nil {
+		return nil
+	}
+
+	fingerprint, fileContent, ok := splitKeyFingerprint(stored)
+
+	if ok == false || fingerprint != clientEncryptedFingerprint {
+		fs.logger.Error("File is not client encrypted", zap.String("FilePath", filePath))
+		return nil
+	}
+
+	return fileContent
+}
+
+// ReEncryptFile treats a file the node does not have as done, since a node may not hold a replica of every file.
+func (fs *FileService) ReEncryptFile(filePath string, oldKey []byte, newKey []byte) bool {
+	readPath := path.Join(fs.config.FileStoragePath, filepath.Clean(filePath))
+
+	if _, err := os.Stat(readPath); errors.Is(err, fsl.ErrNotExist) {
+		fs.logger.Debug("File to re-encrypt is not stored on the node", zap.String("FilePath", filePath))
+		return true
+	}
+
+	stored := fs.ReadFileFromDisk(filePath)
+
+	if stored == nil {
+		return false
+	}
+
+	if fingerprint, _, ok := splitKeyFingerprint(stored); ok &&
+		(fingerprint == keyFingerprint(newKey) || fingerprint == clientEncryptedFingerprint) {
+		return true
+	}
+
+	fileContent := fs.decryptContent(stored, newKey, oldKey)
+
+	if fileContent == nil {
+		return false
+	}
+
+	return fs.ReplaceFileOnDisk(filePath, fs.encryptContent(fileContent, newKey))
+}
+
+func (fs *FileService) ListDirectory(directoryName string) []string {
+	cleanedPath := filepath.Clean(directoryName)
+
+	if unsafeDirectoryName(cleanedPath) {
+		fs.logger.Error("Unsafe directory name", zap.String("DirectoryName", directoryName))
+		return nil
+	}
+
+	entries, err := os.ReadDir(path.Join(fs.config.FileStoragePath, cleanedPath))
+
+	if err != nil {
+		fs.logger.Error("Cannot read directory", zap.Error(err))
+		return nil
+	}
+
+	filesPath := []string{}
+
+	for _, entry := range entries {
+		if entry.IsDir() == false {
+			filesPath = append(filesPath, path.Join(cleanedPath, entry.Name()))
+		}
+	}
+
+	return filesPath
 }
 
 func (fs *FileService) SaveFileOnDisk(filePath string, fileContent []byte) bool {
@@ -52,6 +138,23 @@ func (fs *FileService) SaveFileOnDisk(filePath string, fileContent []byte) bool
 	return true
 }
 
+func (fs *FileService) ReplaceFileOnDisk(filePath string, fileContent []byte) bool {
+	replacePath := path.Join(fs.config.FileStoragePath, filepath.Clean(filePath))
+	tmpPath := replacePath + ".tmp"
+
+	if err := os.WriteFile(tmpPath, fileContent, 0644); err != nil {
+		fs.logger.Error("Cannot save file on the disk", zap.Error(err))
+		return false
+	}
+
+	if err := os.Rename(tmpPath, replacePath); err != nil {
+		fs.logger.Error("Cannot replace file on the disk", zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
 func (fs *FileService) ReadFileFromDisk(filePath string) []byte {
 	cleanedPath := filepath.Clean(filePath)
 
@@ -148,6 +251,120 @@ func (fs *FileService) Decrypt(cipherText []byte, key []byte) []byte {
 	return plainText
 }
 
+func (fs *FileService) encryptContent(fileContent []byte, key []byte) []byte {
+	encrypted := fs.Encrypt(fileContent, key)
+	encoded := fs.Encode(encrypted)
+
+	return append([]byte(fmt.Sprintf("$%s$", keyFingerprint(key))), encoded...)
+}
+
+func (fs *FileService) decryptContent(stored []byte, keys ...[]byte) []byte {
+	var key []byte
+
+	fingerprint, encoded, ok := splitKeyFingerprint(stored)
+
+	for _, k := range keys {
+		if len(k) == 0 {
+			continue
+		}
+
+		if ok == false {
+			key = k
+		} else if keyFingerprint(k) == fingerprint {
+			key = k
+			break
+		}
+	}
+
+	if key == nil {
+		fs.logger.Error("Cannot find a key matching the stored file", zap.String("KeyFingerprint", fingerprint))
+		return nil
+	}
+
+	encrypted := fs.Decode(encoded)
+	return fs.Decrypt(encrypted, key)
+}
+
+func keyFingerprint(key []byte) string {
+	hash := sha256.Sum256(key)
+	return hex.EncodeToString(hash[:8])
+}
+
+func splitKeyFingerprint(stored []byte) (string, []byte, bool) {
+	if len(stored) == 0 || stored[0] != '$' {
+		return "", stored, false
+	}
+
+	end := bytes.IndexByte(stored[1:], '$')
+
+	if end == -1 {
+		return "", stored, false
+	}
+
+	return string(stored[1 : end+1]), stored[end+2:], true
+}
+
+// RemoveDirectory deletes the directory with all its content. A directory that does not exist counts as removed.
+func (fs *FileService) RemoveDirectory(directoryName string) bool {
+	cleanedName := filepath.Clean(directoryName)
+
+	if unsafeDirectoryName(cleanedName) {
+		fs.logger.Error("Unsafe directory name", zap.String("DirectoryName", directoryName))
+		return false
+	}
+
+	directoryPath := path.Join(fs.config.FileStoragePath, cleanedName)
+
+	if err := os.RemoveAll(directoryPath); err != nil {
+		fs.logger.Error("Cannot remove directory", zap.String("DirectoryName", directoryName), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// unsafeDirectoryName reports whether a cleaned directory name is the storage root or points outside of it.
+func unsafeDirectoryName(cleanedName string) bool {
+	return cleanedName == "." || cleanedName == ".." || filepath.IsAbs(cleanedName) ||
+		strings.HasPrefix(cleanedName, ".."+string(filepath.Separator))
+}
+
+// GetDirectoryUsage returns the number of files in the directory and their total size. A directory that does not exist
+// is empty.
+func (fs *FileService) GetDirectoryUsage(directoryName string) (uint64, uint64, error) {
+	var fileCount, totalBytes uint64
+
+	directoryPath := path.Join(fs.config.FileStoragePath, filepath.Clean(directoryName))
+
+	err := filepath.WalkDir(directoryPath, func(_ string, entry fsl.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		if entry.IsDir() {
+			return nil
+		}
+
+		info, err := entry.Info()
+
+		if err != nil {
+			return err
+		}
+
+		fileCount++
+		totalBytes += uint64(info.Size())
+
+		return nil
+	})
+
+	if err != nil && os.IsNotExist(err) == false {
+		fs.logger.Error("Cannot get directory usage", zap.String("DirectoryName", directoryName), zap.Error(err))
+		return 0, 0, err
+	}
+
+	return fileCount, totalBytes, nil
+}
+
 func (fs *FileService) CreateDirectory(directoryName string) bool {
 	directoryPath := path.Join(fs.config.FileStoragePath, directoryName)
 
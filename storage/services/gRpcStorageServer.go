@@ -34,7 +34,21 @@ func (rss *GRpcStorageServer) GetOwnedFile(_ context.Context, req *proto.OwnedFi
 	}
 
 	return &proto.FileEntry{Id: uint64(fileEntry.Id), OwnerId: uint64(fileEntry.OwnerId), Name: fileEntry.Name,
-		UniqueName: fileEntry.UniqueName, CreationDate: timestamppb.New(fileEntry.CreationDate)}, nil
+		UniqueName: fileEntry.UniqueName, CreationDate: timestamppb.New(fileEntry.CreationDate),
+		ClientEncrypted: fileEntry.ClientEncrypted, KeyMetadata: fileEntry.KeyMetadata}, nil
+}
+
+func (rss *GRpcStorageServer) GetOwnedFiles(_ context.Context, req *proto.OwnedFilesRequest) (*proto.FileEntries, error) {
+	fileEntries := &proto.FileEntries{Files: []*proto.FileEntry{}}
+
+	for _, fileEntry := range rss.storageRepo.GetOwnedFiles(uint(req.OwnerId)) {
+		fileEntries.Files = append(fileEntries.Files, &proto.FileEntry{Id: uint64(fileEntry.Id),
+			OwnerId: uint64(fileEntry.OwnerId), Name: fileEntry.Name, UniqueName: fileEntry.UniqueName,
+			CreationDate: timestamppb.New(fileEntry.CreationDate), ClientEncrypted: fileEntry.ClientEncrypted,
+			KeyMetadata: fileEntry.KeyMetadata})
+	}
+
+	return fileEntries, nil
 }
 
 func (rss *GRpcStorageServer) GetFileById(_ context.Context, req *proto.GetFileByIdRequest) (*proto.FileEntry, error) {
@@ -45,7 +59,8 @@ func (rss *GRpcStorageServer) GetFileById(_ context.Context, req *proto.GetFileB
 	}
 
 	return &proto.FileEntry{Id: uint64(fileEntry.Id), OwnerId: uint64(fileEntry.OwnerId), Name: fileEntry.Name,
-		UniqueName: fileEntry.UniqueName, CreationDate: timestamppb.New(fileEntry.CreationDate)}, nil
+		UniqueName: fileEntry.UniqueName, CreationDate: timestamppb.New(fileEntry.CreationDate),
+		ClientEncrypted: fileEntry.ClientEncrypted, KeyMetadata: fileEntry.KeyMetadata}, nil
 }
 
 func (rss *GRpcStorageServer) GetFileByUniqueName(_ context.Context, file *proto.FileUniqueName) (*proto.FileEntry, error) {
@@ -56,10 +71,16 @@ func (rss *GRpcStorageServer) GetFileByUniqueName(_ context.Context, file *proto
 	}
 
 	return &proto.FileEntry{Id: uint64(fileEntry.Id), OwnerId: uint64(fileEntry.OwnerId), Name: fileEntry.Name,
-		UniqueName: fileEntry.UniqueName, CreationDate: timestamppb.New(fileEntry.CreationDate)}, nil
+		UniqueName: fileEntry.UniqueName, CreationDate: timestamppb.New(fileEntry.CreationDate),
+		ClientEncrypted: fileEntry.ClientEncrypted, KeyMetadata: fileEntry.KeyMetadata}, nil
 }
 
 func (rss *GRpcStorageServer) SaveFileOnDisk(_ context.Context, req *proto.SaveFileRequest) (*proto.StorageResult, error) {
+	if req.ClientEncrypted {
+		saveResult := rss.fileService.SaveClientEncryptedFile(req.SavePath, req.Content)
+		return &proto.StorageResult{Success: saveResult}, nil
+	}
+
 	saveResult := rss.fileService.EncryptAndSaveFile(req.SavePath, req.Content, req.EncryptionKey)
 	return &proto.StorageResult{Success: saveResult}, nil
 }
@@ -70,7 +91,14 @@ func (rss *GRpcStorageServer) DeleteFileFromDisk(_ context.Context, req *proto.D
 }
 
 func (rss *GRpcStorageServer) GetFileContentFromDisk(_ context.Context, req *proto.ReadFileRequest) (*proto.FileContent, error) {
-	fileContent := rss.fileService.DecryptAndReadFileContent(req.ReadPath, req.DecryptionKey)
+	var fileContent []byte
+
+	if req.ClientEncrypted {
+		fileContent = rss.fileService.ReadClientEncryptedFile(req.ReadPath)
+	} else {
+		fileContent = rss.fileService.DecryptAndReadFileContent(req.ReadPath, req.DecryptionKey,
+			req.FallbackDecryptionKey)
+	}
 
 	if fileContent == nil {
 		return nil, errors.New("cannot read file from disk")
@@ -103,3 +131,36 @@ func (rss *GRpcStorageServer) SyncStoredFiles(_ context.Context, storedFiles *pr
 
 	return &proto.StorageResult{Success: true}, nil
 }
+
+func (rss *GRpcStorageServer) ListDirectory(_ context.Context, homeDir *proto.HomeDir) (*proto.DirectoryListing, error) {
+	filesPath := rss.fileService.ListDirectory(homeDir.Name)
+
+	if filesPath == nil {
+		return nil, errors.New("cannot list directory")
+	}
+
+	return &proto.DirectoryListing{FilesPath: filesPath}, nil
+}
+
+func (rss *GRpcStorageServer) DeleteHomeDirectory(_ context.Context, homeDir *proto.HomeDir) (*proto.StorageResult, error) {
+	return &proto.StorageResult{Success: rss.fileService.RemoveDirectory(homeDir.Name)}, nil
+}
+
+func (rss *GRpcStorageServer) DeleteOwnedFiles(_ context.Context, req *proto.OwnedFilesRequest) (*proto.StorageResult, error) {
+	return &proto.StorageResult{Success: rss.storageRepo.DeleteOwnedFiles(uint(req.OwnerId))}, nil
+}
+
+func (rss *GRpcStorageServer) GetStorageUsage(_ context.Context, homeDir *proto.HomeDir) (*proto.StorageUsage, error) {
+	fileCount, totalBytes, err := rss.fileService.GetDirectoryUsage(homeDir.Name)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &proto.StorageUsage{FileCount: fileCount, TotalBytes: totalBytes}, nil
+}
+
+func (rss *GRpcStorageServer) ReEncryptFile(_ context.Context, req *proto.ReEncryptFileRequest) (*proto.StorageResult, error) {
+	reEncryptResult := rss.fileService.ReEncryptFile(req.FilePath, req.OldKey, req.NewKey)
+	return &proto.StorageResult{Success: reEncryptResult}, nil
+}
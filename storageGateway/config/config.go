@@ -1,18 +1,28 @@
 package config
 
 import (
+	"dfs/common/discovery"
+	"dfs/common/rpc"
 	"fmt"
 	"github.com/alecthomas/kong"
 	"github.com/joho/godotenv"
 	"log"
 	"os"
 	"strconv"
+	"time"
 )
 
 type Config struct {
-	IpAddress   string
-	Port        uint64
-	FullAddress string
+	IpAddress          string
+	Port               uint64
+	FullAddress        string
+	AmqpUrl            string
+	Discovery          *discovery.Discovery
+	AmqpConnectTimeout time.Duration
+	AuthGrpcAddress    string
+	IdentitySecret     string
+	RpcWorkers         rpc.Workers
+	ShutdownTimeout    time.Duration
 }
 
 func Create() *Config {
@@ -50,10 +60,67 @@ func Create() *Config {
 	fullAddress := fmt.Sprintf("%s:%d", ipAddress, port)
 
 	cfg := &Config{
-		IpAddress:   ipAddress,
-		Port:        port,
-		FullAddress: fullAddress,
+		IpAddress:       ipAddress,
+		Port:            port,
+		FullAddress:     fullAddress,
+		AmqpUrl:         os.Getenv("AMQP_URL"),
+		AuthGrpcAddress: os.Getenv("AUTH_GRPC_ADDRESS"),
+		IdentitySecret:  os.Getenv("IDENTITY_SECRET"),
 	}
 
+	if cfg.Discovery, err = discovery.NewFromEnv(); err != nil {
+		log.Fatalf("Cannot initialize service discovery. Reason: %s", err)
+	}
+
+	if cfg.AmqpUrl == "" {
+		cfg.AmqpUrl = cfg.Discovery.Address("rabbitmq", "amqp")
+	}
+
+	if cfg.AuthGrpcAddress == "" {
+		cfg.AuthGrpcAddress = discovery.Target("auth")
+	}
+
+	cfg.AmqpConnectTimeout = parseDuration("AMQP_CONNECT_TIMEOUT", time.Minute)
+	cfg.ShutdownTimeout = parseDuration("SHUTDOWN_TIMEOUT", 30*time.Second)
+
+	if cfg.RpcWorkers, err = rpc.ParseWorkers(parseInt("RPC_WORKERS", 4), os.Getenv("RPC_QUEUE_WORKERS")); err != nil {
+		log.Fatalf("Invalid RPC_QUEUE_WORKERS value. Reason: %s", err)
+	}
+
+	// Lifecycle messages of a node have to be processed in the order they were sent
+	cfg.RpcWorkers.Queues["rpc_gateway_node_messages"] = 1
+
 	return cfg
 }
+
+func parseDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return duration
+}
+
+func parseInt(name string, defaultValue int) int {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return number
+}
@@ -29,7 +29,7 @@ func (gc *GatewayController) RegisterRoutes(app *fiber.App) {
 func (gc *GatewayController) uploadFile(ctx *fiber.Ctx) error {
 	activeNodes := gc.nodes.GetNodes()
 
-	for _, n := range *activeNodes {
+	for _, n := range activeNodes {
 		gc.logger.Debug("Gateway picked node", zap.String("NodeAddress", n.IpAddress))
 
 		url := fmt.Sprintf("http://%s:%d/api/file", n.IpAddress, n.Port)
@@ -49,7 +49,7 @@ func (gc *GatewayController) deleteFile(ctx *fiber.Ctx) error {
 	fileUniqueName := ctx.Params("fileUniqueName")
 	activeNodes := gc.nodes.GetNodes()
 
-	for _, n := range *activeNodes {
+	for _, n := range activeNodes {
 		gc.logger.Debug("Gateway picked node", zap.String("NodeAddress", n.IpAddress))
 
 		url := fmt.Sprintf("http://%s:%d/api/file/%s", n.IpAddress, n.Port, fileUniqueName)
@@ -69,6 +69,10 @@ func (gc *GatewayController) downloadFile(ctx *fiber.Ctx) error {
 	fileUniqueName := ctx.Params("fileUniqueName")
 	n := gc.nodes.Next()
 
+	if n == nil {
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"message": "No storage node available"})
+	}
+
 	gc.logger.Debug("Gateway picked node", zap.String("NodeAddress", n.IpAddress))
 
 	url := fmt.Sprintf("http://%s:%d/api/file/%s", n.IpAddress, n.Port, fileUniqueName)
@@ -86,6 +90,10 @@ func (gc *GatewayController) downloadFile(ctx *fiber.Ctx) error {
 func (gc *GatewayController) getFiles(ctx *fiber.Ctx) error {
 	n := gc.nodes.Next()
 
+	if n == nil {
+		return ctx.Status(fiber.StatusServiceUnavailable).JSON(fiber.Map{"message": "No storage node available"})
+	}
+
 	gc.logger.Debug("Gateway picked node", zap.String("NodeAddress", n.IpAddress))
 
 	url := fmt.Sprintf("http://%s:%d/api/file", n.IpAddress, n.Port)
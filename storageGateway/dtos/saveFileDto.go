@@ -1,7 +1,8 @@
 package dtos
 
 type SaveFileDto struct {
-	SavePath      string `json:"savePath"`
-	Content       []byte `json:"content"`
-	EncryptionKey []byte `json:"encryptionKey"`
+	SavePath        string `json:"savePath"`
+	Content         []byte `json:"content"`
+	EncryptionKey   []byte `json:"encryptionKey"`
+	ClientEncrypted bool   `json:"clientEncrypted"`
 }
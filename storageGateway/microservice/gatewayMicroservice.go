@@ -1,6 +1,11 @@
 package microservice
 
 import (
+	"context"
+	"dfs/common/discovery"
+	"dfs/common/jwks"
+	"dfs/common/middleware"
+	"dfs/common/rpc"
 	"dfs/storageGateway/config"
 	"dfs/storageGateway/controllers"
 	"dfs/storageGateway/dtos"
@@ -8,6 +13,7 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
 	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"log"
 	"os"
@@ -17,6 +23,7 @@ import (
 type GatewayMicroservice struct {
 	config            *config.Config
 	logger            *zap.Logger
+	broker            *rpc.Connection
 	nodes             *services.NodeService
 	rpcClient         *services.RpcClient
 	rpcServer         *services.RpcServer
@@ -37,20 +44,33 @@ func NewGatewayMicroservice() *GatewayMicroservice {
 		log.Fatalf("Cannot initialize zap logger. Reason: %s", err)
 	}
 
+	broker, err := rpc.Dial(cfg.AmqpUrl, logger, cfg.AmqpConnectTimeout)
+
+	if err != nil {
+		log.Fatalf("Cannot connect to RabbitMQ. Reason: %s", err)
+	}
+
+	broker.SetWorkers(cfg.RpcWorkers)
+
 	app := fiber.New()
 	store := session.New()
 
-	nodeSrv := services.NewNodeService(logger)
-	grpcClient := services.NewGrpcStorageClient(logger)
+	nodeSrv := services.NewNodeService(logger, cfg.IdentitySecret)
+	grpcClient := services.NewGrpcStorageClient(logger, cfg.IdentitySecret)
 
-	rpcClient := services.NewRpcClient(logger)
-	rpcServer := services.NewRpcServer(logger, nodeSrv, grpcClient)
+	rpcClient, err := services.NewRpcClient(logger, cfg)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize RPC client. Reason: %s", err)
+	}
+
+	rpcServer := services.NewRpcServer(logger, broker, nodeSrv, grpcClient, cfg.IdentitySecret)
 
 	gatewayController := controllers.NewGatewayController(logger, store, nodeSrv)
 
 	store.RegisterType(dtos.UserDto{})
 
-	return &GatewayMicroservice{config: cfg, logger: logger, nodes: nodeSrv, grpcClient: grpcClient,
+	return &GatewayMicroservice{config: cfg, logger: logger, broker: broker, nodes: nodeSrv, grpcClient: grpcClient,
 		rpcClient: rpcClient, rpcServer: rpcServer, app: app, sessionStore: store, gatewayController: gatewayController}
 }
 
@@ -59,26 +79,32 @@ func (gm *GatewayMicroservice) Setup() {
 		AllowCredentials: true,
 	}))
 
+	gm.app.Get("/ready", middleware.Readiness(map[string]func() bool{"broker": gm.broker.Ready}))
+
+	gm.app.Use(middleware.Identity(gm.config.IdentitySecret))
+	gm.app.Use(middleware.Authenticate(middleware.Authentication[*dtos.UserDto]{Store: gm.sessionStore,
+		Logger: gm.logger, Scope: "storage", Jwks: jwks.NewFromEnv(gm.config.Discovery),
+		ById: gm.rpcClient.GetUserDataById, ByJwt: gm.rpcClient.GetUserDataByJwt,
+		ByApiToken: gm.rpcClient.GetUserDataByApiToken}))
+
+	// The nodes trust the user authenticated here instead of looking up the token of the request again
 	gm.app.Use(func(c *fiber.Ctx) error {
-		//cookie := c.Cookies("jwt")
-		//
-		//userData := gm.rpcClient.GetUserDataByJwt(cookie)
-		//
-		//if userData == nil {
-		//	return c.SendStatus(fiber.StatusUnauthorized)
-		//}
-		//
-		//sess, err := gm.sessionStore.Get(c)
-		//
-		//if err != nil {
-		//	gm.logger.Panic("Cannot get session", zap.Error(err))
-		//}
-		//
-		//sess.Set("userData", userData)
-		//
-		//if err := sess.Save(); err != nil {
-		//	gm.logger.Panic("Cannot save session", zap.Error(err))
-		//}
+		sess, err := gm.sessionStore.Get(c)
+
+		if err != nil {
+			gm.logger.Panic("Cannot get session", zap.Error(err))
+		}
+
+		userData := sess.Get("userData").(dtos.UserDto)
+
+		if err := sess.Destroy(); err != nil {
+			gm.logger.Warn("Cannot destroy session", zap.Error(err))
+		}
+
+		if gm.config.IdentitySecret != "" {
+			middleware.ForwardIdentity(c, gm.config.IdentitySecret, middleware.RequestIdentity{UserId: userData.Id,
+				ClientIp: middleware.ClientIp(c)})
+		}
 
 		return c.Next()
 	})
@@ -95,6 +121,17 @@ func (gm *GatewayMicroservice) Run() {
 	go gm.rpcServer.RegisterGetFileById()
 	go gm.rpcServer.RegisterGetOwnedFile()
 	go gm.rpcServer.RegisterSaveFileOnDisk()
+	go gm.rpcServer.RegisterListDirectory()
+	go gm.rpcServer.RegisterReEncryptFile()
+	go gm.rpcServer.RegisterDeleteHomeDirectory()
+	go gm.rpcServer.RegisterDeleteOwnedFiles()
+	go gm.rpcServer.RegisterGetStorageUsage()
+	go gm.rpcServer.RegisterGetOwnedFiles()
+
+	go gm.nodes.WatchNodes(gm.config.Discovery)
+
+	gm.config.Discovery.Register(gm.logger, discovery.Instance{Service: "storage-gateway", Id: uuid.NewString(),
+		Endpoints: map[string]string{"http": gm.config.FullAddress}})
 
 	gm.HandleInterrupt()
 
@@ -114,8 +151,17 @@ func (gm *GatewayMicroservice) HandleInterrupt() {
 	}()
 }
 
+// Cleanup lets the RPC handlers finish the requests they already received, for at most the shutdown timeout.
 func (gm *GatewayMicroservice) Cleanup() {
-	gm.rpcServer.Close()
+	gm.config.Discovery.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), gm.config.ShutdownTimeout)
+	defer cancel()
+
+	if err := gm.broker.Shutdown(ctx); err != nil {
+		gm.logger.Warn("Cannot close RabbitMQ connection", zap.Error(err))
+	}
+
 	gm.rpcClient.Close()
 
 	if err := gm.logger.Sync(); err != nil {
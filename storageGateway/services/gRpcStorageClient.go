@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"dfs/common/rpc"
 	"dfs/proto"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
@@ -14,14 +15,16 @@ type GrpcStorageClient struct {
 	logger     *zap.Logger
 	client     proto.StorageClient
 	connection *grpc.ClientConn
+	secret     string
 }
 
-func NewGrpcStorageClient(logger *zap.Logger) *GrpcStorageClient {
-	return &GrpcStorageClient{logger: logger}
+func NewGrpcStorageClient(logger *zap.Logger, secret string) *GrpcStorageClient {
+	return &GrpcStorageClient{logger: logger, secret: secret}
 }
 
 func (rsc *GrpcStorageClient) Connect(address string) error {
-	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	conn, err := grpc.Dial(address, grpc.WithTransportCredentials(insecure.NewCredentials()),
+		rpc.SignCalls(rsc.secret))
 
 	if err != nil {
 		return err
@@ -157,3 +160,92 @@ func (rsc *GrpcStorageClient) SyncStoredFiles(storedFiles *proto.StoredFiles) bo
 
 	return result.Success
 }
+
+func (rsc *GrpcStorageClient) ListDirectory(dir *proto.HomeDir) []string {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	listing, err := rsc.client.ListDirectory(ctx, dir)
+
+	if err != nil {
+		rsc.logger.Error("Cannot list directory", zap.Error(err))
+		return nil
+	}
+
+	return listing.FilesPath
+}
+
+func (rsc *GrpcStorageClient) ReEncryptFile(req *proto.ReEncryptFileRequest) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := rsc.client.ReEncryptFile(ctx, req)
+
+	if err != nil {
+		rsc.logger.Error("Cannot re-encrypt file", zap.Error(err))
+		return false
+	}
+
+	return result.Success
+}
+
+func (rsc *GrpcStorageClient) DeleteHomeDirectory(dir *proto.HomeDir) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := rsc.client.DeleteHomeDirectory(ctx, dir)
+
+	if err != nil {
+		rsc.logger.Error("Cannot delete home directory", zap.Error(err))
+		return false
+	}
+
+	return result.Success
+}
+
+func (rsc *GrpcStorageClient) DeleteOwnedFiles(req *proto.OwnedFilesRequest) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := rsc.client.DeleteOwnedFiles(ctx, req)
+
+	if err != nil {
+		rsc.logger.Error("Cannot delete owned files", zap.Error(err))
+		return false
+	}
+
+	return result.Success
+}
+
+func (rsc *GrpcStorageClient) GetStorageUsage(dir *proto.HomeDir) *proto.StorageUsage {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	usage, err := rsc.client.GetStorageUsage(ctx, dir)
+
+	if err != nil {
+		rsc.logger.Error("Cannot get storage usage", zap.Error(err))
+		return nil
+	}
+
+	return usage
+}
+
+func (rsc *GrpcStorageClient) GetOwnedFiles(req *proto.OwnedFilesRequest) []*proto.FileEntry {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := rsc.client.GetOwnedFiles(ctx, req)
+
+	if err != nil {
+		rsc.logger.Error("Cannot get owned files", zap.Error(err))
+		return nil
+	}
+
+	// An empty list is not sent over the wire, but it is still a valid answer
+	if result.Files == nil {
+		return []*proto.FileEntry{}
+	}
+
+	return result.Files
+}
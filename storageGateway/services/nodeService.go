@@ -1,27 +1,38 @@
 package services
 
 import (
+	"dfs/common/discovery"
 	"dfs/proto"
 	"dfs/storageGateway/node"
 	"fmt"
 	"github.com/google/uuid"
 	"go.uber.org/zap"
 	"math/rand"
+	"net"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
 )
 
+// nodeRefreshInterval is how often the storage nodes are looked up through discovery.
+const nodeRefreshInterval = 10 * time.Second
+
 type NodeService struct {
 	logger       *zap.Logger
 	mutex        *sync.Mutex
 	nodes        map[uuid.UUID]*node.Node
 	indexedNodes []*node.Node
 	next         uint32
+	// discovered are the nodes added by WatchNodes
+	discovered map[uuid.UUID]bool
+	// secret signs the calls to the nodes
+	secret string
 }
 
-func NewNodeService(log *zap.Logger) *NodeService {
-	return &NodeService{logger: log, mutex: &sync.Mutex{}, nodes: map[uuid.UUID]*node.Node{}, indexedNodes: []*node.Node{}}
+func NewNodeService(log *zap.Logger, secret string) *NodeService {
+	return &NodeService{logger: log, mutex: &sync.Mutex{}, nodes: map[uuid.UUID]*node.Node{},
+		indexedNodes: []*node.Node{}, discovered: map[uuid.UUID]bool{}, secret: secret}
 }
 
 func (sn *NodeService) addNode(node *node.Node) {
@@ -61,14 +72,26 @@ func (sn *NodeService) deleteNode(nodeUuid uuid.UUID) {
 	sn.mutex.Unlock()
 }
 
-func (sn *NodeService) GetNodes() *[]*node.Node {
-	return &sn.indexedNodes
+func (sn *NodeService) hasNode(nodeUuid uuid.UUID) bool {
+	sn.mutex.Lock()
+	defer sn.mutex.Unlock()
+
+	_, ok := sn.nodes[nodeUuid]
+	return ok
+}
+
+// GetNodes returns a copy of the active nodes, which stays valid while nodes are added and removed.
+func (sn *NodeService) GetNodes() []*node.Node {
+	sn.mutex.Lock()
+	defer sn.mutex.Unlock()
+
+	return append([]*node.Node{}, sn.indexedNodes...)
 }
 
 func (sn *NodeService) ProcessNodeMessage(message node.LifeCycleMessage) {
 	switch message.Action {
 	case node.Add:
-		if len(sn.indexedNodes) == 0 {
+		if len(sn.GetNodes()) == 0 {
 			sn.addNode(&message.Node)
 		} else {
 			if sn.SyncNode(&message.Node) {
@@ -84,11 +107,16 @@ func (sn *NodeService) ProcessNodeMessage(message node.LifeCycleMessage) {
 
 func (sn *NodeService) SyncNode(newNode *node.Node) bool {
 	sn.logger.Debug("Syncing node", zap.String("IpAddress", newNode.IpAddress), zap.Uint64("Port", newNode.Port))
+	activeNodes := sn.GetNodes()
+
+	if len(activeNodes) == 0 {
+		return true
+	}
+
 	rand.Seed(time.Now().UnixNano())
-	idx := rand.Int() % len(sn.indexedNodes)
-	n := sn.indexedNodes[idx]
+	n := activeNodes[rand.Int()%len(activeNodes)]
 
-	grpcMasterNodeClient := NewGrpcStorageClient(sn.logger)
+	grpcMasterNodeClient := NewGrpcStorageClient(sn.logger, sn.secret)
 
 	if err := grpcMasterNodeClient.Connect(fmt.Sprintf("%s:%d", n.IpAddress, n.GrpcPort)); err != nil {
 		sn.logger.Error("Cannot connect to Grpc server", zap.Error(err))
@@ -98,7 +126,7 @@ func (sn *NodeService) SyncNode(newNode *node.Node) bool {
 
 	grpcMasterNodeClient.Disconnect()
 
-	grpcNewNodeClient := NewGrpcStorageClient(sn.logger)
+	grpcNewNodeClient := NewGrpcStorageClient(sn.logger, sn.secret)
 
 	if err := grpcNewNodeClient.Connect(fmt.Sprintf("%s:%d", newNode.IpAddress, newNode.GrpcPort)); err != nil {
 		sn.logger.Error("Cannot connect to Grpc server", zap.Error(err))
@@ -111,22 +139,25 @@ func (sn *NodeService) SyncNode(newNode *node.Node) bool {
 	return isSync
 }
 
+// Next returns the active nodes in turns, or nil when there is none.
 func (sn *NodeService) Next() *node.Node {
-	n := atomic.AddUint32(&sn.next, 1)
-	activeNodes := sn.indexedNodes
+	activeNodes := sn.GetNodes()
 
 	sn.logger.Debug("Active nodes", zap.Int("ActiveNodesLen", len(activeNodes)))
 
-	return (activeNodes)[(int(n)-1)%len(activeNodes)]
+	if len(activeNodes) == 0 {
+		return nil
+	}
+
+	n := atomic.AddUint32(&sn.next, 1)
+
+	return activeNodes[(int(n)-1)%len(activeNodes)]
 }
 
 func (sn *NodeService) SyncHomeDirectory(masterNode *node.Node, homeDir *proto.HomeDir) {
-	sn.mutex.Lock()
-	sn.mutex.Unlock()
-
-	for _, n := range sn.indexedNodes {
+	for _, n := range sn.GetNodes() {
 		if n != masterNode {
-			grpcClient := NewGrpcStorageClient(sn.logger)
+			grpcClient := NewGrpcStorageClient(sn.logger, sn.secret)
 
 			if err := grpcClient.Connect(fmt.Sprintf("%s:%d", n.IpAddress, n.GrpcPort)); err != nil {
 				sn.logger.Error("Cannot connect to Grpc server", zap.Error(err))
@@ -143,9 +174,9 @@ func (sn *NodeService) SyncHomeDirectory(masterNode *node.Node, homeDir *proto.H
 }
 
 func (sn *NodeService) SyncSaveFile(masterNode *node.Node, req *proto.SaveFileRequest) {
-	for _, n := range sn.nodes {
+	for _, n := range sn.GetNodes() {
 		if n != masterNode {
-			grpcClient := NewGrpcStorageClient(sn.logger)
+			grpcClient := NewGrpcStorageClient(sn.logger, sn.secret)
 
 			if err := grpcClient.Connect(fmt.Sprintf("%s:%d", n.IpAddress, n.GrpcPort)); err != nil {
 				sn.logger.Error("Cannot connect to Grpc server", zap.Error(err))
@@ -162,9 +193,9 @@ func (sn *NodeService) SyncSaveFile(masterNode *node.Node, req *proto.SaveFileRe
 }
 
 func (sn *NodeService) SyncDeleteFile(masterNode *node.Node, req *proto.DeleteFileRequest) {
-	for _, n := range sn.nodes {
+	for _, n := range sn.GetNodes() {
 		if n != masterNode {
-			grpcClient := NewGrpcStorageClient(sn.logger)
+			grpcClient := NewGrpcStorageClient(sn.logger, sn.secret)
 
 			if err := grpcClient.Connect(fmt.Sprintf("%s:%d", n.IpAddress, n.GrpcPort)); err != nil {
 				sn.logger.Error("Cannot connect to Grpc server", zap.Error(err))
@@ -179,3 +210,150 @@ func (sn *NodeService) SyncDeleteFile(masterNode *node.Node, req *proto.DeleteFi
 		}
 	}
 }
+
+func (sn *NodeService) ReEncryptFile(req *proto.ReEncryptFileRequest) bool {
+	activeNodes := sn.GetNodes()
+
+	if len(activeNodes) == 0 {
+		sn.logger.Error("There are no active storage nodes")
+		return false
+	}
+
+	for _, n := range activeNodes {
+		grpcClient := NewGrpcStorageClient(sn.logger, sn.secret)
+
+		if err := grpcClient.Connect(fmt.Sprintf("%s:%d", n.IpAddress, n.GrpcPort)); err != nil {
+			sn.logger.Error("Cannot connect to Grpc server", zap.Error(err))
+			return false
+		}
+
+		isReEncrypted := grpcClient.ReEncryptFile(req)
+
+		grpcClient.Disconnect()
+
+		if isReEncrypted == false {
+			sn.logger.Error("Cannot re-encrypt file on node",
+				zap.String("NodeAddress", n.IpAddress), zap.Uint64("NodePort", n.Port))
+			return false
+		}
+	}
+
+	return true
+}
+
+func (sn *NodeService) DeleteHomeDirectory(homeDir *proto.HomeDir) bool {
+	activeNodes := sn.GetNodes()
+
+	if len(activeNodes) == 0 {
+		sn.logger.Error("There are no active storage nodes")
+		return false
+	}
+
+	for _, n := range activeNodes {
+		grpcClient := NewGrpcStorageClient(sn.logger, sn.secret)
+
+		if err := grpcClient.Connect(fmt.Sprintf("%s:%d", n.IpAddress, n.GrpcPort)); err != nil {
+			sn.logger.Error("Cannot connect to Grpc server", zap.Error(err))
+			return false
+		}
+
+		isDeleted := grpcClient.DeleteHomeDirectory(homeDir)
+
+		grpcClient.Disconnect()
+
+		if isDeleted == false {
+			sn.logger.Error("Cannot delete home directory on node",
+				zap.String("NodeAddress", n.IpAddress), zap.Uint64("NodePort", n.Port))
+			return false
+		}
+	}
+
+	return true
+}
+
+// WatchNodes adds the storage nodes found through discovery, in the file or the registry, and removes the ones it added
+// once they are gone from there. Nodes announced by lifecycle messages only are left alone.
+func (sn *NodeService) WatchNodes(disc *discovery.Discovery) {
+	ticker := time.NewTicker(nodeRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		sn.syncDiscoveredNodes(disc)
+		<-ticker.C
+	}
+}
+
+func (sn *NodeService) syncDiscoveredNodes(disc *discovery.Discovery) {
+	instances, err := disc.Lookup("storage")
+
+	// Nodes are not removed while the registry cannot be asked
+	if err != nil {
+		sn.logger.Warn("Cannot look storage nodes up", zap.Error(err))
+		return
+	}
+
+	found := map[uuid.UUID]bool{}
+
+	for _, instance := range instances {
+		n, err := instanceToNode(instance)
+
+		if err != nil {
+			sn.logger.Warn("Invalid storage node instance", zap.String("Id", instance.Id), zap.Error(err))
+			continue
+		}
+
+		found[n.Uuid] = true
+
+		if sn.hasNode(n.Uuid) == false {
+			sn.discovered[n.Uuid] = true
+			sn.ProcessNodeMessage(node.LifeCycleMessage{Node: *n, Action: node.Add})
+		}
+	}
+
+	for nodeUuid := range sn.discovered {
+		if found[nodeUuid] == false {
+			delete(sn.discovered, nodeUuid)
+			sn.ProcessNodeMessage(node.LifeCycleMessage{Node: node.Node{Uuid: nodeUuid}, Action: node.Delete})
+		}
+	}
+}
+
+// instanceToNode takes the address of the node from the http endpoint and the gRPC port from the grpc endpoint. Ids
+// that are not UUIDs, e.g. names in the discovery file, are turned into one.
+func instanceToNode(instance discovery.Instance) (*node.Node, error) {
+	nodeUuid, err := uuid.Parse(instance.Id)
+
+	if err != nil {
+		nodeUuid = uuid.NewSHA1(uuid.NameSpaceURL, []byte("storage/"+instance.Id))
+	}
+
+	ipAddress, port, err := splitAddress(instance.Endpoints["http"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, grpcPort, err := splitAddress(instance.Endpoints["grpc"])
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &node.Node{Uuid: nodeUuid, IpAddress: ipAddress, Port: port, GrpcPort: grpcPort}, nil
+}
+
+func splitAddress(address string) (string, uint64, error) {
+	host, port, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return "", 0, err
+	}
+
+	portNumber, err := strconv.ParseUint(port, 10, 16)
+
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in %s", address)
+	}
+
+	return host, portNumber, nil
+}
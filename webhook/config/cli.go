@@ -0,0 +1,6 @@
+package config
+
+type CliArgs struct {
+	Receive       string `help:"Run a local receiver that logs deliveries posted to the address" placeholder:"ADDRESS"`
+	ReceiveSecret string `help:"Secret the local receiver verifies signatures with" placeholder:"SECRET"`
+}
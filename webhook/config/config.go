@@ -0,0 +1,122 @@
+package config
+
+import (
+	"dfs/common/discovery"
+	"github.com/alecthomas/kong"
+	"github.com/joho/godotenv"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+type Config struct {
+	DbConnectionString    string
+	AmqpUrl               string
+	HttpAddress           string
+	Discovery             *discovery.Discovery
+	AmqpConnectTimeout    time.Duration
+	AuthGrpcAddress       string
+	IdentitySecret        string
+	ShareSpaceGrpcAddress string
+	DeliveryTimeout       time.Duration
+	DispatchInterval      time.Duration
+	RetryBackoff          time.Duration
+	MaxRetryBackoff       time.Duration
+	MaxAttempts           int
+	AllowPrivateNetworks  bool
+	Receive               string
+	ReceiveSecret         string
+}
+
+func Create() *Config {
+	var cliArgs CliArgs
+	kong.Parse(&cliArgs)
+
+	cfg := &Config{Receive: cliArgs.Receive, ReceiveSecret: cliArgs.ReceiveSecret}
+
+	// The local receiver needs nothing else
+	if cfg.Receive != "" {
+		return cfg
+	}
+
+	err := godotenv.Load(".env")
+
+	if err != nil {
+		log.Fatal("Cannot load .env file")
+	}
+
+	cfg.DbConnectionString = os.Getenv("DB_CONNECTION_STRING")
+	cfg.AmqpUrl = os.Getenv("AMQP_URL")
+	cfg.AuthGrpcAddress = os.Getenv("AUTH_GRPC_ADDRESS")
+	cfg.IdentitySecret = os.Getenv("IDENTITY_SECRET")
+	cfg.ShareSpaceGrpcAddress = os.Getenv("SHARESPACE_GRPC_ADDRESS")
+	cfg.AllowPrivateNetworks = os.Getenv("WEBHOOK_ALLOW_PRIVATE_NETWORKS") == "true"
+
+	if cfg.Discovery, err = discovery.NewFromEnv(); err != nil {
+		log.Fatalf("Cannot initialize service discovery. Reason: %s", err)
+	}
+
+	if cfg.AmqpUrl == "" {
+		cfg.AmqpUrl = cfg.Discovery.Address("rabbitmq", "amqp")
+	}
+
+	cfg.HttpAddress = os.Getenv("HTTP_ADDRESS")
+
+	if cfg.HttpAddress == "" {
+		cfg.HttpAddress = ":8084"
+	}
+
+	if cfg.AuthGrpcAddress == "" {
+		cfg.AuthGrpcAddress = discovery.Target("auth")
+	}
+
+	if cfg.ShareSpaceGrpcAddress == "" {
+		cfg.ShareSpaceGrpcAddress = discovery.Target("sharespace")
+	}
+
+	cfg.AmqpConnectTimeout = parseDuration("AMQP_CONNECT_TIMEOUT", time.Minute)
+	cfg.DeliveryTimeout = parseDuration("WEBHOOK_TIMEOUT", 10*time.Second)
+	cfg.DispatchInterval = parseDuration("WEBHOOK_DISPATCH_INTERVAL", 5*time.Second)
+	cfg.RetryBackoff = parseDuration("WEBHOOK_RETRY_BACKOFF", 30*time.Second)
+	cfg.MaxRetryBackoff = parseDuration("WEBHOOK_MAX_RETRY_BACKOFF", time.Hour)
+	cfg.MaxAttempts = parseInt("WEBHOOK_MAX_ATTEMPTS", 8)
+
+	if cfg.MaxAttempts < 1 {
+		log.Fatal("WEBHOOK_MAX_ATTEMPTS has to be at least 1")
+	}
+
+	return cfg
+}
+
+func parseDuration(name string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return duration
+}
+
+func parseInt(name string, defaultValue int) int {
+	value := os.Getenv(name)
+
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+
+	if err != nil {
+		log.Fatalf("Invalid %s value. Reason: %s", name, err)
+	}
+
+	return number
+}
@@ -0,0 +1,338 @@
+package controllers
+
+import (
+	"crypto/rand"
+	"dfs/common/events"
+	"dfs/webhook/database"
+	"dfs/webhook/dtos"
+	"dfs/webhook/models"
+	"dfs/webhook/services"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+const (
+	// PingEvent is sent by the test endpoint and is never filtered out
+	PingEvent       = "webhook.ping"
+	maxUserWebhooks = 20
+	minSecretLength = 16
+)
+
+type WebhookController struct {
+	log          *zap.Logger
+	rpc          *services.RpcClient
+	store        *session.Store
+	webhookRepo  *database.WebhookRepository
+	deliveryRepo *database.DeliveryRepository
+	deliveries   *services.DeliveryService
+}
+
+func NewWebhookController(logger *zap.Logger, rpcClient *services.RpcClient, store *session.Store,
+	webhookRepo *database.WebhookRepository, deliveryRepo *database.DeliveryRepository,
+	deliveries *services.DeliveryService) *WebhookController {
+	return &WebhookController{log: logger, rpc: rpcClient, store: store, webhookRepo: webhookRepo,
+		deliveryRepo: deliveryRepo, deliveries: deliveries}
+}
+
+func (wc *WebhookController) RegisterRoutes(app *fiber.App) {
+	app.Post("/api/webhooks", wc.createWebhook)
+	app.Get("/api/webhooks", wc.getWebhooks)
+	app.Delete("/api/webhooks/:id", wc.deleteWebhook)
+	app.Post("/api/webhooks/:id/test", wc.testWebhook)
+	app.Get("/api/webhooks/:id/deliveries", wc.getDeliveries)
+	app.Get("/api/webhooks/:id/deliveries/:deliveryId", wc.getDelivery)
+	app.Post("/api/webhooks/:id/deliveries/:deliveryId/redeliver", wc.redeliver)
+}
+
+// createWebhook registers a webhook of the user, or of a ShareSpace the user owns. The secret is generated when none
+// is given and is returned only in this response.
+func (wc *WebhookController) createWebhook(c *fiber.Ctx) error {
+	createDto := new(dtos.CreateWebhookDto)
+
+	if err := c.BodyParser(createDto); err != nil {
+		wc.log.Warn("Cannot parse webhook data", zap.Error(err))
+		return c.SendStatus(fiber.StatusBadRequest)
+	}
+
+	user := wc.getUser(c)
+
+	if err := wc.deliveries.ValidateUrl(createDto.Url); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": err.Error()})
+	}
+
+	allowedEvents := services.UserEvents
+
+	if createDto.ShareSpaceId != 0 {
+		allowedEvents = services.ShareSpaceEvents
+	}
+
+	if validEvents(createDto.Events, allowedEvents) == false {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "events have to be one or more of " +
+			strings.Join(allowedEvents, ", ")})
+	}
+
+	if createDto.Secret != "" && len(createDto.Secret) < minSecretLength {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "secret is too short"})
+	}
+
+	if createDto.ShareSpaceId != 0 {
+		role, err := wc.rpc.GetShareSpaceRole(c.UserContext(), user.Id, createDto.ShareSpaceId)
+
+		if err != nil {
+			wc.log.Error("Cannot get ShareSpace role", zap.Error(err))
+			return c.SendStatus(fiber.StatusServiceUnavailable)
+		}
+
+		if role != "owner" {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"message": "only the owner can add ShareSpace webhooks"})
+		}
+	}
+
+	if len(wc.webhookRepo.GetUserWebhooks(user.Id)) >= maxUserWebhooks {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "too many webhooks"})
+	}
+
+	secret := createDto.Secret
+
+	if secret == "" {
+		secretBytes := make([]byte, 32)
+
+		if _, err := rand.Read(secretBytes); err != nil {
+			wc.log.Error("Cannot generate webhook secret", zap.Error(err))
+			return c.SendStatus(fiber.StatusInternalServerError)
+		}
+
+		secret = hex.EncodeToString(secretBytes)
+	}
+
+	webhook := &models.Webhook{UserId: user.Id, ShareSpaceId: createDto.ShareSpaceId, Url: createDto.Url,
+		Events: strings.Join(createDto.Events, " "), Secret: secret}
+
+	if wc.webhookRepo.CreateWebhook(webhook) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot create webhook"})
+	}
+
+	webhookDto := createWebhookDto(*webhook)
+	webhookDto.Secret = secret
+
+	return c.Status(fiber.StatusCreated).JSON(webhookDto)
+}
+
+func (wc *WebhookController) getWebhooks(c *fiber.Ctx) error {
+	user := wc.getUser(c)
+	webhookDtos := []dtos.WebhookDto{}
+
+	for _, webhook := range wc.webhookRepo.GetUserWebhooks(user.Id) {
+		webhookDtos = append(webhookDtos, createWebhookDto(webhook))
+	}
+
+	return c.JSON(webhookDtos)
+}
+
+func (wc *WebhookController) deleteWebhook(c *fiber.Ctx) error {
+	webhook := wc.getOwnedWebhook(c)
+
+	if webhook == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "webhook not found"})
+	}
+
+	if wc.webhookRepo.DeleteWebhook(webhook) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot delete webhook"})
+	}
+
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// testWebhook sends a webhook.ping event, delivered and retried like any other event.
+func (wc *WebhookController) testWebhook(c *fiber.Ctx) error {
+	webhook := wc.getOwnedWebhook(c)
+
+	if webhook == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "webhook not found"})
+	}
+
+	data, _ := json.Marshal(fiber.Map{"webhookId": webhook.Id})
+	event := events.Event{Id: uuid.New().String(), Type: PingEvent, Version: 1, Source: "webhook",
+		OccurredAt: time.Now().UTC(), Data: data}
+	payload, err := json.Marshal(event)
+
+	if err != nil {
+		wc.log.Error("Cannot serialize ping event", zap.Error(err))
+		return c.SendStatus(fiber.StatusInternalServerError)
+	}
+
+	delivery := &models.Delivery{WebhookId: webhook.Id, EventId: event.Id, EventType: event.Type,
+		Payload: string(payload), NextAttemptAt: time.Now()}
+
+	if wc.deliveryRepo.CreateDelivery(delivery) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot create delivery"})
+	}
+
+	wc.deliveries.Notify()
+
+	return c.Status(fiber.StatusAccepted).JSON(createDeliveryDto(*delivery))
+}
+
+func (wc *WebhookController) getDeliveries(c *fiber.Ctx) error {
+	webhook := wc.getOwnedWebhook(c)
+
+	if webhook == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "webhook not found"})
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	pageSize, sizeErr := strconv.Atoi(c.Query("pageSize", "50"))
+
+	if err != nil || sizeErr != nil || page < 1 || pageSize < 1 || pageSize > 100 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"message": "Invalid page"})
+	}
+
+	deliveries, total, ok := wc.deliveryRepo.GetDeliveries(webhook.Id, (page-1)*pageSize, pageSize)
+
+	if ok == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot get deliveries"})
+	}
+
+	deliveryDtos := []dtos.DeliveryDto{}
+
+	for _, delivery := range deliveries {
+		deliveryDtos = append(deliveryDtos, createDeliveryDto(delivery))
+	}
+
+	return c.JSON(dtos.DeliveryListDto{Deliveries: deliveryDtos, Total: total, Page: page, PageSize: pageSize})
+}
+
+// getDelivery returns the delivery together with the response or error of every attempt.
+func (wc *WebhookController) getDelivery(c *fiber.Ctx) error {
+	delivery := wc.getOwnedDelivery(c)
+
+	if delivery == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "delivery not found"})
+	}
+
+	deliveryDto := createDeliveryDto(*delivery)
+
+	for _, attempt := range wc.deliveryRepo.GetDeliveryAttempts(delivery.Id) {
+		deliveryDto.Log = append(deliveryDto.Log, dtos.DeliveryAttemptDto{StatusCode: attempt.StatusCode,
+			ResponseBody: attempt.ResponseBody, Error: attempt.Error, DurationMs: attempt.DurationMs,
+			AttemptedAt: attempt.AttemptedAt})
+	}
+
+	return c.JSON(deliveryDto)
+}
+
+// redeliver sends a finished delivery again, e.g. after the receiver was fixed.
+func (wc *WebhookController) redeliver(c *fiber.Ctx) error {
+	delivery := wc.getOwnedDelivery(c)
+
+	if delivery == nil {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"message": "delivery not found"})
+	}
+
+	if delivery.Status == models.DeliveryPending {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{"message": "delivery is still pending"})
+	}
+
+	if wc.deliveryRepo.Redeliver(delivery) == false {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"message": "cannot redeliver"})
+	}
+
+	wc.deliveries.Notify()
+
+	return c.Status(fiber.StatusAccepted).JSON(createDeliveryDto(*delivery))
+}
+
+func (wc *WebhookController) getUser(c *fiber.Ctx) dtos.UserDto {
+	sess, err := wc.store.Get(c)
+	defer sess.Destroy()
+
+	if err != nil {
+		wc.log.Panic("Cannot get session", zap.Error(err))
+	}
+
+	return sess.Get("userData").(dtos.UserDto)
+}
+
+func (wc *WebhookController) getOwnedWebhook(c *fiber.Ctx) *models.Webhook {
+	webhookId, err := strconv.ParseUint(c.Params("id"), 10, 32)
+
+	if err != nil {
+		return nil
+	}
+
+	webhook := wc.webhookRepo.GetWebhookById(uint(webhookId))
+
+	if webhook == nil || webhook.UserId != wc.getUser(c).Id {
+		return nil
+	}
+
+	return webhook
+}
+
+func (wc *WebhookController) getOwnedDelivery(c *fiber.Ctx) *models.Delivery {
+	webhook := wc.getOwnedWebhook(c)
+
+	if webhook == nil {
+		return nil
+	}
+
+	deliveryId, err := strconv.ParseUint(c.Params("deliveryId"), 10, 32)
+
+	if err != nil {
+		return nil
+	}
+
+	return wc.deliveryRepo.GetDeliveryById(webhook.Id, uint(deliveryId))
+}
+
+func validEvents(eventTypes []string, allowedEvents []string) bool {
+	if len(eventTypes) == 0 {
+		return false
+	}
+
+	seen := map[string]bool{}
+
+	for _, eventType := range eventTypes {
+		if seen[eventType] || contains(allowedEvents, eventType) == false {
+			return false
+		}
+
+		seen[eventType] = true
+	}
+
+	return true
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func createWebhookDto(webhook models.Webhook) dtos.WebhookDto {
+	return dtos.WebhookDto{Id: webhook.Id, Url: webhook.Url, Events: strings.Fields(webhook.Events),
+		ShareSpaceId: webhook.ShareSpaceId, CreatedAt: webhook.CreatedAt}
+}
+
+func createDeliveryDto(delivery models.Delivery) dtos.DeliveryDto {
+	deliveryDto := dtos.DeliveryDto{Id: delivery.Id, EventId: delivery.EventId, EventType: delivery.EventType,
+		Status: uint(delivery.Status), Attempts: delivery.Attempts, CreatedAt: delivery.CreatedAt}
+
+	if delivery.Status == models.DeliveryPending {
+		deliveryDto.NextAttemptAt = &delivery.NextAttemptAt
+	}
+
+	return deliveryDto
+}
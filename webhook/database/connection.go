@@ -0,0 +1,20 @@
+package database
+
+import (
+	"dfs/webhook/models"
+	"errors"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+func Connect(connectionString string) (*gorm.DB, error) {
+	connection, err := gorm.Open(postgres.Open(connectionString), &gorm.Config{})
+
+	if err != nil {
+		return nil, errors.New("could not connect to the database")
+	}
+
+	connection.AutoMigrate(&models.Webhook{}, &models.Delivery{}, &models.DeliveryAttempt{})
+
+	return connection, nil
+}
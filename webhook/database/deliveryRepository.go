@@ -0,0 +1,151 @@
+package database
+
+import (
+	"dfs/webhook/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+type DeliveryRepository struct {
+	logger   *zap.Logger
+	database *gorm.DB
+}
+
+func NewDeliveryRepository(log *zap.Logger, db *gorm.DB) *DeliveryRepository {
+	return &DeliveryRepository{logger: log, database: db}
+}
+
+// CreateDeliveries skips deliveries of events the webhooks already received, so redelivered events are not sent twice.
+func (dr *DeliveryRepository) CreateDeliveries(deliveries []models.Delivery) bool {
+	if len(deliveries) == 0 {
+		return true
+	}
+
+	err := dr.database.Clauses(clause.OnConflict{DoNothing: true}).Create(&deliveries).Error
+
+	if err != nil {
+		dr.logger.Error("Cannot create deliveries", zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (dr *DeliveryRepository) CreateDelivery(delivery *models.Delivery) bool {
+	if err := dr.database.Create(delivery).Error; err != nil {
+		dr.logger.Error("Cannot create delivery", zap.Uint("WebhookId", delivery.WebhookId), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// GetDueDeliveries returns pending deliveries whose next attempt is due, oldest first.
+func (dr *DeliveryRepository) GetDueDeliveries(limit int) []models.Delivery {
+	var deliveries []models.Delivery
+
+	err := dr.database.Where("status = ? AND next_attempt_at <= ?", models.DeliveryPending, time.Now()).
+		Order("next_attempt_at").Limit(limit).Find(&deliveries).Error
+
+	if err != nil {
+		dr.logger.Error("Cannot get due deliveries", zap.Error(err))
+		return nil
+	}
+
+	return deliveries
+}
+
+// ClaimDelivery postpones the next attempt to leaseUntil, unless another instance already did so, and reports whether
+// the caller may send the delivery now.
+func (dr *DeliveryRepository) ClaimDelivery(delivery *models.Delivery, leaseUntil time.Time) bool {
+	result := dr.database.Model(&models.Delivery{}).
+		Where("id = ? AND status = ? AND next_attempt_at = ?", delivery.Id, models.DeliveryPending,
+			delivery.NextAttemptAt).
+		Update("next_attempt_at", leaseUntil)
+
+	if result.Error != nil {
+		dr.logger.Error("Cannot claim delivery", zap.Uint("DeliveryId", delivery.Id), zap.Error(result.Error))
+		return false
+	}
+
+	return result.RowsAffected == 1
+}
+
+// RecordAttempt stores the attempt and the new state of the delivery.
+func (dr *DeliveryRepository) RecordAttempt(delivery *models.Delivery, attempt *models.DeliveryAttempt) bool {
+	err := dr.database.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(attempt).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(delivery).Updates(map[string]interface{}{"status": delivery.Status,
+			"attempts": delivery.Attempts, "next_attempt_at": delivery.NextAttemptAt}).Error
+	})
+
+	if err != nil {
+		dr.logger.Error("Cannot record delivery attempt", zap.Uint("DeliveryId", delivery.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+// GetDeliveries returns a page of the webhook's deliveries, newest first, and the number of all of them.
+func (dr *DeliveryRepository) GetDeliveries(webhookId uint, offset int, limit int) ([]models.Delivery, int64, bool) {
+	var deliveries []models.Delivery
+	var total int64
+
+	query := dr.database.Model(&models.Delivery{}).Where("webhook_id = ?", webhookId)
+
+	if err := query.Count(&total).Error; err != nil {
+		dr.logger.Error("Cannot count deliveries", zap.Error(err))
+		return nil, 0, false
+	}
+
+	if err := query.Order("id DESC").Offset(offset).Limit(limit).Find(&deliveries).Error; err != nil {
+		dr.logger.Error("Cannot get deliveries", zap.Error(err))
+		return nil, 0, false
+	}
+
+	return deliveries, total, true
+}
+
+func (dr *DeliveryRepository) GetDeliveryById(webhookId uint, deliveryId uint) *models.Delivery {
+	var delivery models.Delivery
+
+	if err := dr.database.Where("id = ? AND webhook_id = ?", deliveryId, webhookId).First(&delivery).Error; err != nil {
+		return nil
+	}
+
+	return &delivery
+}
+
+func (dr *DeliveryRepository) GetDeliveryAttempts(deliveryId uint) []models.DeliveryAttempt {
+	var attempts []models.DeliveryAttempt
+
+	if err := dr.database.Where("delivery_id = ?", deliveryId).Order("id").Find(&attempts).Error; err != nil {
+		dr.logger.Error("Cannot get delivery attempts", zap.Uint("DeliveryId", deliveryId), zap.Error(err))
+		return nil
+	}
+
+	return attempts
+}
+
+// Redeliver makes a finished delivery pending again, with a fresh set of attempts.
+func (dr *DeliveryRepository) Redeliver(delivery *models.Delivery) bool {
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+
+	err := dr.database.Model(delivery).Updates(map[string]interface{}{"status": delivery.Status,
+		"attempts": delivery.Attempts, "next_attempt_at": delivery.NextAttemptAt}).Error
+
+	if err != nil {
+		dr.logger.Error("Cannot redeliver delivery", zap.Uint("DeliveryId", delivery.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
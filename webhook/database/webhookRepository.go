@@ -0,0 +1,108 @@
+package database
+
+import (
+	"dfs/webhook/models"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type WebhookRepository struct {
+	logger   *zap.Logger
+	database *gorm.DB
+}
+
+func NewWebhookRepository(log *zap.Logger, db *gorm.DB) *WebhookRepository {
+	return &WebhookRepository{logger: log, database: db}
+}
+
+func (wr *WebhookRepository) CreateWebhook(webhook *models.Webhook) bool {
+	if err := wr.database.Create(webhook).Error; err != nil {
+		wr.logger.Error("Cannot create webhook", zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (wr *WebhookRepository) GetWebhookById(webhookId uint) *models.Webhook {
+	var webhook models.Webhook
+
+	if err := wr.database.Where("id = ?", webhookId).First(&webhook).Error; err != nil {
+		return nil
+	}
+
+	return &webhook
+}
+
+// GetUserWebhooks returns the webhooks registered by the user, including those of the user's ShareSpaces.
+func (wr *WebhookRepository) GetUserWebhooks(userId uint) []models.Webhook {
+	var webhooks []models.Webhook
+
+	if err := wr.database.Where("user_id = ?", userId).Order("id").Find(&webhooks).Error; err != nil {
+		wr.logger.Error("Cannot get user webhooks", zap.Uint("UserId", userId), zap.Error(err))
+		return nil
+	}
+
+	return webhooks
+}
+
+// GetSubscribers returns the user webhooks of the users and the webhooks of the ShareSpace, without filtering them by
+// event type.
+func (wr *WebhookRepository) GetSubscribers(userIds []uint, shareSpaceId uint) ([]models.Webhook, bool) {
+	var webhooks []models.Webhook
+
+	query := wr.database.Where("share_space_id = 0 AND user_id IN ?", userIds)
+
+	if shareSpaceId != 0 {
+		query = wr.database.Where("share_space_id = ?", shareSpaceId)
+	}
+
+	if err := query.Find(&webhooks).Error; err != nil {
+		wr.logger.Error("Cannot get subscribed webhooks", zap.Error(err))
+		return nil, false
+	}
+
+	return webhooks, true
+}
+
+// DeleteWebhook removes the webhook together with its delivery log.
+func (wr *WebhookRepository) DeleteWebhook(webhook *models.Webhook) bool {
+	err := wr.database.Transaction(func(tx *gorm.DB) error {
+		return deleteWebhooks(tx, "id = ?", webhook.Id)
+	})
+
+	if err != nil {
+		wr.logger.Error("Cannot delete webhook", zap.Uint("WebhookId", webhook.Id), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func (wr *WebhookRepository) DeleteUserWebhooks(userId uint) bool {
+	err := wr.database.Transaction(func(tx *gorm.DB) error {
+		return deleteWebhooks(tx, "user_id = ?", userId)
+	})
+
+	if err != nil {
+		wr.logger.Error("Cannot delete user webhooks", zap.Uint("UserId", userId), zap.Error(err))
+		return false
+	}
+
+	return true
+}
+
+func deleteWebhooks(tx *gorm.DB, condition string, value uint) error {
+	webhookIds := tx.Model(&models.Webhook{}).Select("id").Where(condition, value)
+	deliveryIds := tx.Model(&models.Delivery{}).Select("id").Where("webhook_id IN (?)", webhookIds)
+
+	if err := tx.Where("delivery_id IN (?)", deliveryIds).Delete(&models.DeliveryAttempt{}).Error; err != nil {
+		return err
+	}
+
+	if err := tx.Where("webhook_id IN (?)", webhookIds).Delete(&models.Delivery{}).Error; err != nil {
+		return err
+	}
+
+	return tx.Where(condition, value).Delete(&models.Webhook{}).Error
+}
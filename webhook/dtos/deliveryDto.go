@@ -0,0 +1,29 @@
+package dtos
+
+import "time"
+
+type DeliveryAttemptDto struct {
+	StatusCode   int       `json:"statusCode"`
+	ResponseBody string    `json:"responseBody"`
+	Error        string    `json:"error"`
+	DurationMs   int64     `json:"durationMs"`
+	AttemptedAt  time.Time `json:"attemptedAt"`
+}
+
+type DeliveryDto struct {
+	Id            uint                 `json:"id"`
+	EventId       string               `json:"eventId"`
+	EventType     string               `json:"eventType"`
+	Status        uint                 `json:"status"`
+	Attempts      int                  `json:"attempts"`
+	NextAttemptAt *time.Time           `json:"nextAttemptAt"`
+	CreatedAt     time.Time            `json:"createdAt"`
+	Log           []DeliveryAttemptDto `json:"log,omitempty"`
+}
+
+type DeliveryListDto struct {
+	Deliveries []DeliveryDto `json:"deliveries"`
+	Total      int64         `json:"total"`
+	Page       int           `json:"page"`
+	PageSize   int           `json:"pageSize"`
+}
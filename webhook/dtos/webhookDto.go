@@ -0,0 +1,19 @@
+package dtos
+
+import "time"
+
+type CreateWebhookDto struct {
+	Url          string   `json:"url"`
+	Events       []string `json:"events"`
+	Secret       string   `json:"secret"`
+	ShareSpaceId uint     `json:"shareSpaceId"`
+}
+
+type WebhookDto struct {
+	Id           uint      `json:"id"`
+	Url          string    `json:"url"`
+	Events       []string  `json:"events"`
+	ShareSpaceId uint      `json:"shareSpaceId"`
+	CreatedAt    time.Time `json:"createdAt"`
+	Secret       string    `json:"secret,omitempty"`
+}
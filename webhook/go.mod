@@ -0,0 +1,3 @@
+module dfs/webhook
+
+go 1.18
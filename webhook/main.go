@@ -0,0 +1,20 @@
+package main
+
+import (
+	"dfs/webhook/config"
+	"dfs/webhook/microservice"
+)
+
+func main() {
+	cfg := config.Create()
+
+	if cfg.Receive != "" {
+		microservice.RunReceiver(cfg)
+		return
+	}
+
+	webhookMicroservice := microservice.NewWebhookMicroservice(cfg)
+	webhookMicroservice.Setup()
+	defer webhookMicroservice.Cleanup()
+	webhookMicroservice.Run()
+}
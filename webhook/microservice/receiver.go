@@ -0,0 +1,54 @@
+package microservice
+
+import (
+	"strconv"
+	"time"
+
+	"dfs/webhook/config"
+	"dfs/webhook/services"
+
+	"github.com/gofiber/fiber/v2"
+	"go.uber.org/zap"
+)
+
+// maxTimestampAge is how old a delivery the receiver still accepts, which limits replays of captured requests
+const maxTimestampAge = 5 * time.Minute
+
+// RunReceiver logs every delivery posted to the address, for trying webhooks out locally. With a secret it also
+// verifies the signatures and answers 401 to deliveries that fail the check, which are then retried.
+func RunReceiver(cfg *config.Config) {
+	logger := createLogger()
+	defer logger.Sync()
+
+	app := fiber.New()
+
+	app.Post("/*", func(c *fiber.Ctx) error {
+		fields := []zap.Field{zap.String("Path", c.Path()), zap.String("Event", c.Get("X-Dfs-Event")),
+			zap.String("DeliveryId", c.Get("X-Dfs-Delivery")), zap.ByteString("Body", c.Body())}
+
+		if cfg.ReceiveSecret == "" {
+			logger.Info("Delivery received", fields...)
+			return c.SendStatus(fiber.StatusOK)
+		}
+
+		timestamp, err := strconv.ParseInt(c.Get("X-Dfs-Timestamp"), 10, 64)
+
+		if err != nil || time.Since(time.Unix(timestamp, 0)) > maxTimestampAge {
+			logger.Warn("Delivery rejected, invalid timestamp", fields...)
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		if services.Verify(cfg.ReceiveSecret, timestamp, c.Body(), c.Get("X-Dfs-Signature")) == false {
+			logger.Warn("Delivery rejected, invalid signature", fields...)
+			return c.SendStatus(fiber.StatusUnauthorized)
+		}
+
+		logger.Info("Delivery received and verified", fields...)
+
+		return c.SendStatus(fiber.StatusOK)
+	})
+
+	if err := app.Listen(cfg.Receive); err != nil {
+		logger.Fatal("Cannot run receiver", zap.Error(err))
+	}
+}
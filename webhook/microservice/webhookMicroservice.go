@@ -0,0 +1,122 @@
+package microservice
+
+import (
+	"dfs/common/discovery"
+	"dfs/common/jwks"
+	"log"
+
+	"dfs/common/events"
+	"dfs/common/middleware"
+	"dfs/common/rpc"
+	"dfs/webhook/config"
+	"dfs/webhook/controllers"
+	"dfs/webhook/database"
+	"dfs/webhook/dtos"
+	"dfs/webhook/services"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"github.com/gofiber/fiber/v2/middleware/session"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+	"gorm.io/gorm"
+)
+
+type WebhookMicroservice struct {
+	config            *config.Config
+	logger            *zap.Logger
+	app               *fiber.App
+	store             *session.Store
+	database          *gorm.DB
+	broker            *rpc.Connection
+	rpcClient         *services.RpcClient
+	deliveries        *services.DeliveryService
+	subscriber        *services.EventSubscriber
+	webhookController *controllers.WebhookController
+}
+
+func NewWebhookMicroservice(cfg *config.Config) *WebhookMicroservice {
+	logger := createLogger()
+
+	databaseService, err := database.Connect(cfg.DbConnectionString)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize database service. Reason: %s", err)
+	}
+
+	broker, err := rpc.Dial(cfg.AmqpUrl, logger, cfg.AmqpConnectTimeout)
+
+	if err != nil {
+		log.Fatalf("Cannot connect to RabbitMQ. Reason: %s", err)
+	}
+
+	rpcClient, err := services.NewRpcClient(logger, cfg)
+
+	if err != nil {
+		log.Fatalf("Cannot initialize RPC client. Reason: %s", err)
+	}
+
+	bus, err := events.NewBus(broker, logger, "webhook")
+
+	if err != nil {
+		log.Fatalf("Cannot initialize event bus. Reason: %s", err)
+	}
+
+	app := fiber.New()
+	store := session.New()
+	webhookRepo := database.NewWebhookRepository(logger, databaseService)
+	deliveryRepo := database.NewDeliveryRepository(logger, databaseService)
+	deliveries := services.NewDeliveryService(cfg, logger, webhookRepo, deliveryRepo)
+	subscriber := services.NewEventSubscriber(logger, bus, webhookRepo, deliveryRepo, deliveries)
+	webhookController := controllers.NewWebhookController(logger, rpcClient, store, webhookRepo, deliveryRepo,
+		deliveries)
+	store.RegisterType(dtos.UserDto{})
+
+	return &WebhookMicroservice{config: cfg, logger: logger, app: app, store: store, database: databaseService,
+		broker: broker, rpcClient: rpcClient, deliveries: deliveries, subscriber: subscriber,
+		webhookController: webhookController}
+}
+
+func createLogger() *zap.Logger {
+	loggerCfg := zap.NewDevelopmentConfig()
+	loggerCfg.EncoderConfig.FunctionKey = "func"
+	logger, err := loggerCfg.Build()
+
+	if err != nil {
+		log.Fatalf("Cannot initialize zap logger. Reason: %s", err)
+	}
+
+	return logger
+}
+
+func (wms *WebhookMicroservice) Setup() {
+	wms.app.Use(cors.New(cors.Config{
+		AllowCredentials: true,
+	}))
+
+	wms.app.Get("/ready", middleware.Readiness(map[string]func() bool{"broker": wms.broker.Ready}))
+
+	wms.app.Use(middleware.Identity(wms.config.IdentitySecret))
+	wms.app.Use(middleware.Authenticate(middleware.Authentication[*dtos.UserDto]{Store: wms.store,
+		Logger: wms.logger, Scope: "webhook", Jwks: jwks.NewFromEnv(wms.config.Discovery),
+		ById: wms.rpcClient.GetUserDataById, ByJwt: wms.rpcClient.GetUserDataByJwt,
+		ByApiToken: wms.rpcClient.GetUserDataByApiToken}))
+
+	wms.webhookController.RegisterRoutes(wms.app)
+}
+
+func (wms *WebhookMicroservice) Run() {
+	wms.deliveries.Start()
+	wms.subscriber.Start()
+	wms.config.Discovery.Register(wms.logger, discovery.Instance{Service: "webhook", Id: uuid.NewString(),
+		Endpoints: map[string]string{"http": wms.config.HttpAddress}})
+	wms.app.Listen(wms.config.HttpAddress)
+}
+
+func (wms *WebhookMicroservice) Cleanup() {
+	wms.config.Discovery.Close()
+	wms.deliveries.Stop()
+	wms.rpcClient.Close()
+	wms.broker.Close()
+	wms.logger.Sync()
+}
@@ -0,0 +1,35 @@
+package models
+
+import "time"
+
+type DeliveryStatus uint
+
+const (
+	DeliveryPending   DeliveryStatus = iota
+	DeliverySucceeded DeliveryStatus = iota
+	DeliveryFailed    DeliveryStatus = iota
+)
+
+// Delivery is one event sent to one webhook. The payload is stored, so every attempt sends the same body.
+type Delivery struct {
+	Id            uint           `json:"id" gorm:"primaryKey"`
+	WebhookId     uint           `json:"webhookId" gorm:"uniqueIndex:idx_delivery_event"`
+	EventId       string         `json:"eventId" gorm:"uniqueIndex:idx_delivery_event"`
+	EventType     string         `json:"eventType"`
+	Payload       string         `json:"-"`
+	Status        DeliveryStatus `json:"status" gorm:"index"`
+	Attempts      int            `json:"attempts"`
+	NextAttemptAt time.Time      `json:"nextAttemptAt" gorm:"index"`
+	CreatedAt     time.Time      `json:"createdAt"`
+}
+
+// DeliveryAttempt records the response, or the error when there was none, of one request.
+type DeliveryAttempt struct {
+	Id           uint      `json:"id" gorm:"primaryKey"`
+	DeliveryId   uint      `json:"deliveryId" gorm:"index"`
+	StatusCode   int       `json:"statusCode"`
+	ResponseBody string    `json:"responseBody"`
+	Error        string    `json:"error"`
+	DurationMs   int64     `json:"durationMs"`
+	AttemptedAt  time.Time `json:"attemptedAt"`
+}
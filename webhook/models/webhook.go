@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+type Webhook struct {
+	Id           uint      `json:"id" gorm:"primaryKey"`
+	UserId       uint      `json:"userId" gorm:"index"`
+	ShareSpaceId uint      `json:"shareSpaceId" gorm:"index"`
+	Url          string    `json:"url"`
+	Events       string    `json:"events"`
+	Secret       string    `json:"-"`
+	CreatedAt    time.Time `json:"createdAt"`
+}
@@ -0,0 +1,300 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"dfs/webhook/config"
+	"dfs/webhook/database"
+	"dfs/webhook/models"
+
+	"go.uber.org/zap"
+)
+
+const (
+	dispatchBatchSize   = 100
+	dispatchConcurrency = 8
+	// responseLimit is the number of response body bytes kept in the delivery log
+	responseLimit = 1024
+)
+
+// ErrPrivateAddress is returned for webhook URLs pointing to loopback, private or link-local addresses, unless
+// private networks are allowed.
+var ErrPrivateAddress = errors.New("webhook: private network addresses are not allowed")
+
+// DeliveryService sends pending deliveries and retries failed ones with exponential backoff. Instances sharing the
+// database claim deliveries before sending them, so each attempt is made by one instance only.
+type DeliveryService struct {
+	cfg          *config.Config
+	logger       *zap.Logger
+	webhookRepo  *database.WebhookRepository
+	deliveryRepo *database.DeliveryRepository
+	client       *http.Client
+	wake         chan struct{}
+	stop         chan struct{}
+	stopOnce     sync.Once
+}
+
+func NewDeliveryService(cfg *config.Config, logger *zap.Logger, webhookRepo *database.WebhookRepository,
+	deliveryRepo *database.DeliveryRepository) *DeliveryService {
+	dialer := &net.Dialer{Timeout: cfg.DeliveryTimeout}
+
+	// Checked on every connection, so host names resolving to private addresses are rejected as well
+	if cfg.AllowPrivateNetworks == false {
+		dialer.Control = rejectPrivateAddress
+	}
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   cfg.DeliveryTimeout,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	return &DeliveryService{cfg: cfg, logger: logger, webhookRepo: webhookRepo, deliveryRepo: deliveryRepo,
+		client: client, wake: make(chan struct{}, 1), stop: make(chan struct{})}
+}
+
+func (ds *DeliveryService) Start() {
+	go ds.run()
+}
+
+// Notify makes the service look for due deliveries right away instead of at the next interval.
+func (ds *DeliveryService) Notify() {
+	select {
+	case ds.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Stop ends the dispatch loop. Deliveries being sent are retried once their claim expires.
+func (ds *DeliveryService) Stop() {
+	ds.stopOnce.Do(func() { close(ds.stop) })
+}
+
+// ValidateUrl checks that the URL can be used for a webhook.
+func (ds *DeliveryService) ValidateUrl(rawUrl string) error {
+	webhookUrl, err := url.Parse(rawUrl)
+
+	if err != nil {
+		return err
+	}
+
+	if webhookUrl.Scheme != "http" && webhookUrl.Scheme != "https" {
+		return errors.New("webhook: the url has to use http or https")
+	}
+
+	if webhookUrl.Hostname() == "" {
+		return errors.New("webhook: the url has no host")
+	}
+
+	if ds.cfg.AllowPrivateNetworks {
+		return nil
+	}
+
+	if webhookUrl.Hostname() == "localhost" {
+		return ErrPrivateAddress
+	}
+
+	if ip := net.ParseIP(webhookUrl.Hostname()); ip != nil && isPrivateAddress(ip) {
+		return ErrPrivateAddress
+	}
+
+	return nil
+}
+
+func (ds *DeliveryService) run() {
+	ticker := time.NewTicker(ds.cfg.DispatchInterval)
+	defer ticker.Stop()
+
+	for {
+		if ds.dispatch() == dispatchBatchSize {
+			ds.Notify()
+		}
+
+		select {
+		case <-ds.stop:
+			return
+		case <-ticker.C:
+		case <-ds.wake:
+		}
+	}
+}
+
+// dispatch sends a batch of due deliveries and returns its size.
+func (ds *DeliveryService) dispatch() int {
+	deliveries := ds.deliveryRepo.GetDueDeliveries(dispatchBatchSize)
+	// The claim outlasts the request, so no other instance sends the delivery meanwhile
+	leaseUntil := time.Now().Add(2 * ds.cfg.DeliveryTimeout)
+	slots := make(chan struct{}, dispatchConcurrency)
+	var wg sync.WaitGroup
+
+	for i := range deliveries {
+		delivery := &deliveries[i]
+
+		if ds.deliveryRepo.ClaimDelivery(delivery, leaseUntil) == false {
+			continue
+		}
+
+		slots <- struct{}{}
+		wg.Add(1)
+
+		go func() {
+			defer func() {
+				<-slots
+				wg.Done()
+			}()
+
+			ds.deliver(delivery)
+		}()
+	}
+
+	wg.Wait()
+
+	return len(deliveries)
+}
+
+func (ds *DeliveryService) deliver(delivery *models.Delivery) {
+	webhook := ds.webhookRepo.GetWebhookById(delivery.WebhookId)
+
+	if webhook == nil {
+		// Deleted together with its deliveries meanwhile
+		return
+	}
+
+	attempt := ds.send(webhook, delivery)
+	delivery.Attempts++
+
+	switch {
+	case attempt.StatusCode >= 200 && attempt.StatusCode < 300:
+		delivery.Status = models.DeliverySucceeded
+	case delivery.Attempts >= ds.cfg.MaxAttempts:
+		delivery.Status = models.DeliveryFailed
+	default:
+		delivery.NextAttemptAt = time.Now().Add(ds.backoff(delivery.Attempts))
+	}
+
+	fields := []zap.Field{zap.Uint("DeliveryId", delivery.Id), zap.Uint("WebhookId", webhook.Id),
+		zap.String("Event", delivery.EventType), zap.Int("Attempt", delivery.Attempts),
+		zap.Int("StatusCode", attempt.StatusCode)}
+
+	if delivery.Status == models.DeliverySucceeded {
+		ds.logger.Debug("Webhook delivered", fields...)
+	} else {
+		ds.logger.Warn("Webhook delivery failed", append(fields, zap.String("Error", attempt.Error))...)
+	}
+
+	ds.deliveryRepo.RecordAttempt(delivery, attempt)
+}
+
+// send posts the payload signed with the webhook secret. Receivers verify the signature over the timestamp and the
+// body, and may reject old timestamps to prevent replays.
+func (ds *DeliveryService) send(webhook *models.Webhook, delivery *models.Delivery) *models.DeliveryAttempt {
+	body := []byte(delivery.Payload)
+	timestamp := time.Now()
+	attempt := &models.DeliveryAttempt{DeliveryId: delivery.Id, AttemptedAt: timestamp}
+
+	ctx, cancel := context.WithTimeout(context.Background(), ds.cfg.DeliveryTimeout)
+	defer cancel()
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.Url, bytes.NewReader(body))
+
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "dfs-webhook")
+	request.Header.Set("X-Dfs-Event", delivery.EventType)
+	request.Header.Set("X-Dfs-Delivery", strconv.FormatUint(uint64(delivery.Id), 10))
+	request.Header.Set("X-Dfs-Timestamp", strconv.FormatInt(timestamp.Unix(), 10))
+	request.Header.Set("X-Dfs-Signature", Sign(webhook.Secret, timestamp.Unix(), body))
+
+	response, err := ds.client.Do(request)
+	attempt.DurationMs = time.Since(timestamp).Milliseconds()
+
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	defer response.Body.Close()
+
+	responseBody, _ := io.ReadAll(io.LimitReader(response.Body, responseLimit))
+	attempt.StatusCode = response.StatusCode
+	attempt.ResponseBody = string(responseBody)
+
+	if response.StatusCode < 200 || response.StatusCode >= 300 {
+		attempt.Error = fmt.Sprintf("unexpected status %d", response.StatusCode)
+	}
+
+	return attempt
+}
+
+// backoff doubles the delay after every failed attempt, up to the configured maximum.
+func (ds *DeliveryService) backoff(attempts int) time.Duration {
+	delay := ds.cfg.RetryBackoff
+
+	for i := 1; i < attempts && delay < ds.cfg.MaxRetryBackoff; i++ {
+		delay *= 2
+	}
+
+	if delay > ds.cfg.MaxRetryBackoff {
+		delay = ds.cfg.MaxRetryBackoff
+	}
+
+	return delay
+}
+
+// Sign returns the X-Dfs-Signature header value, the hex encoded HMAC-SHA256 of "<timestamp>.<body>".
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks the signature in constant time.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+func rejectPrivateAddress(_ string, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+
+	if err != nil {
+		return err
+	}
+
+	if ip := net.ParseIP(host); ip == nil || isPrivateAddress(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateAddress, host)
+	}
+
+	return nil
+}
+
+func isPrivateAddress(ip net.IP) bool {
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified()
+}
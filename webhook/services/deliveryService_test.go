@@ -0,0 +1,83 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"dfs/webhook/config"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		signature string
+	}{
+		{"event", "secret", 1700000000, `{"type":"file.created"}`,
+			"sha256=64a295d3a2a0db938f79dff5c0feff2f8e8ed834b9428a071a60be686819c22b"},
+		{"empty body", "secret", 1700000000, "",
+			"sha256=4bc5f74d868b97888288889c5d9d65df02526f94c1592a79fdf4fe8b26e311e5"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if signature := Sign(test.secret, test.timestamp, []byte(test.body)); signature != test.signature {
+				t.Fatalf("expected %s, got %s", test.signature, signature)
+			}
+		})
+	}
+}
+
+func TestVerify(t *testing.T) {
+	body := []byte(`{"type":"file.created"}`)
+	signature := Sign("secret", 1700000000, body)
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      []byte
+		signature string
+		valid     bool
+	}{
+		{"matching", "secret", 1700000000, body, signature, true},
+		{"other secret", "other", 1700000000, body, signature, false},
+		{"other timestamp", "secret", 1700000001, body, signature, false},
+		{"other body", "secret", 1700000000, []byte(`{"type":"file.deleted"}`), signature, false},
+		{"without prefix", "secret", 1700000000, body, signature[len("sha256="):], false},
+		{"empty signature", "secret", 1700000000, body, "", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if valid := Verify(test.secret, test.timestamp, test.body, test.signature); valid != test.valid {
+				t.Fatalf("expected %t, got %t", test.valid, valid)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	ds := &DeliveryService{cfg: &config.Config{RetryBackoff: 30 * time.Second, MaxRetryBackoff: time.Hour}}
+
+	tests := []struct {
+		attempts int
+		delay    time.Duration
+	}{
+		{0, 30 * time.Second},
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{100, time.Hour},
+	}
+
+	for _, test := range tests {
+		if delay := ds.backoff(test.attempts); delay != test.delay {
+			t.Errorf("attempts %d: expected %s, got %s", test.attempts, test.delay, delay)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package services
+
+import (
+	"context"
+	"dfs/common/events"
+	"dfs/webhook/database"
+	"dfs/webhook/models"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// UserEvents can be subscribed to by user webhooks, ShareSpaceEvents by webhooks of a ShareSpace.
+var (
+	UserEvents       = []string{events.FileCreated, events.FileDeleted, events.ShareCreated}
+	ShareSpaceEvents = []string{events.ShareSpaceFileCreated, events.ShareSpaceFileDeleted,
+		events.ShareSpaceMemberRemoved}
+)
+
+// EventSubscriber turns domain events into deliveries for the webhooks subscribed to them.
+type EventSubscriber struct {
+	logger       *zap.Logger
+	bus          *events.Bus
+	webhookRepo  *database.WebhookRepository
+	deliveryRepo *database.DeliveryRepository
+	deliveries   *DeliveryService
+}
+
+func NewEventSubscriber(logger *zap.Logger, bus *events.Bus, webhookRepo *database.WebhookRepository,
+	deliveryRepo *database.DeliveryRepository, deliveries *DeliveryService) *EventSubscriber {
+	return &EventSubscriber{logger: logger, bus: bus, webhookRepo: webhookRepo, deliveryRepo: deliveryRepo,
+		deliveries: deliveries}
+}
+
+func (es *EventSubscriber) Start() {
+	handlers := map[string]events.Handler{events.UserDeleted: es.userDeleted}
+
+	for _, eventType := range append(UserEvents, ShareSpaceEvents...) {
+		handlers[eventType] = es.dispatch
+	}
+
+	go es.bus.Subscribe("events_webhook", handlers)
+}
+
+// dispatch creates a delivery for every webhook subscribed to the event. Deliveries are unique per event, so an event
+// received again creates no new ones.
+func (es *EventSubscriber) dispatch(_ context.Context, event events.Event) error {
+	userIds, shareSpaceId, err := subjects(event)
+
+	if err != nil {
+		return err
+	}
+
+	webhooks, ok := es.webhookRepo.GetSubscribers(userIds, shareSpaceId)
+
+	if ok == false {
+		return errors.New("cannot get subscribed webhooks")
+	}
+
+	payload, err := json.Marshal(event)
+
+	if err != nil {
+		return err
+	}
+
+	var deliveries []models.Delivery
+
+	for _, webhook := range webhooks {
+		if Subscribed(webhook, event.Type) {
+			deliveries = append(deliveries, models.Delivery{WebhookId: webhook.Id, EventId: event.Id,
+				EventType: event.Type, Payload: string(payload), NextAttemptAt: time.Now()})
+		}
+	}
+
+	if es.deliveryRepo.CreateDeliveries(deliveries) == false {
+		return errors.New("cannot create deliveries")
+	}
+
+	if len(deliveries) > 0 {
+		es.deliveries.Notify()
+	}
+
+	return nil
+}
+
+func (es *EventSubscriber) userDeleted(_ context.Context, event events.Event) error {
+	var userDeleted events.UserDeletedV1
+
+	if err := event.Decode(1, &userDeleted); err != nil {
+		return err
+	}
+
+	if es.webhookRepo.DeleteUserWebhooks(userDeleted.UserId) == false {
+		return errors.New("cannot delete user webhooks")
+	}
+
+	return nil
+}
+
+// Subscribed reports whether the webhook's event filter contains the event type.
+func Subscribed(webhook models.Webhook, eventType string) bool {
+	for _, subscribed := range strings.Fields(webhook.Events) {
+		if subscribed == eventType {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subjects returns the users whose webhooks receive the event, or the ShareSpace for ShareSpace events.
+func subjects(event events.Event) ([]uint, uint, error) {
+	switch event.Type {
+	case events.FileCreated:
+		var fileCreated events.FileCreatedV1
+		err := event.Decode(1, &fileCreated)
+		return []uint{fileCreated.OwnerId}, 0, err
+	case events.FileDeleted:
+		var fileDeleted events.FileDeletedV1
+		err := event.Decode(1, &fileDeleted)
+		return []uint{fileDeleted.OwnerId}, 0, err
+	case events.ShareCreated:
+		var shareCreated events.ShareCreatedV1
+		err := event.Decode(1, &shareCreated)
+		return []uint{shareCreated.SharedById, shareCreated.SharedForId}, 0, err
+	case events.ShareSpaceFileCreated:
+		var fileCreated events.ShareSpaceFileCreatedV1
+		err := event.Decode(1, &fileCreated)
+		return nil, fileCreated.ShareSpaceId, err
+	case events.ShareSpaceFileDeleted:
+		var fileDeleted events.ShareSpaceFileDeletedV1
+		err := event.Decode(1, &fileDeleted)
+		return nil, fileDeleted.ShareSpaceId, err
+	case events.ShareSpaceMemberRemoved:
+		var memberRemoved events.ShareSpaceMemberRemovedV1
+		err := event.Decode(1, &memberRemoved)
+		return nil, memberRemoved.ShareSpaceId, err
+	}
+
+	return nil, 0, nil
+}